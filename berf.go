@@ -9,6 +9,7 @@ import (
 	"os"
 	"reflect"
 	"runtime"
+	"strings"
 	"sync"
 	"time"
 
@@ -35,6 +36,7 @@ var (
 	pVerbose    = fla9.Count(pf+"v", 0, "Verbose level, e.g. -v -vv")
 	pThinkTime  = fla9.String(pf+"think", "", "Think time among requests, eg. 1s, 10ms, 10-20ms and etc. (unit ns, us/µs, ms, s, m, h)")
 	pPort       = fla9.Int(pf+"port", 28888, "Listen port for serve Web UI")
+	pSocket     = fla9.String(pf+"socket", "", "Listen unix socket for serve Web UI instead of the port, e.g. /tmp/berf.sock, @berf for a Linux abstract socket")
 	pName       = fla9.String(pf+"name", "", "Name for this benchmarking test")
 )
 
@@ -53,6 +55,10 @@ type Config struct {
 	Incr         util.GoroutineIncr
 
 	ChartPort int
+	// ChartPhases shows the latency phases view in the charts.
+	ChartPhases bool
+	// ChartSocket is the unix socket to serve the Web UI instead of ChartPort.
+	ChartSocket string
 
 	Duration   time.Duration
 	Verbose    int
@@ -72,18 +78,82 @@ func WithCounting(name string) ConfigFn { return func(c *Config) { c.CountingNam
 // WithOkStatus set the status which represents OK.
 func WithOkStatus(okStatus string) ConfigFn { return func(c *Config) { c.OkStatus = okStatus } }
 
+// WithPhases shows the latency phases view in the charts.
+func WithPhases(v bool) ConfigFn { return func(c *Config) { c.ChartPhases = v } }
+
 // WithConfig with customized config.
 func WithConfig(v *Config) ConfigFn { return func(c *Config) { *c = *v } }
 
 // Result defines the benchmark result.
 type Result struct {
-	Status     []string
-	Counting   []string
+	Status   []string
+	Counting []string
+	// Subs are the results of sub operations within the invocation, like token refreshing,
+	// which are reported separately.
+	Subs       []SubResult
 	ReadBytes  int64
 	WriteBytes int64
 	Cost       time.Duration
 }
 
+// SubResult defines the result of a sub operation.
+type SubResult struct {
+	Name   string
+	Status string
+	Cost   time.Duration
+}
+
+// AddSub appends a sub operation result.
+func (r *Result) AddSub(name, status string, cost time.Duration) {
+	r.Subs = append(r.Subs, SubResult{Name: name, Status: status, Cost: cost})
+}
+
+// PhasePrefix is the name prefix of the sub operations of the latency phases.
+const PhasePrefix = "phase "
+
+// Phases are the latency phases of a request in order, reported as the sub operations and charted in the phases view.
+var Phases = []string{"dns", "connect", "tls", "write", "ttfb", "transfer"}
+
+// AddPhase appends the latency of a phase of the request, status is like new or reused of the connection.
+func (r *Result) AddPhase(phase, status string, cost time.Duration) {
+	r.AddSub(PhasePrefix+phase, status, cost)
+}
+
+// VirtualUser defines a virtual user, which is a benchmarking goroutine that invokes the benchable in a loop.
+type VirtualUser struct {
+	// Values holds the benchable's own state of the virtual user,
+	// it is only accessed from the goroutine of the virtual user, so no lock is required.
+	Values map[string]interface{}
+	// ID is the sequence of the virtual user, starts from 0.
+	ID int
+	// Iteration is the sequence of the current invocation of the virtual user, starts from 1.
+	Iteration int
+}
+
+// Value gets the value of the key, or creates it by the create function when it is absent.
+func (v *VirtualUser) Value(key string, create func() interface{}) interface{} {
+	if val, ok := v.Values[key]; ok {
+		return val
+	}
+
+	val := create()
+	v.Values[key] = val
+	return val
+}
+
+type virtualUserKey struct{}
+
+// WithVirtualUser returns a copy of ctx which carries the virtual user.
+func WithVirtualUser(ctx context.Context, vu *VirtualUser) context.Context {
+	return context.WithValue(ctx, virtualUserKey{}, vu)
+}
+
+// GetVirtualUser gets the virtual user carried by ctx, or nil when ctx is not from a virtual user.
+func GetVirtualUser(ctx context.Context) *VirtualUser {
+	vu, _ := ctx.Value(virtualUserKey{}).(*VirtualUser)
+	return vu
+}
+
 // BenchOption defines the bench option.
 type BenchOption struct {
 	NoReport bool
@@ -126,6 +196,7 @@ func StartBench(ctx context.Context, fn Benchable, fns ...ConfigFn) {
 		N: *pN, Duration: *pDuration, Goroutines: *pGoroutines, GoMaxProcs: *pGoMaxProcs,
 		Incr: util.ParseGoIncr(*pGoIncr), PlotsFile: *pPlotsFile,
 		QPS: *pQPS, FeaturesConf: *pFeatures, Verbose: *pVerbose, ThinkTime: *pThinkTime, ChartPort: *pPort,
+		ChartSocket: *pSocket,
 	}
 	for _, f := range fns {
 		f(c)
@@ -177,6 +248,17 @@ func (c *Config) serveCharts(report *StreamReport, wg *sync.WaitGroup) {
 	wg.Add(1)
 	go c.collectChartData(report.requester.ctx, report.Charts, charts, wg)
 
+	if c.ChartSocket != "" && (c.IsDryPlots() || c.N != 1) {
+		if !strings.HasPrefix(c.ChartSocket, "@") {
+			_ = os.Remove(c.ChartSocket) // 删除上次遗留的 socket 文件
+		}
+		ln, err := net.Listen("unix", c.ChartSocket)
+		osx.ExitIfErr(err)
+		fmt.Printf("@Real-time charts is on unix socket %s, e.g. curl --unix-socket %s http://localhost/\n", c.ChartSocket, c.ChartSocket)
+		charts.Serve(ln, 0)
+		return
+	}
+
 	if c.IsDryPlots() || c.ChartPort > 0 && c.N != 1 && c.Verbose >= 1 {
 		addr := fmt.Sprintf(":%d", c.ChartPort)
 		ln, err := net.Listen("tcp", addr)
@@ -128,6 +128,7 @@ var titleCn = map[string]string{
 	"latency":           "延时",
 	"latencypercentile": "百分位延时",
 	"concurrent":        "并发",
+	"phases":            "阶段延时",
 	"procstat":          "进程",
 	"mem":               "内存",
 	"netstat":           "网络",
@@ -188,6 +189,11 @@ func (c *Views) newLatencyPercentileView() components.Charter {
 	})
 }
 
+func (c *Views) newPhasesView() components.Charter {
+	series := []string{"DNS", "Connect", "TLS", "Write", "TTFB", "Transfer"}
+	return c.newView("phases", "ms", plugins.Series{Series: series, Selected: series})
+}
+
 func (c *Views) newConcurrentView() components.Charter {
 	return c.newView("concurrent", "", plugins.Series{Series: []string{"Concurrent"}})
 }
@@ -293,6 +299,9 @@ func (c *Charts) renderCharts(w io.Writer, size, viewsArg string) {
 			if !c.config.Incr.IsEmpty() || c.config.IsDryPlots() {
 				fns = append(fns, v.newConcurrentView)
 			}
+			if c.config.ChartPhases {
+				fns = append(fns, v.newPhasesView)
+			}
 		} else {
 			if views.HasAny("latency", "l") {
 				fns = append(fns, v.newLatencyView)
@@ -306,6 +315,9 @@ func (c *Charts) renderCharts(w io.Writer, size, viewsArg string) {
 			if views.HasAny("concurrent", "c") {
 				fns = append(fns, v.newConcurrentView)
 			}
+			if views.HasAny("phases", "ph") {
+				fns = append(fns, v.newPhasesView)
+			}
 		}
 	}
 
@@ -322,6 +334,7 @@ func (c *Charts) renderCharts(w io.Writer, size, viewsArg string) {
 	_ = p.Render(w)
 }
 
+// Serve serves the charts on ln, and opens the browser for the port, 0 for the unix socket without browser.
 func (c *Charts) Serve(ln net.Listener, port int) {
 	server := fasthttp.Server{
 		Handler: cors.DefaultHandler().CorsMiddleware(c.Handler),
@@ -329,11 +342,18 @@ func (c *Charts) Serve(ln net.Listener, port int) {
 
 	if c.config.IsDryPlots() {
 		log.Printf("Running in dry mode for %s", c.config.PlotsFile)
-		go osx.OpenBrowser(fmt.Sprintf("http://127.0.0.1:%d", port))
+		if port > 0 {
+			go osx.OpenBrowser(fmt.Sprintf("http://127.0.0.1:%d", port))
+		}
 		osx.ExitIfErr(server.Serve(ln))
 		return
 	}
 
+	if port == 0 {
+		go func() { osx.ExitIfErr(server.Serve(ln)) }()
+		return
+	}
+
 	go func() {
 		time.Sleep(3 * time.Second) // 3s之后再弹出，避免运行时间过短，程序已经退出
 		go osx.OpenBrowser(fmt.Sprintf("http://127.0.0.1:%d", port))
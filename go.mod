@@ -13,6 +13,7 @@ require (
 	github.com/bingoohuang/jj v0.0.0-20231223130052-8880c7020d67
 	github.com/bmatcuk/doublestar/v4 v4.6.1
 	github.com/deatil/go-cryptobin v1.0.2060
+	github.com/dop251/goja v0.0.0-20260106131823-651366fbe6e3
 	github.com/dustin/go-humanize v1.0.1
 	github.com/emmansun/gmsm v0.26.1
 	github.com/gabriel-vasile/mimetype v1.4.3
@@ -31,10 +32,12 @@ require (
 	github.com/thoas/go-funk v0.9.3
 	github.com/valyala/fasthttp v1.52.0
 	go.uber.org/multierr v1.11.0
+	golang.org/x/crypto v0.22.0
 	golang.org/x/net v0.24.0
 	golang.org/x/sys v0.19.0
 	google.golang.org/grpc v1.63.0
 	google.golang.org/protobuf v1.33.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -45,9 +48,12 @@ require (
 	github.com/cristalhq/base64 v0.1.2 // indirect
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/dgryski/go-metro v0.0.0-20211217172704-adc40b04c140 // indirect
+	github.com/dlclark/regexp2 v1.11.4 // indirect
 	github.com/fogleman/gg v1.3.0 // indirect
 	github.com/go-ole/go-ole v1.3.0 // indirect
+	github.com/go-sourcemap/sourcemap v2.1.3+incompatible // indirect
 	github.com/golang/freetype v0.0.0-20170609003504-e2365dfdc4a0 // indirect
+	github.com/google/pprof v0.0.0-20230207041349-798e818bf904 // indirect
 	github.com/klauspost/compress v1.17.7 // indirect
 	github.com/lufia/plan9stats v0.0.0-20240226150601-1dcf7310316a // indirect
 	github.com/pbnjay/pixfont v0.0.0-20200714042608-33b744692567 // indirect
@@ -62,10 +68,8 @@ require (
 	github.com/vmihailenco/msgpack/v5 v5.4.1 // indirect
 	github.com/vmihailenco/tagparser/v2 v2.0.0 // indirect
 	github.com/yusufpapurcu/wmi v1.2.4 // indirect
-	golang.org/x/crypto v0.22.0 // indirect
 	golang.org/x/exp v0.0.0-20240404231335-c0f41cb1a7a0 // indirect
 	golang.org/x/image v0.15.0 // indirect
 	golang.org/x/text v0.14.0 // indirect
 	google.golang.org/genproto/googleapis/rpc v0.0.0-20240401170217-c3f982113cda // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
@@ -0,0 +1,328 @@
+package blow
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	mrand "math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/bingoohuang/berf"
+	"github.com/bingoohuang/berf/pkg/blow/internal"
+	"github.com/valyala/fasthttp"
+	"golang.org/x/crypto/pkcs12"
+)
+
+// clientIdentity is a client certificate with its own connection pool, to simulate many distinct mTLS clients.
+type clientIdentity struct {
+	name   string
+	cert   tls.Certificate
+	invoke func(*fasthttp.Request, *fasthttp.Response) error
+
+	handshakeFailures int64
+	lastErr           atomic.Value
+}
+
+// isClientCertPool tells the -cert is a directory or a PKCS#12 bundle of client certs, instead of a single cert.
+func isClientCertPool(path string) bool {
+	if ext := strings.ToLower(filepath.Ext(path)); ext == ".p12" || ext == ".pfx" {
+		return true
+	}
+	fi, err := os.Stat(path)
+	return err == nil && fi.IsDir()
+}
+
+// loadClientIdentities loads the client certs from a PKCS#12 bundle, or a directory of
+// name.pem/name.crt with name.key pairs and *.p12/*.pfx bundles, files starting with _ (like the minted _ca.crt) are skipped.
+func loadClientIdentities(path, password string) ([]*clientIdentity, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !fi.IsDir() {
+		return loadPKCS12(path, password)
+	}
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []*clientIdentity
+	for _, e := range entries {
+		name := e.Name()
+		ext := strings.ToLower(filepath.Ext(name))
+		if e.IsDir() || strings.HasPrefix(name, "_") {
+			continue
+		}
+
+		f := filepath.Join(path, name)
+		switch ext {
+		case ".p12", ".pfx":
+			bundle, err := loadPKCS12(f, password)
+			if err != nil {
+				return nil, err
+			}
+			ids = append(ids, bundle...)
+		case ".pem", ".crt":
+			keyFile := strings.TrimSuffix(f, filepath.Ext(f)) + ".key"
+			if _, err := os.Stat(keyFile); err != nil {
+				continue // 没有私钥的证书，例如 CA 证书
+			}
+			c, err := tls.LoadX509KeyPair(f, keyFile)
+			if err != nil {
+				return nil, fmt.Errorf("load client cert %s: %w", f, err)
+			}
+			ids = append(ids, &clientIdentity{name: strings.TrimSuffix(name, filepath.Ext(name)), cert: c})
+		}
+	}
+
+	if len(ids) == 0 {
+		return nil, fmt.Errorf("no client certs found in %s", path)
+	}
+	return ids, nil
+}
+
+// loadPKCS12 loads the client certs of a PKCS#12 bundle, the certs and keys are paired by their localKeyId.
+func loadPKCS12(file, password string) ([]*clientIdentity, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	blocks, err := pkcs12.ToPEM(data, password)
+	if err != nil {
+		return nil, fmt.Errorf("decode PKCS#12 %s: %w", file, err)
+	}
+
+	certs := map[string][]byte{}
+	keys := map[string][]byte{}
+	var ids []string
+	for i, b := range blocks {
+		id := b.Headers["localKeyId"]
+		if id == "" {
+			id = strconv.Itoa(i / 2) // 没有 localKeyId 时，按照顺序配对
+		}
+		switch {
+		case b.Type == "CERTIFICATE" && certs[id] == nil:
+			certs[id] = pem.EncodeToMemory(&pem.Block{Type: b.Type, Bytes: b.Bytes})
+			ids = append(ids, id)
+		case strings.HasSuffix(b.Type, "PRIVATE KEY"):
+			keys[id] = pem.EncodeToMemory(&pem.Block{Type: b.Type, Bytes: b.Bytes})
+		}
+	}
+
+	var identities []*clientIdentity
+	base := strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+	for i, id := range ids {
+		if keys[id] == nil {
+			continue
+		}
+		c, err := tls.X509KeyPair(certs[id], keys[id])
+		if err != nil {
+			return nil, fmt.Errorf("load client cert %d of %s: %w", i, file, err)
+		}
+		name := fmt.Sprintf("%s#%d", base, i)
+		if leaf, err := x509.ParseCertificate(c.Certificate[0]); err == nil && leaf.Subject.CommonName != "" {
+			name = leaf.Subject.CommonName
+		}
+		identities = append(identities, &clientIdentity{name: name, cert: c})
+	}
+
+	if len(identities) == 0 {
+		return nil, fmt.Errorf("no client cert with private key found in %s", file)
+	}
+	return identities, nil
+}
+
+// pickIdentity assigns a client identity to a new virtual user, round-robin by default, or randomly by -cert.pick rand.
+func (r *Invoker) pickIdentity() *clientIdentity {
+	if len(r.identities) == 0 {
+		return nil
+	}
+	if r.opt.certPick == "rand" {
+		return r.identities[mrand.Intn(len(r.identities))]
+	}
+	return r.identities[int(atomic.AddUint32(&r.identityIndex, 1)-1)%len(r.identities)]
+}
+
+// do sends the request with the connection pool of the client identity or the proxy of the virtual user,
+// the latency phases are added to rr by -phases.
+func (r *Invoker) do(s *vuState, req *fasthttp.Request, rsp *fasthttp.Response, rr *berf.Result) error {
+	var err error
+	switch {
+	case s.proxy != nil:
+		err = s.proxy.invoke(req, rsp)
+	case s.identity != nil:
+		if err = s.identity.invoke(req, rsp); err != nil && isHandshakeError(err) {
+			atomic.AddInt64(&s.identity.handshakeFailures, 1)
+			s.identity.lastErr.Store(err.Error())
+		}
+	default:
+		err = r.httpInvoke(req, rsp)
+	}
+
+	if err == nil {
+		internal.CountRequest(rsp.LocalAddr())
+		if r.opt.phases {
+			addPhases(rr, rsp)
+		}
+	}
+	return err
+}
+
+// isHandshakeError tells the error is from the TLS handshake, like the client cert is rejected by the server.
+func isHandshakeError(err error) bool {
+	var alert tls.AlertError
+	var verify *tls.CertificateVerificationError
+	var record tls.RecordHeaderError
+	if errors.As(err, &alert) || errors.As(err, &verify) || errors.As(err, &record) ||
+		errors.Is(err, fasthttp.ErrTLSHandshakeTimeout) {
+		return true
+	}
+	return strings.Contains(err.Error(), "tls:")
+}
+
+// reportIdentities prints the client identities with TLS handshake failures.
+func (r *Invoker) reportIdentities(w io.Writer) {
+	var failed []*clientIdentity
+	for _, id := range r.identities {
+		if atomic.LoadInt64(&id.handshakeFailures) > 0 {
+			failed = append(failed, id)
+		}
+	}
+	if len(failed) == 0 {
+		return
+	}
+
+	sort.Slice(failed, func(i, j int) bool { return failed[i].handshakeFailures > failed[j].handshakeFailures })
+	_, _ = fmt.Fprintf(w, "\nClient cert handshake failures (%d of %d identities):\n", len(failed), len(r.identities))
+	for _, id := range failed {
+		lastErr, _ := id.lastErr.Load().(string)
+		_, _ = fmt.Fprintf(w, "  %-20s %8d  %s\n", id.name, id.handshakeFailures, lastErr)
+	}
+}
+
+// mintClientCerts creates n client certs name.pem/name.key signed by the CA _ca.crt/_ca.key in the dir,
+// the CA is created when it does not exist, so that the server can trust the client certs by _ca.crt.
+func mintClientCerts(dir string, n int) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	caCert, caKey, err := loadOrCreateCA(filepath.Join(dir, "_ca.crt"), filepath.Join(dir, "_ca.key"))
+	if err != nil {
+		return err
+	}
+
+	for i := 1; i <= n; i++ {
+		name := fmt.Sprintf("client-%05d", i)
+		tpl := &x509.Certificate{
+			SerialNumber: newSerial(),
+			Subject:      pkix.Name{CommonName: name, Organization: []string{"berf"}},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().AddDate(1, 0, 0),
+			KeyUsage:     x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		}
+		base := filepath.Join(dir, name)
+		if err := writeCert(base+".pem", base+".key", tpl, caCert, caKey); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func loadOrCreateCA(certFile, keyFile string) (*x509.Certificate, *ecdsa.PrivateKey, error) {
+	if c, err := tls.LoadX509KeyPair(certFile, keyFile); err == nil {
+		ca, err := x509.ParseCertificate(c.Certificate[0])
+		if err != nil {
+			return nil, nil, err
+		}
+		key, ok := c.PrivateKey.(*ecdsa.PrivateKey)
+		if !ok {
+			return nil, nil, fmt.Errorf("CA key %s should be an ECDSA key", keyFile)
+		}
+		return ca, key, nil
+	}
+
+	tpl := &x509.Certificate{
+		SerialNumber:          newSerial(),
+		Subject:               pkix.Name{CommonName: "berf test client CA", Organization: []string{"berf"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().AddDate(10, 0, 0),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	if err := writeCert(certFile, keyFile, tpl, nil, nil); err != nil {
+		return nil, nil, err
+	}
+	return loadOrCreateCA(certFile, keyFile)
+}
+
+// writeCert creates a key and the cert of the template, signed by the parent, or self-signed when the parent is nil,
+// and writes them to certFile and keyFile.
+func writeCert(certFile, keyFile string, tpl, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	if parent == nil {
+		parent, parentKey = tpl, key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tpl, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		return err
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o644); err != nil {
+		return err
+	}
+	return os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0o600)
+}
+
+func newSerial() *big.Int {
+	n, _ := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 127))
+	return n
+}
+
+// mintCerts creates the test client certs by -cert.mint dir:n.
+func (b *Bench) mintCerts() error {
+	dir, num, _ := strings.Cut(*pCertMint, ":")
+	n := 10
+	if num != "" {
+		var err error
+		if n, err = strconv.Atoi(num); err != nil || n <= 0 {
+			return fmt.Errorf("invalid -cert.mint %s, should be like certs:100", *pCertMint)
+		}
+	}
+
+	if err := mintClientCerts(dir, n); err != nil {
+		return fmt.Errorf("mint client certs: %w", err)
+	}
+
+	log.Printf("%d client certs created in %s, trust them by the CA %s, use them by -cert %s",
+		n, dir, filepath.Join(dir, "_ca.crt"), dir)
+	return io.EOF
+}
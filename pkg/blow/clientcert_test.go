@@ -0,0 +1,40 @@
+package blow
+
+import (
+	"crypto/x509"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMintClientCerts(t *testing.T) {
+	dir := t.TempDir()
+	assert.Nil(t, mintClientCerts(dir, 3))
+	assert.True(t, isClientCertPool(dir))
+
+	ids, err := loadClientIdentities(dir, "")
+	assert.Nil(t, err)
+	assert.Len(t, ids, 3)
+	assert.Equal(t, "client-00001", ids[0].name)
+
+	caPEM, err := os.ReadFile(filepath.Join(dir, "_ca.crt"))
+	assert.Nil(t, err)
+	roots := x509.NewCertPool()
+	assert.True(t, roots.AppendCertsFromPEM(caPEM))
+
+	leaf, err := x509.ParseCertificate(ids[2].cert.Certificate[0])
+	assert.Nil(t, err)
+	_, err = leaf.Verify(x509.VerifyOptions{Roots: roots, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}})
+	assert.Nil(t, err)
+
+	// minting more reuses the existing CA
+	assert.Nil(t, mintClientCerts(dir, 4))
+	ids, err = loadClientIdentities(dir, "")
+	assert.Nil(t, err)
+	assert.Len(t, ids, 4)
+	leaf, _ = x509.ParseCertificate(ids[3].cert.Certificate[0])
+	_, err = leaf.Verify(x509.VerifyOptions{Roots: roots, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}})
+	assert.Nil(t, err)
+}
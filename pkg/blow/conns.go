@@ -0,0 +1,129 @@
+package blow
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/bingoohuang/berf/pkg/blow/internal"
+	"github.com/valyala/fasthttp"
+)
+
+// connOption is the connection lifecycle options of the -conn.* flags.
+type connOption struct {
+	// requests is the max number of the requests per connection, 0 for unlimited.
+	requests int
+	// lifetime is the max lifetime of the connections, 0 for unlimited.
+	lifetime time.Duration
+	// rate is the max number of the new connections dialed per second, 0 for unlimited.
+	rate float64
+}
+
+// churnDialer closes the connections after every n requests, see churnConn.
+func churnDialer(dial fasthttp.DialFunc, n int) fasthttp.DialFunc {
+	return func(addr string) (net.Conn, error) {
+		conn, err := dial(addr)
+		if err != nil {
+			return nil, err
+		}
+		return &churnConn{Conn: conn, max: n}, nil
+	}
+}
+
+var connectionCloseHeader = []byte("Connection: close\r\n")
+
+// churnConn adds the header Connection: close to the last request of the connection,
+// so that the connection is closed by both the server and fasthttp after its response.
+// It wraps the plain (or decrypted TLS) connection, so the request line starts its first write.
+type churnConn struct {
+	net.Conn
+	max, requests int
+	reading       bool
+}
+
+// Handshake tells fasthttp the TLS (or TLCP) connection is established already by the dialer.
+func (c *churnConn) Handshake() error {
+	if h, ok := c.Conn.(interface{ Handshake() error }); ok {
+		return h.Handshake()
+	}
+	return nil
+}
+
+func (c *churnConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if n > 0 {
+		c.reading = true
+	}
+	return n, err
+}
+
+func (c *churnConn) Write(b []byte) (int, error) {
+	if c.requests > 0 && !c.reading {
+		return c.Conn.Write(b)
+	}
+
+	// 上个响应读取之后的首次写，即新请求的开始
+	c.requests++
+	c.reading = false
+	i := bytes.Index(b, []byte("\r\n"))
+	if c.requests < c.max || i < 0 {
+		return c.Conn.Write(b)
+	}
+
+	buf := make([]byte, 0, len(b)+len(connectionCloseHeader))
+	buf = append(append(append(buf, b[:i+2]...), connectionCloseHeader...), b[i+2:]...)
+	if n, err := c.Conn.Write(buf); err != nil {
+		return min(n, len(b)), err
+	}
+	return len(b), nil
+}
+
+// dialLimiter limits the rate of dialing new connections, to test the connection-setup capacity separately.
+type dialLimiter struct {
+	interval time.Duration
+	next     time.Time
+	mu       sync.Mutex
+}
+
+func newDialLimiter(rate float64) *dialLimiter {
+	return &dialLimiter{interval: time.Duration(float64(time.Second) / rate)}
+}
+
+// wait blocks until the next dialing is allowed.
+func (l *dialLimiter) wait() {
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	at := l.next
+	l.next = l.next.Add(l.interval)
+	l.mu.Unlock()
+
+	time.Sleep(time.Until(at))
+}
+
+func (l *dialLimiter) dialer(dial fasthttp.DialFunc) fasthttp.DialFunc {
+	return func(addr string) (net.Conn, error) {
+		l.wait()
+		return dial(addr)
+	}
+}
+
+// reportConns prints the lifecycle counters of the connections.
+func reportConns(w io.Writer, elapsed time.Duration) {
+	s := internal.GetConnStats()
+	if s.Opened == 0 {
+		return
+	}
+
+	_, _ = fmt.Fprintf(w, "\nConnections: opened %d (%.2f/s), closed %d, closed by server %d\n",
+		s.Opened, float64(s.Opened)/elapsed.Seconds(), s.Closed, s.ServerClosed)
+	if total := s.Fresh + s.Reused; total > 0 {
+		_, _ = fmt.Fprintf(w, "Requests: on new connections %d, on reused connections %d, reuse ratio %.2f%%\n",
+			s.Fresh, s.Reused, float64(s.Reused)*100/float64(total))
+	}
+}
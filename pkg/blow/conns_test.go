@@ -0,0 +1,127 @@
+package blow
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bingoohuang/berf/pkg/blow/internal"
+	"github.com/stretchr/testify/assert"
+	"github.com/valyala/fasthttp"
+)
+
+func TestChurnConn(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.RemoteAddr))
+	}))
+	defer ts.Close()
+
+	var readBytes, writeBytes int64
+	noop := func(c net.Conn) net.Conn { return c }
+	dial := internal.ThroughputStatDial(noop, ProxyHTTPDialerTimeout(0, dialer, true), &readBytes, &writeBytes)
+	dial = churnDialer(tlsDialer(dial, &tls.Config{InsecureSkipVerify: true}, 0), 2)
+	cli := &fasthttp.Client{Dial: dial}
+
+	before := internal.GetConnStats()
+	remotes := map[string]int{}
+	for i := 0; i < 6; i++ {
+		req, rsp := fasthttp.AcquireRequest(), fasthttp.AcquireResponse()
+		req.SetRequestURI(ts.URL)
+		assert.Nil(t, cli.Do(req, rsp))
+		internal.CountRequest(rsp.LocalAddr())
+		remotes[string(rsp.Body())]++
+		fasthttp.ReleaseRequest(req)
+		fasthttp.ReleaseResponse(rsp)
+	}
+
+	// 每个连接 2 个请求后关闭
+	assert.Equal(t, 3, len(remotes))
+	for _, n := range remotes {
+		assert.Equal(t, 2, n)
+	}
+
+	after := internal.GetConnStats()
+	assert.Equal(t, int64(3), after.Opened-before.Opened)
+	assert.Equal(t, int64(3), after.Fresh-before.Fresh)
+	assert.Equal(t, int64(3), after.Reused-before.Reused)
+}
+
+// TestConnReuseTLS checks the default https path, where fasthttp does the TLS handshake lazily over the traced connection,
+// the handshake messages should not make the first request on the connection counted as reused.
+func TestConnReuseTLS(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	var readBytes, writeBytes int64
+	noop := func(c net.Conn) net.Conn { return c }
+	cli := &fasthttp.Client{
+		TLSConfig: &tls.Config{InsecureSkipVerify: true},
+		Dial:      internal.ThroughputStatDial(noop, ProxyHTTPDialerTimeout(0, dialer, true), &readBytes, &writeBytes),
+	}
+
+	before := internal.GetConnStats()
+	for i := 0; i < 3; i++ {
+		req, rsp := fasthttp.AcquireRequest(), fasthttp.AcquireResponse()
+		req.SetRequestURI(ts.URL)
+		assert.Nil(t, cli.Do(req, rsp))
+		internal.CountRequest(rsp.LocalAddr())
+		fasthttp.ReleaseRequest(req)
+		fasthttp.ReleaseResponse(rsp)
+	}
+
+	after := internal.GetConnStats()
+	assert.Equal(t, int64(1), after.Opened-before.Opened)
+	assert.Equal(t, int64(1), after.Fresh-before.Fresh)
+	assert.Equal(t, int64(2), after.Reused-before.Reused)
+}
+
+// TestConnCountConcurrent counts the concurrent requests sharing the pooled keep-alive connections, run it with -race.
+func TestConnCountConcurrent(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	var readBytes, writeBytes int64
+	noop := func(c net.Conn) net.Conn { return c }
+	cli := &fasthttp.Client{
+		MaxConnsPerHost:    2,
+		MaxConnWaitTimeout: 5 * time.Second,
+		Dial:               internal.ThroughputStatDial(noop, ProxyHTTPDialerTimeout(0, dialer, false), &readBytes, &writeBytes),
+	}
+
+	before := internal.GetConnStats()
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				req, rsp := fasthttp.AcquireRequest(), fasthttp.AcquireResponse()
+				req.SetRequestURI(ts.URL)
+				if assert.Nil(t, cli.DoTimeout(req, rsp, 5*time.Second)) {
+					internal.CountRequest(rsp.LocalAddr())
+				}
+				fasthttp.ReleaseRequest(req)
+				fasthttp.ReleaseResponse(rsp)
+			}
+		}()
+	}
+	wg.Wait()
+
+	after := internal.GetConnStats()
+	opened := after.Opened - before.Opened
+	assert.Equal(t, opened, after.Fresh-before.Fresh)
+	assert.Equal(t, int64(400)-opened, after.Reused-before.Reused)
+}
+
+func TestDialLimiter(t *testing.T) {
+	l := newDialLimiter(100)
+	start := time.Now()
+	for i := 0; i < 11; i++ {
+		l.wait()
+	}
+	assert.GreaterOrEqual(t, time.Since(start), 100*time.Millisecond)
+}
@@ -0,0 +1,156 @@
+package blow
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bingoohuang/berf/pkg/util"
+	"github.com/bingoohuang/gg/pkg/iox"
+	"github.com/valyala/fasthttp"
+)
+
+// cookieOption defines the cookie jar option parsed from -cookie.
+type cookieOption struct {
+	// seeds are the cookies to fill in every new cookie jar.
+	seeds []seedCookie
+	// enabled tells whether the cookie jar is enabled.
+	enabled bool
+	// perIteration tells to clear cookies (and refill seeds) at the start of every iteration.
+	perIteration bool
+}
+
+type seedCookie struct {
+	u      *url.URL
+	cookie *http.Cookie
+}
+
+// parseCookieOption parses the cookie option like on, off, @cookies.txt, on:iter, @cookies.txt:iter.
+// The cookie jar is enabled by default for profiles.
+func parseCookieOption(s string, hasProfiles bool) (*cookieOption, error) {
+	o := &cookieOption{enabled: hasProfiles}
+	o.perIteration = util.SplitTail(&s, ":iter")
+
+	switch s = strings.TrimSpace(s); {
+	case s == "off" || s == "0":
+		o.enabled = false
+	case s == "on" || s == "1":
+		o.enabled = true
+	case strings.HasPrefix(s, "@"):
+		seeds, err := readCookiesFile(s[1:])
+		if err != nil {
+			return nil, err
+		}
+		o.enabled = true
+		o.seeds = seeds
+	case s == "":
+		o.enabled = o.enabled || o.perIteration
+	default:
+		return nil, fmt.Errorf("unknown cookie option %s", s)
+	}
+
+	return o, nil
+}
+
+// readCookiesFile reads cookies from the Netscape cookies.txt format file,
+// which is created by curl -c or exported by browser extensions.
+// Each line is: domain includeSubdomains path secure expiry name value, separated by tab.
+func readCookiesFile(file string) (seeds []seedCookie, err error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("open cookies file %s: %w", file, err)
+	}
+	defer iox.Close(f)
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		httpOnly := strings.HasPrefix(line, "#HttpOnly_")
+		if httpOnly {
+			line = strings.TrimPrefix(line, "#HttpOnly_")
+		}
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Split(line, "\t")
+		if len(fields) < 7 {
+			return nil, fmt.Errorf("bad cookie line %q in file %s", line, file)
+		}
+
+		domain := strings.TrimPrefix(fields[0], ".")
+		secure := strings.EqualFold(fields[3], "TRUE")
+		c := &http.Cookie{
+			Name:     fields[5],
+			Value:    fields[6],
+			Path:     fields[2],
+			Secure:   secure,
+			HttpOnly: httpOnly,
+		}
+		if strings.EqualFold(fields[1], "TRUE") {
+			c.Domain = domain
+		}
+		if expiry, _ := strconv.ParseInt(fields[4], 10, 64); expiry > 0 {
+			c.Expires = time.Unix(expiry, 0)
+		}
+
+		u := &url.URL{Scheme: "http", Host: domain, Path: fields[2]}
+		if secure {
+			u.Scheme = "https"
+		}
+		seeds = append(seeds, seedCookie{u: u, cookie: c})
+	}
+
+	return seeds, scanner.Err()
+}
+
+func (o *cookieOption) newJar() *cookiejar.Jar {
+	jar, _ := cookiejar.New(nil)
+	for _, seed := range o.seeds {
+		jar.SetCookies(seed.u, []*http.Cookie{seed.cookie})
+	}
+	return jar
+}
+
+func requestURL(req *fasthttp.Request) *url.URL {
+	u, err := url.Parse(req.URI().String())
+	if err != nil {
+		return nil
+	}
+	return u
+}
+
+// applyCookies adds the cookies in the jar which match the request URL to the request.
+func applyCookies(jar http.CookieJar, req *fasthttp.Request) {
+	if u := requestURL(req); u != nil {
+		for _, c := range jar.Cookies(u) {
+			req.Header.SetCookie(c.Name, c.Value)
+		}
+	}
+}
+
+// saveCookies saves the Set-Cookie of the response to the jar.
+func saveCookies(jar http.CookieJar, req *fasthttp.Request, rsp *fasthttp.Response) []*http.Cookie {
+	var lines []string
+	rsp.Header.VisitAllCookie(func(_, value []byte) {
+		lines = append(lines, string(value))
+	})
+	if len(lines) == 0 {
+		return nil
+	}
+
+	u := requestURL(req)
+	if u == nil {
+		return nil
+	}
+
+	cookies := (&http.Response{Header: http.Header{"Set-Cookie": lines}}).Cookies()
+	jar.SetCookies(u, cookies)
+	return cookies
+}
@@ -0,0 +1,129 @@
+package blow
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bingoohuang/berf"
+	"github.com/stretchr/testify/assert"
+	"github.com/valyala/fasthttp"
+)
+
+// cookieServer sets the cookie sid by /login?u=name, and echoes the cookies of the request by /me.
+func cookieServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/login" {
+			http.SetCookie(w, &http.Cookie{Name: "sid", Value: r.URL.Query().Get("u"), Path: "/"})
+			return
+		}
+		_, _ = w.Write([]byte(r.Header.Get("Cookie")))
+	}))
+}
+
+func newCookieInvoker(t *testing.T, spec string) *Invoker {
+	o, err := parseCookieOption(spec, true)
+	assert.Nil(t, err)
+
+	r := &Invoker{opt: &Opt{cookie: o}, httpInvoke: (&fasthttp.Client{}).Do}
+	r.sharedState = r.newVUState(0)
+	r.sharedState.shared = true
+	return r
+}
+
+func newVUContext(id int) (context.Context, *berf.VirtualUser) {
+	vu := &berf.VirtualUser{Values: map[string]interface{}{}, ID: id, Iteration: 1}
+	return berf.WithVirtualUser(context.Background(), vu), vu
+}
+
+func sendCookie(t *testing.T, r *Invoker, ctx context.Context, url string) string {
+	req, rsp := fasthttp.AcquireRequest(), fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseRequest(req)
+	defer fasthttp.ReleaseResponse(rsp)
+
+	req.SetRequestURI(url)
+	assert.Nil(t, r.invoke(ctx, req, rsp, &berf.Result{}, nil, nil))
+	return string(rsp.Body())
+}
+
+func TestCookieJarPerVU(t *testing.T) {
+	ts := cookieServer()
+	defer ts.Close()
+
+	r := newCookieInvoker(t, "")
+	ctx1, vu1 := newVUContext(1)
+	ctx2, _ := newVUContext(2)
+
+	sendCookie(t, r, ctx1, ts.URL+"/login?u=scott")
+	sendCookie(t, r, ctx2, ts.URL+"/login?u=tiger")
+	assert.Equal(t, "sid=scott", sendCookie(t, r, ctx1, ts.URL+"/me"))
+	assert.Equal(t, "sid=tiger", sendCookie(t, r, ctx2, ts.URL+"/me"))
+
+	// 默认在迭代之间保留 Cookie
+	vu1.Iteration++
+	assert.Equal(t, "sid=scott", sendCookie(t, r, ctx1, ts.URL+"/me"))
+
+	r = newCookieInvoker(t, "off")
+	ctx3, _ := newVUContext(3)
+	sendCookie(t, r, ctx3, ts.URL+"/login?u=scott")
+	assert.Equal(t, "", sendCookie(t, r, ctx3, ts.URL+"/me"))
+}
+
+func TestCookieJarPerIteration(t *testing.T) {
+	ts := cookieServer()
+	defer ts.Close()
+
+	r := newCookieInvoker(t, "on:iter")
+	ctx, vu := newVUContext(1)
+
+	sendCookie(t, r, ctx, ts.URL+"/login?u=scott")
+	assert.Equal(t, "sid=scott", sendCookie(t, r, ctx, ts.URL+"/me"))
+
+	vu.Iteration++
+	assert.Equal(t, "", sendCookie(t, r, ctx, ts.URL+"/me"))
+}
+
+func TestCookieJarSeeds(t *testing.T) {
+	ts := cookieServer()
+	defer ts.Close()
+
+	f := filepath.Join(t.TempDir(), "cookies.txt")
+	assert.Nil(t, os.WriteFile(f, []byte("# Netscape HTTP Cookie File\n"+
+		"127.0.0.1\tFALSE\t/\tFALSE\t0\tlang\tzh\n"+
+		"#HttpOnly_127.0.0.1\tFALSE\t/admin\tFALSE\t0\tadmin\t1\n"), 0o644))
+
+	r := newCookieInvoker(t, "@"+f+":iter")
+	ctx1, vu1 := newVUContext(1)
+	ctx2, _ := newVUContext(2)
+
+	assert.Equal(t, "lang=zh", sendCookie(t, r, ctx1, ts.URL+"/me"))
+	assert.Equal(t, "lang=zh", sendCookie(t, r, ctx2, ts.URL+"/me"))
+	assert.Equal(t, "admin=1; lang=zh", sendCookie(t, r, ctx2, ts.URL+"/admin/me"))
+
+	sendCookie(t, r, ctx1, ts.URL+"/login?u=scott")
+	assert.Equal(t, "lang=zh; sid=scott", sendCookie(t, r, ctx1, ts.URL+"/me"))
+
+	// 新的迭代清空 Cookie 后重新填充种子
+	vu1.Iteration++
+	assert.Equal(t, "lang=zh", sendCookie(t, r, ctx1, ts.URL+"/me"))
+}
+
+func TestCookieJarInitSeeds(t *testing.T) {
+	ts := cookieServer()
+	defer ts.Close()
+
+	r := newCookieInvoker(t, "")
+
+	// [init] 中的登录在虚拟用户之外执行，得到的 Cookie 作为种子分发给所有虚拟用户
+	sendCookie(t, r, context.Background(), ts.URL+"/login?u=admin")
+
+	ctx1, _ := newVUContext(1)
+	ctx2, _ := newVUContext(2)
+	assert.Equal(t, "sid=admin", sendCookie(t, r, ctx1, ts.URL+"/me"))
+	sendCookie(t, r, ctx2, ts.URL+"/login?u=tiger")
+	assert.Equal(t, "sid=tiger", sendCookie(t, r, ctx2, ts.URL+"/me"))
+	assert.Equal(t, "sid=admin", sendCookie(t, r, ctx1, ts.URL+"/me"))
+}
@@ -0,0 +1,56 @@
+package blow
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/valyala/fasthttp"
+)
+
+// curlCommand creates a reproducible curl command line of the request,
+// the request should be the one already sent, so the @var substitutions have been evaluated.
+func curlCommand(req *fasthttp.Request, insecure bool) string {
+	var b strings.Builder
+	b.WriteString("curl")
+
+	uri := req.URI()
+	if method := string(req.Header.Method()); method != fasthttp.MethodGet {
+		b.WriteString(" -X " + method)
+	}
+	if insecure && string(uri.Scheme()) == httpsScheme {
+		b.WriteString(" -k")
+	}
+	b.WriteString(" " + shellQuote(uri.String()))
+
+	host := string(uri.Host())
+	req.Header.VisitAll(func(key, value []byte) {
+		k := string(key)
+		switch strings.ToLower(k) {
+		case "content-length", "connection", "transfer-encoding":
+			return
+		case "host":
+			if string(value) == host {
+				return
+			}
+		}
+		b.WriteString(" -H " + shellQuote(k+": "+string(value)))
+	})
+
+	switch body := req.Body(); {
+	case req.IsBodyStream():
+		b.WriteString(" --data-binary @- # streamed body, like uploading file, not printable")
+	case len(body) == 0:
+	case !utf8.Valid(body):
+		b.WriteString(fmt.Sprintf(" --data-binary @- # %d bytes binary body, not printable", len(body)))
+	default:
+		b.WriteString(" --data-binary " + shellQuote(string(body)))
+	}
+
+	return b.String()
+}
+
+// shellQuote quotes s by single quotes for POSIX shells.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,37 @@
+package blow
+
+import (
+	"testing"
+
+	"github.com/bingoohuang/berf/pkg/blow/internal"
+	"github.com/stretchr/testify/assert"
+	"github.com/valyala/fasthttp"
+)
+
+func TestShellQuote(t *testing.T) {
+	for _, s := range []string{"", "a b", "it's", `"$HOME" \n`, "'", "line1\nline2"} {
+		p, err := internal.ParseCurl("curl http://a.cn/x -H " + shellQuote("X-Value: "+s))
+		assert.Nil(t, err)
+		assert.Equal(t, s, p.Header["X-Value"], s)
+	}
+}
+
+func TestCurlCommandRoundTrip(t *testing.T) {
+	req := fasthttp.AcquireRequest()
+	defer fasthttp.ReleaseRequest(req)
+	req.Header.SetMethod(fasthttp.MethodPut)
+	req.SetRequestURI("https://a.cn/x?a=1&b=it's")
+	req.Header.Set("X-Name", `bingoo "huang"`)
+	req.Header.SetContentType("application/json")
+	req.SetBodyString(`{"name":"it's"}`)
+
+	line := curlCommand(req, true)
+	p, err := internal.ParseCurl(line)
+	assert.Nil(t, err, line)
+	assert.Equal(t, "PUT", p.Method)
+	assert.Equal(t, "https://a.cn/x?a=1&b=it's", p.URL)
+	assert.Equal(t, `bingoo "huang"`, p.Header["X-Name"])
+	assert.Equal(t, "application/json", p.Header["Content-Type"])
+	assert.Equal(t, `{"name":"it's"}`, p.Body)
+	assert.Len(t, p.Comments, 1) // -k
+}
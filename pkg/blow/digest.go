@@ -0,0 +1,247 @@
+package blow
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/bingoohuang/berf/pkg/blow/internal"
+	"github.com/valyala/fasthttp"
+)
+
+const digestChallengeSubName = "digest challenge"
+
+// digestCred is the user and password for the HTTP Digest authentication (RFC 7616).
+type digestCred struct {
+	user, password string
+}
+
+// parseDigestCred parses the credential like digest:scott:tiger of -auth, or scott:tiger of the profile header Digest.
+func parseDigestCred(s string) *digestCred {
+	user, password, _ := strings.Cut(strings.TrimPrefix(s, "digest:"), ":")
+	return &digestCred{user: user, password: password}
+}
+
+// profileDigests resolves the digest credentials of the profiles,
+// the profile header Digest: user:pass takes precedence over -auth digest:user:pass.
+func (r *Invoker) profileDigests(profiles []*internal.Profile) {
+	r.digests = map[*internal.Profile]*digestCred{}
+	for _, p := range profiles {
+		if p.Digest != "" {
+			r.digests[p] = parseDigestCred(p.Digest)
+		} else {
+			r.digests[p] = r.digest
+		}
+	}
+}
+
+// digestChallenge is the parsed WWW-Authenticate: Digest challenge.
+type digestChallenge struct {
+	realm, nonce, opaque, algorithm, qop string
+	userhash, stale                      bool
+}
+
+// digestSession caches the challenge of a protection space, to authorize the following requests
+// preemptively with the increasing nonce count, without the 401 round trip.
+type digestSession struct {
+	digestChallenge
+	nc int
+}
+
+// digestCache holds the digest sessions of a virtual user by the host.
+type digestCache struct {
+	sessions map[string]*digestSession
+	mu       sync.Mutex
+}
+
+func (c *digestCache) get(host string) *digestSession {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.sessions[host]
+}
+
+func (c *digestCache) set(host string, s *digestSession) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.sessions == nil {
+		c.sessions = map[string]*digestSession{}
+	}
+	c.sessions[host] = s
+}
+
+// authorize sets the Authorization header with the next nonce count of the session.
+func (c *digestCache) authorize(s *digestSession, cred *digestCred, req *fasthttp.Request) {
+	c.mu.Lock()
+	s.nc++
+	nc := s.nc
+	c.mu.Unlock()
+
+	cnonce := make([]byte, 16)
+	_, _ = rand.Read(cnonce)
+	req.Header.Set("Authorization", s.authorization(cred, req, nc, hex.EncodeToString(cnonce)))
+}
+
+// nextNonce updates the nonce by the Authentication-Info: nextnonce="..." of the response.
+func (c *digestCache) nextNonce(s *digestSession, rsp *fasthttp.Response) {
+	info := rsp.Header.Peek("Authentication-Info")
+	if len(info) == 0 {
+		return
+	}
+	if n := parseAuthParams(string(info))["nextnonce"]; n != "" {
+		c.mu.Lock()
+		s.nonce, s.nc = n, 0
+		c.mu.Unlock()
+	}
+}
+
+// parseDigestChallenge finds the digest challenge of the 401 response,
+// the strongest algorithm is preferred when the server offers several ones.
+func parseDigestChallenge(rsp *fasthttp.Response) *digestChallenge {
+	var best *digestChallenge
+	for _, v := range rsp.Header.PeekAll("WWW-Authenticate") {
+		scheme, params, _ := strings.Cut(strings.TrimSpace(string(v)), " ")
+		if !strings.EqualFold(scheme, "Digest") {
+			continue
+		}
+
+		m := parseAuthParams(params)
+		c := &digestChallenge{
+			realm:     m["realm"],
+			nonce:     m["nonce"],
+			opaque:    m["opaque"],
+			algorithm: strings.ToUpper(m["algorithm"]),
+			userhash:  strings.EqualFold(m["userhash"], "true"),
+			stale:     strings.EqualFold(m["stale"], "true"),
+		}
+		if c.algorithm == "" {
+			c.algorithm = "MD5"
+		}
+		if digestHash(c.algorithm) == nil || c.nonce == "" {
+			continue
+		}
+
+		for _, q := range strings.Split(m["qop"], ",") {
+			// auth 优先，auth-int 需要对请求体计算摘要
+			if q = strings.TrimSpace(q); q == "auth" || q == "auth-int" && c.qop == "" {
+				c.qop = q
+			}
+		}
+
+		if best == nil || digestStrength(c.algorithm) > digestStrength(best.algorithm) {
+			best = c
+		}
+	}
+
+	return best
+}
+
+// parseAuthParams parses the auth params like realm="a, b", qop="auth,auth-int", algorithm=MD5.
+func parseAuthParams(s string) map[string]string {
+	m := map[string]string{}
+	for s = strings.TrimSpace(s); s != ""; s = strings.TrimLeft(s, ", \t") {
+		k, rest, ok := strings.Cut(s, "=")
+		if !ok {
+			break
+		}
+		k = strings.ToLower(strings.TrimSpace(k))
+		rest = strings.TrimLeft(rest, " \t")
+
+		if strings.HasPrefix(rest, `"`) {
+			var v strings.Builder
+			i := 1
+			for ; i < len(rest) && rest[i] != '"'; i++ {
+				if rest[i] == '\\' && i+1 < len(rest) {
+					i++
+				}
+				v.WriteByte(rest[i])
+			}
+			m[k], s = v.String(), rest[min(i+1, len(rest)):]
+		} else {
+			v, next, _ := strings.Cut(rest, ",")
+			m[k], s = strings.TrimSpace(v), next
+		}
+	}
+	return m
+}
+
+func digestBase(algorithm string) string { return strings.TrimSuffix(algorithm, "-SESS") }
+
+func digestStrength(algorithm string) int {
+	switch digestBase(algorithm) {
+	case "SHA-512-256":
+		return 3
+	case "SHA-256":
+		return 2
+	}
+	return 1
+}
+
+func digestHash(algorithm string) func() hash.Hash {
+	switch digestBase(algorithm) {
+	case "MD5":
+		return md5.New
+	case "SHA-256":
+		return sha256.New
+	case "SHA-512-256":
+		return sha512.New512_256
+	}
+	return nil
+}
+
+// authorization computes the Authorization header value of the request.
+func (c *digestChallenge) authorization(cred *digestCred, req *fasthttp.Request, nc int, cnonce string) string {
+	newHash := digestHash(c.algorithm)
+	h := func(s string) string {
+		d := newHash()
+		d.Write([]byte(s))
+		return hex.EncodeToString(d.Sum(nil))
+	}
+
+	uri := string(req.URI().RequestURI())
+	ncValue := fmt.Sprintf("%08x", nc)
+
+	ha1 := h(cred.user + ":" + c.realm + ":" + cred.password)
+	if strings.HasSuffix(c.algorithm, "-SESS") {
+		ha1 = h(ha1 + ":" + c.nonce + ":" + cnonce)
+	}
+
+	ha2 := h(string(req.Header.Method()) + ":" + uri)
+	if c.qop == "auth-int" {
+		ha2 = h(string(req.Header.Method()) + ":" + uri + ":" + h(string(req.Body())))
+	}
+
+	response := h(ha1 + ":" + c.nonce + ":" + ha2)
+	if c.qop != "" {
+		response = h(ha1 + ":" + c.nonce + ":" + ncValue + ":" + cnonce + ":" + c.qop + ":" + ha2)
+	}
+
+	username := cred.user
+	if c.userhash {
+		username = h(cred.user + ":" + c.realm)
+	}
+
+	var b strings.Builder
+	b.WriteString(`Digest username=` + strconv.Quote(username) +
+		`, realm=` + strconv.Quote(c.realm) +
+		`, nonce=` + strconv.Quote(c.nonce) +
+		`, uri=` + strconv.Quote(uri) +
+		`, algorithm=` + c.algorithm +
+		`, response=` + strconv.Quote(response))
+	if c.opaque != "" {
+		b.WriteString(`, opaque=` + strconv.Quote(c.opaque))
+	}
+	if c.qop != "" {
+		b.WriteString(`, qop=` + c.qop + `, nc=` + ncValue + `, cnonce=` + strconv.Quote(cnonce))
+	}
+	if c.userhash {
+		b.WriteString(`, userhash=true`)
+	}
+	return b.String()
+}
@@ -0,0 +1,41 @@
+package blow
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/valyala/fasthttp"
+)
+
+func TestDigestAuthorization(t *testing.T) {
+	// the examples of RFC 7616 section 3.9.1
+	rsp := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseResponse(rsp)
+	rsp.SetStatusCode(fasthttp.StatusUnauthorized)
+	rsp.Header.Add("WWW-Authenticate", `Digest realm="http-auth@example.org", qop="auth, auth-int", algorithm=MD5, `+
+		`nonce="7ypf/xlj9XXwfDPEoM4URrv/xwf94BcCAzFZH4GiTo0v", opaque="FQhe/qaU925kfnzjCev0ciny7QMkPqMAFRtzCUYo5tdS"`)
+
+	c := parseDigestChallenge(rsp)
+	assert.Equal(t, "http-auth@example.org", c.realm)
+	assert.Equal(t, "auth", c.qop)
+	assert.Equal(t, "MD5", c.algorithm)
+
+	req := fasthttp.AcquireRequest()
+	defer fasthttp.ReleaseRequest(req)
+	req.SetRequestURI("http://www.example.org/dir/index.html")
+
+	cred := parseDigestCred("digest:Mufasa:Circle of Life")
+	cnonce := "f2/wE4q74E6zIJEtWaHKaf5wv/H5QzzpXusqGemxURZJ"
+	assert.Contains(t, c.authorization(cred, req, 1, cnonce), `response="8ca523f5e9506fed4657c9700eebdbec"`)
+
+	rsp.Header.Add("WWW-Authenticate", `Digest realm="http-auth@example.org", qop="auth, auth-int", algorithm=SHA-256, `+
+		`nonce="7ypf/xlj9XXwfDPEoM4URrv/xwf94BcCAzFZH4GiTo0v", opaque="FQhe/qaU925kfnzjCev0ciny7QMkPqMAFRtzCUYo5tdS"`)
+	c = parseDigestChallenge(rsp)
+	assert.Equal(t, "SHA-256", c.algorithm)
+	assert.Equal(t, `Digest username="Mufasa", realm="http-auth@example.org", `+
+		`nonce="7ypf/xlj9XXwfDPEoM4URrv/xwf94BcCAzFZH4GiTo0v", uri="/dir/index.html", algorithm=SHA-256, `+
+		`response="753927fa0e85d155564e2e272a28d1802ca10daf4496794697cf8db5856cb6c1", `+
+		`opaque="FQhe/qaU925kfnzjCev0ciny7QMkPqMAFRtzCUYo5tdS", qop=auth, nc=00000001, `+
+		`cnonce="f2/wE4q74E6zIJEtWaHKaf5wv/H5QzzpXusqGemxURZJ"`,
+		c.authorization(cred, req, 1, cnonce))
+}
@@ -0,0 +1,214 @@
+package blow
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const dnsLookupSubName = "dns lookup"
+
+// dnsOption is the DNS options of -resolve and the -dns.* flags.
+type dnsOption struct {
+	// resolve are the curl style host:port:ip[,ip] mappings.
+	resolve []string
+	// server is the address of the DNS server, like 8.8.8.8:53.
+	server string
+	// pick is how to pick the IP of the resolved records, round or rand.
+	pick string
+	// cache is the duration to cache the DNS records, 0 to resolve on every new connection.
+	cache string
+}
+
+func (o dnsOption) enabled() bool {
+	return len(o.resolve) > 0 || o.server != "" || o.cache != "" || o.pick != "round"
+}
+
+// dnsDialer resolves the host names by itself, instead of the internal resolving with cache of fasthttp.TCPDialer,
+// so that the hosts can be pinned to the IPs, and the DNS lookups are recorded as sub operations.
+type dnsDialer struct {
+	Dialer
+	pins     map[string][]string
+	resolver *net.Resolver
+	pick     string
+	cacheTTL time.Duration
+	index    uint32
+	subs     *subRecorder
+
+	cache map[string]*dnsEntry
+	mu    sync.Mutex
+}
+
+type dnsEntry struct {
+	ips      []string
+	resolved time.Time
+}
+
+// buildDialer creates the dialer of the connections, with the DNS options if any.
+func (o *Opt) buildDialer(subs *subRecorder) (Dialer, error) {
+	if !o.dns.enabled() && !o.phases {
+		return dialer, nil
+	}
+
+	d := &dnsDialer{Dialer: dialer, pick: o.dns.pick, cacheTTL: time.Minute, subs: subs, resolver: net.DefaultResolver}
+	if d.pick != "round" && d.pick != "rand" {
+		return nil, fmt.Errorf("unknown -dns.pick %s, should be round or rand", d.pick)
+	}
+	if o.dns.cache != "" {
+		var err error
+		if d.cacheTTL, err = time.ParseDuration(o.dns.cache); err != nil {
+			return nil, fmt.Errorf("invalid -dns.cache %s: %w", o.dns.cache, err)
+		}
+	}
+
+	var err error
+	if d.pins, err = parseResolve(o.dns.resolve); err != nil {
+		return nil, err
+	}
+
+	if server := o.dns.server; server != "" {
+		if _, _, err := net.SplitHostPort(server); err != nil {
+			server = net.JoinHostPort(server, "53")
+		}
+		d.resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				var nd net.Dialer
+				return nd.DialContext(ctx, network, server)
+			},
+		}
+	}
+
+	d.cache = map[string]*dnsEntry{}
+	return d, nil
+}
+
+// parseResolve parses the curl style --resolve like example.com:443:1.2.3.4,1.2.3.5 or example.com:*:[::1].
+func parseResolve(items []string) (map[string][]string, error) {
+	pins := map[string][]string{}
+	for _, item := range items {
+		parts := strings.SplitN(item, ":", 3)
+		if len(parts) != 3 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("invalid -resolve %s, should be like host:port:ip[,ip]", item)
+		}
+
+		key := strings.ToLower(parts[0]) + ":" + parts[1]
+		for _, ip := range splitComma(parts[2]) {
+			ip = strings.TrimSuffix(strings.TrimPrefix(ip, "["), "]")
+			if net.ParseIP(ip) == nil {
+				return nil, fmt.Errorf("invalid IP %s in -resolve %s", ip, item)
+			}
+			pins[key] = append(pins[key], ip)
+		}
+		if len(pins[key]) == 0 {
+			return nil, fmt.Errorf("no IPs in -resolve %s", item)
+		}
+	}
+	return pins, nil
+}
+
+func (d *dnsDialer) Dial(addr string) (net.Conn, error) {
+	return d.DialTimeout(addr, 0)
+}
+
+func (d *dnsDialer) DialTimeout(addr string, timeout time.Duration) (net.Conn, error) {
+	t1 := time.Now()
+	resolved, err := d.resolve(addr, timeout)
+	if err != nil {
+		return nil, err
+	}
+	lookup := time.Since(t1)
+
+	var conn net.Conn
+	if timeout == 0 {
+		conn, err = d.Dialer.Dial(resolved)
+	} else {
+		conn, err = d.Dialer.DialTimeout(resolved, timeout)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &lookupConn{Conn: conn, lookup: lookup}, nil
+}
+
+// lookupConn is the connection dialed by dnsDialer, which knows the DNS lookup latency for the -phases.
+type lookupConn struct {
+	net.Conn
+	lookup time.Duration
+}
+
+func (c *lookupConn) DNSLookup() time.Duration { return c.lookup }
+
+// resolve resolves the host of addr to an IP picked from the pinned IPs of -resolve, or the A/AAAA records.
+func (d *dnsDialer) resolve(addr string, timeout time.Duration) (string, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", err
+	}
+	if net.ParseIP(host) != nil {
+		return addr, nil
+	}
+
+	key := strings.ToLower(host)
+	ips := d.pins[key+":"+port]
+	if len(ips) == 0 {
+		ips = d.pins[key+":*"]
+	}
+	if len(ips) == 0 {
+		if ips, err = d.lookup(key, timeout); err != nil {
+			return "", err
+		}
+	}
+
+	return net.JoinHostPort(d.pickIP(ips), port), nil
+}
+
+// lookup looks up the IPs of the host, cached for -dns.cache.
+func (d *dnsDialer) lookup(host string, timeout time.Duration) ([]string, error) {
+	if d.cacheTTL > 0 {
+		d.mu.Lock()
+		e := d.cache[host]
+		d.mu.Unlock()
+		if e != nil && time.Since(e.resolved) < d.cacheTTL {
+			return e.ips, nil
+		}
+	}
+
+	ctx := context.Background()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	t1 := time.Now()
+	ips, err := d.resolver.LookupHost(ctx, host)
+	cost := time.Since(t1)
+	if err == nil && len(ips) == 0 {
+		err = fmt.Errorf("no such host %s", host)
+	}
+	if err != nil {
+		d.subs.record(dnsLookupSubName, "error", cost)
+		return nil, err
+	}
+	d.subs.record(dnsLookupSubName, "ok", cost)
+
+	if d.cacheTTL > 0 {
+		d.mu.Lock()
+		d.cache[host] = &dnsEntry{ips: ips, resolved: time.Now()}
+		d.mu.Unlock()
+	}
+	return ips, nil
+}
+
+func (d *dnsDialer) pickIP(ips []string) string {
+	if d.pick == "rand" {
+		return ips[rand.Intn(len(ips))]
+	}
+	return ips[int(atomic.AddUint32(&d.index, 1)-1)%len(ips)]
+}
@@ -0,0 +1,60 @@
+package blow
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseResolve(t *testing.T) {
+	pins, err := parseResolve([]string{"Example.com:443:1.2.3.4,1.2.3.5", "example.com:*:[::1]"})
+	assert.Nil(t, err)
+	assert.Equal(t, map[string][]string{
+		"example.com:443": {"1.2.3.4", "1.2.3.5"},
+		"example.com:*":   {"::1"},
+	}, pins)
+
+	for _, bad := range []string{"example.com:1.2.3.4", "example.com:443:a.b.c.d", "example.com:443:"} {
+		_, err = parseResolve([]string{bad})
+		assert.NotNil(t, err, bad)
+	}
+}
+
+func TestDNSDialerResolve(t *testing.T) {
+	subs := &subRecorder{}
+	opt := &Opt{dns: dnsOption{resolve: []string{"example.com:443:1.2.3.4,1.2.3.5", "example.com:*:::1"}, pick: "round"}}
+	d, err := opt.buildDialer(subs)
+	assert.Nil(t, err)
+
+	dd := d.(*dnsDialer)
+	for _, expected := range []string{"1.2.3.4:443", "1.2.3.5:443", "1.2.3.4:443"} {
+		addr, err := dd.resolve("example.com:443", time.Second)
+		assert.Nil(t, err)
+		assert.Equal(t, expected, addr)
+	}
+	addr, err := dd.resolve("example.com:80", time.Second)
+	assert.Nil(t, err)
+	assert.Equal(t, "[::1]:80", addr)
+	addr, err = dd.resolve("10.0.0.1:80", time.Second)
+	assert.Nil(t, err)
+	assert.Equal(t, "10.0.0.1:80", addr)
+	assert.Equal(t, 0, len(subs.subs))
+
+	// 不缓存时，每次新建连接都解析并记录 DNS 查询耗时
+	dd.cacheTTL = 0
+	for i := 0; i < 2; i++ {
+		addr, err = dd.resolve("localhost:80", time.Second)
+		assert.Nil(t, err)
+		host, _, _ := net.SplitHostPort(addr)
+		assert.True(t, net.ParseIP(host).IsLoopback())
+	}
+	assert.Equal(t, 2, len(subs.subs))
+	assert.Equal(t, dnsLookupSubName, subs.subs[0].Name)
+
+	opt = &Opt{dns: dnsOption{pick: "round"}}
+	d, err = opt.buildDialer(subs)
+	assert.Nil(t, err)
+	assert.Equal(t, dialer, d)
+}
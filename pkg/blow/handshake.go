@@ -0,0 +1,294 @@
+package blow
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"gitee.com/Trisia/gotlcp/tlcp"
+	"github.com/bingoohuang/berf"
+	"github.com/bingoohuang/berf/pkg/blow/internal"
+	"github.com/bingoohuang/gg/pkg/ss"
+	"github.com/valyala/fasthttp"
+)
+
+// pinTLS applies -tls.version, -tls.ciphers and -tls.curves to the TLS config.
+func (o *Opt) pinTLS(t *tls.Config) error {
+	if o.tlsVersion != "" {
+		minV, maxV, _ := strings.Cut(o.tlsVersion, "-")
+		if maxV == "" {
+			maxV = minV
+		}
+		var err error
+		if t.MinVersion, err = parseTLSVersion(minV); err != nil {
+			return err
+		}
+		if t.MaxVersion, err = parseTLSVersion(maxV); err != nil {
+			return err
+		}
+	}
+
+	if o.tlsCiphers != "" && !o.useTLCP() {
+		suites := map[string]uint16{}
+		for _, s := range append(tls.CipherSuites(), tls.InsecureCipherSuites()...) {
+			suites[s.Name] = s.ID
+		}
+		for _, name := range splitComma(o.tlsCiphers) {
+			id, ok := suites[strings.ToUpper(name)]
+			if !ok {
+				return fmt.Errorf("unknown TLS cipher suite %s", name)
+			}
+			t.CipherSuites = append(t.CipherSuites, id)
+		}
+	}
+
+	for _, name := range splitComma(o.tlsCurves) {
+		switch strings.ToUpper(strings.ReplaceAll(name, "-", "")) {
+		case "X25519":
+			t.CurvePreferences = append(t.CurvePreferences, tls.X25519)
+		case "P256", "SECP256R1":
+			t.CurvePreferences = append(t.CurvePreferences, tls.CurveP256)
+		case "P384", "SECP384R1":
+			t.CurvePreferences = append(t.CurvePreferences, tls.CurveP384)
+		case "P521", "SECP521R1":
+			t.CurvePreferences = append(t.CurvePreferences, tls.CurveP521)
+		default:
+			return fmt.Errorf("unknown TLS curve %s, should be one of X25519, P256, P384, P521", name)
+		}
+	}
+
+	return nil
+}
+
+func parseTLSVersion(s string) (uint16, error) {
+	switch strings.TrimPrefix(strings.ToLower(strings.TrimSpace(s)), "tls") {
+	case "1.0", "10":
+		return tls.VersionTLS10, nil
+	case "1.1", "11":
+		return tls.VersionTLS11, nil
+	case "1.2", "12":
+		return tls.VersionTLS12, nil
+	case "1.3", "13":
+		return tls.VersionTLS13, nil
+	}
+	return 0, fmt.Errorf("unknown TLS version %s, should be one of 1.0, 1.1, 1.2, 1.3", s)
+}
+
+func parseTLCPCiphers(s string) ([]uint16, error) {
+	suites := map[string]uint16{}
+	for _, c := range append(tlcp.CipherSuites(), tlcp.InsecureCipherSuites()...) {
+		suites[c.Name] = c.ID
+	}
+
+	var ids []uint16
+	for _, name := range splitComma(s) {
+		id, ok := suites[strings.ToUpper(name)]
+		if !ok {
+			return nil, fmt.Errorf("unknown TLCP cipher suite %s", name)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func splitComma(s string) []string {
+	return ss.Split(s, ss.WithSeps(","), ss.WithIgnoreEmpty(true), ss.WithTrimSpace(true))
+}
+
+// handshakeBench benchmarks the TLS (or TLCP) handshakes, every invocation dials a new connection
+// and does a full or resumed handshake, the TCP connecting is not counted in the handshake latency.
+type handshakeBench struct {
+	opt        *Opt
+	dial       fasthttp.DialFunc
+	mode       string
+	addr       string
+	serverName string
+	useTLCP    bool
+	pins       map[string]bool
+	// subs are the proxy tunnels of -proxy.
+	subs *subRecorder
+
+	full, resumed, resumable, hits int64
+}
+
+// handshakeVU is the state of a virtual user of the handshake benchmarking, with its own session cache.
+type handshakeVU struct {
+	tlsConfig  *tls.Config
+	tlcpConfig *tlcp.Config
+	handshakes int
+}
+
+const handshakeVUKey = "handshake"
+
+func (r *Invoker) newHandshakeBench(opt *Opt) (*handshakeBench, error) {
+	b := &handshakeBench{opt: opt, mode: opt.tlsBench, useTLCP: opt.useTLCP(), subs: &r.dialSubs}
+	switch {
+	case b.mode != "full" && b.mode != "ticket" && b.mode != "id":
+		return nil, fmt.Errorf("unknown -tls.bench %s, should be one of full, ticket, id", b.mode)
+	case b.mode == "id" && !b.useTLCP:
+		return nil, fmt.Errorf("crypto/tls client resumes sessions by tickets only, use -tls.bench ticket, or env TLCP=1 for session IDs")
+	case b.mode == "ticket" && b.useTLCP:
+		return nil, fmt.Errorf("TLCP resumes sessions by session IDs only, use -tls.bench id")
+	case len(opt.parsedUrls) == 0:
+		return nil, fmt.Errorf("-tls.bench requires an https URL")
+	}
+
+	u := opt.parsedUrls[0]
+	if u.Scheme != "https" && !b.useTLCP {
+		return nil, fmt.Errorf("-tls.bench requires an https URL, got %s", u)
+	}
+	b.serverName, b.addr = u.Hostname(), u.Host
+	if u.Port() == "" {
+		b.addr = net.JoinHostPort(u.Hostname(), "443")
+	}
+
+	var err error
+	if b.pins, err = parseTLCPPins(opt.tlcp.pin); err != nil {
+		return nil, err
+	}
+
+	dial := ProxyHTTPDialerTimeout(opt.dialTimeout, r.dialer, true)
+	if r.proxies != nil {
+		dial = r.proxies.dialer(nil, r.dialer, opt.dialTimeout)
+	}
+	wrap, err := internal.NetworkWrap(opt.network)
+	if err != nil {
+		return nil, err
+	}
+	b.dial = internal.ThroughputStatDial(wrap, dial, &r.readBytes, &r.writeBytes)
+
+	// 提前检查 TLS 配置是否有效
+	if _, err := b.newVU(); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func (b *handshakeBench) newVU() (*handshakeVU, error) {
+	vu := &handshakeVU{}
+	if b.useTLCP {
+		c, err := b.opt.buildTLCPConfig(b.serverName)
+		if err != nil {
+			return nil, err
+		}
+		c.SessionCache = nil
+		if b.mode == "id" {
+			c.SessionCache = tlcp.NewLRUSessionCache(1)
+		}
+		vu.tlcpConfig = c
+		return vu, nil
+	}
+
+	c, err := b.opt.buildTLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	c.ServerName = b.serverName
+	c.ClientSessionCache = nil
+	c.SessionTicketsDisabled = b.mode == "full"
+	if b.mode == "ticket" {
+		c.ClientSessionCache = tls.NewLRUClientSessionCache(1)
+	}
+	vu.tlsConfig = c
+	return vu, nil
+}
+
+func (b *handshakeBench) run(ctx context.Context) (*berf.Result, error) {
+	var hv *handshakeVU
+	if vu := berf.GetVirtualUser(ctx); vu != nil {
+		hv = vu.Value(handshakeVUKey, func() interface{} { v, _ := b.newVU(); return v }).(*handshakeVU)
+	} else {
+		hv, _ = b.newVU()
+	}
+
+	raw, err := b.dial(b.addr)
+	if err != nil {
+		return nil, err
+	}
+	defer raw.Close()
+
+	var negotiated string
+	var resumed bool
+	t1 := time.Now()
+	if hv.tlcpConfig != nil {
+		conn := tlcp.Client(raw, hv.tlcpConfig)
+		if err := conn.HandshakeContext(ctx); err != nil {
+			return nil, err
+		}
+		state := conn.ConnectionState()
+		if err := checkTLCPPin(b.pins, state); err != nil {
+			return nil, err
+		}
+		negotiated, resumed = "TLCP "+tlcpCipherSuiteName(state.CipherSuite), state.DidResume
+	} else {
+		conn := tls.Client(raw, hv.tlsConfig)
+		if err := conn.HandshakeContext(ctx); err != nil {
+			return nil, err
+		}
+		state := conn.ConnectionState()
+		negotiated = tls.VersionName(state.Version) + " " + tls.CipherSuiteName(state.CipherSuite)
+		if state.NegotiatedProtocol != "" {
+			negotiated += " " + state.NegotiatedProtocol
+		}
+		resumed = state.DidResume
+
+		if b.mode == "ticket" && state.Version == tls.VersionTLS13 {
+			// TLS 1.3 的会话票据在握手之后发送，需要读取才能被缓存
+			defer readSessionTickets(conn, b.serverName)
+		}
+	}
+	cost := time.Since(t1)
+
+	if hv.handshakes > 0 && b.mode != "full" {
+		atomic.AddInt64(&b.resumable, 1)
+		if resumed {
+			atomic.AddInt64(&b.hits, 1)
+		}
+	}
+	hv.handshakes++
+
+	kind := "full"
+	if resumed {
+		kind = "resumed"
+		atomic.AddInt64(&b.resumed, 1)
+	} else {
+		atomic.AddInt64(&b.full, 1)
+	}
+
+	rr := &berf.Result{Cost: cost, Status: []string{kind}}
+	rr.AddSub(kind+" handshake", negotiated, cost)
+	b.subs.drain(rr)
+	return rr, nil
+}
+
+// readSessionTickets sends a HEAD request and reads the response, so that the TLS 1.3 session tickets are received.
+func readSessionTickets(conn *tls.Conn, host string) {
+	_ = conn.SetDeadline(time.Now().Add(time.Second))
+	if _, err := io.WriteString(conn, "HEAD / HTTP/1.1\r\nHost: "+host+"\r\nConnection: close\r\n\r\n"); err == nil {
+		_, _ = conn.Read(make([]byte, 512))
+	}
+}
+
+func tlcpCipherSuiteName(id uint16) string {
+	for _, c := range append(tlcp.CipherSuites(), tlcp.InsecureCipherSuites()...) {
+		if c.ID == id {
+			return c.Name
+		}
+	}
+	return fmt.Sprintf("0x%04X", id)
+}
+
+// report prints the handshake counters and the resumption hit ratio.
+func (b *handshakeBench) report(w io.Writer) {
+	full, resumed := atomic.LoadInt64(&b.full), atomic.LoadInt64(&b.resumed)
+	_, _ = fmt.Fprintf(w, "\nTLS handshakes: full %d, resumed %d", full, resumed)
+	if resumable := atomic.LoadInt64(&b.resumable); resumable > 0 {
+		_, _ = fmt.Fprintf(w, ", resumption hit ratio %.2f%% (%d/%d)", float64(b.hits)*100/float64(resumable), b.hits, resumable)
+	}
+	_, _ = fmt.Fprintln(w)
+}
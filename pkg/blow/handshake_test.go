@@ -0,0 +1,53 @@
+package blow
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bingoohuang/berf"
+	"github.com/stretchr/testify/assert"
+	"github.com/valyala/fasthttp"
+)
+
+func TestHandshakeBench(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	defer ts.Close()
+
+	addr := strings.TrimPrefix(ts.URL, "https://")
+	ctx := berf.WithVirtualUser(context.Background(), &berf.VirtualUser{Values: map[string]interface{}{}})
+
+	b := &handshakeBench{opt: &Opt{}, mode: "ticket", addr: addr, serverName: "127.0.0.1", dial: fasthttp.Dial, subs: &subRecorder{}}
+	for _, expected := range []string{"full", "resumed", "resumed"} {
+		rr, err := b.run(ctx)
+		assert.Nil(t, err)
+		assert.Equal(t, []string{expected}, rr.Status)
+		assert.Equal(t, "TLS 1.3 TLS_AES_128_GCM_SHA256", rr.Subs[0].Status)
+	}
+	assert.Equal(t, int64(2), b.hits)
+	assert.Equal(t, int64(2), b.resumable)
+
+	ctx = berf.WithVirtualUser(context.Background(), &berf.VirtualUser{Values: map[string]interface{}{}})
+	b = &handshakeBench{opt: &Opt{tlsVersion: "1.2"}, mode: "full", addr: addr, serverName: "127.0.0.1", dial: fasthttp.Dial, subs: &subRecorder{}}
+	for i := 0; i < 2; i++ {
+		rr, err := b.run(ctx)
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"full"}, rr.Status)
+		assert.True(t, strings.HasPrefix(rr.Subs[0].Status, "TLS 1.2 "))
+	}
+}
+
+func TestPinTLS(t *testing.T) {
+	c := &tls.Config{}
+	o := &Opt{tlsVersion: "1.0-1.2", tlsCiphers: "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256", tlsCurves: "X25519,P-256"}
+	assert.Nil(t, o.pinTLS(c))
+	assert.Equal(t, uint16(tls.VersionTLS10), c.MinVersion)
+	assert.Equal(t, uint16(tls.VersionTLS12), c.MaxVersion)
+	assert.Equal(t, []uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256}, c.CipherSuites)
+	assert.Equal(t, []tls.CurveID{tls.X25519, tls.CurveP256}, c.CurvePreferences)
+
+	assert.NotNil(t, (&Opt{tlsCurves: "P999"}).pinTLS(&tls.Config{}))
+}
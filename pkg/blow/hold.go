@@ -0,0 +1,277 @@
+package blow
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	holdConnectSubName   = "hold connect"
+	holdKeepaliveSubName = "hold keepalive"
+	holdDropSubName      = "hold drop"
+)
+
+// holdOption is the connection-holding options of the -hold.* flags.
+type holdOption struct {
+	// n is the number of the connections to open and hold.
+	n int
+	// keepalive is the interval to send a keep-alive request on each held connection, 0 to keep them idle.
+	keepalive time.Duration
+	// report is the interval to sample the held connections for the timeline in the final report.
+	report time.Duration
+}
+
+// holder opens and holds the connections of -hold alongside the request workload, for the C10K/C100K capacity tests,
+// the connections are spread across the LOCAL_IP source addresses by the dialer to avoid the port exhaustion.
+type holder struct {
+	opt     holdOption
+	addr    string
+	request []byte
+	dial    fasthttp.DialFunc
+	subs    *subRecorder
+
+	established, failed, dropped, holding, peak int64
+
+	cancel   context.CancelFunc
+	stopped  int32
+	started  time.Time
+	conns    map[net.Conn]struct{}
+	timeline []holdPoint
+	mu       sync.Mutex
+	wg       sync.WaitGroup
+}
+
+// holdPoint is a sample of the held connections at the elapsed time.
+type holdPoint struct {
+	elapsed                                     time.Duration
+	holding, established, failed, dropped, peak int64
+}
+
+// holdDialers is the max number of the concurrent dialings, the rate can be limited further by -conn.rate.
+const holdDialers = 256
+
+func newHolder(opt *Opt, dial fasthttp.DialFunc, subs *subRecorder) (*holder, error) {
+	if len(opt.parsedUrls) == 0 {
+		return nil, fmt.Errorf("-hold requires an URL")
+	}
+	if opt.hold.report <= 0 {
+		return nil, fmt.Errorf("invalid -hold.report %s", opt.hold.report)
+	}
+
+	u := opt.parsedUrls[0]
+	h := &holder{opt: opt.hold, addr: urlAddr(u), dial: dial, subs: subs, conns: map[net.Conn]struct{}{}}
+	h.request = []byte("GET " + u.RequestURI() + " HTTP/1.1\r\nHost: " + u.Host + "\r\nUser-Agent: blow\r\n\r\n")
+	return h, nil
+}
+
+// urlAddr returns the host:port of the URL, with the default port of the scheme.
+func urlAddr(u *url.URL) string {
+	if u.Port() != "" {
+		return u.Host
+	}
+	if u.Scheme == "https" {
+		return net.JoinHostPort(u.Hostname(), "443")
+	}
+	return net.JoinHostPort(u.Hostname(), "80")
+}
+
+// start opens the connections in the background, and holds them until stop.
+func (h *holder) start(ctx context.Context) {
+	ctx, h.cancel = context.WithCancel(ctx)
+	h.started = time.Now()
+
+	var next int64
+	for i := 0; i < min(h.opt.n, holdDialers); i++ {
+		h.wg.Add(1)
+		go func() {
+			defer h.wg.Done()
+			for ctx.Err() == nil && atomic.AddInt64(&next, 1) <= int64(h.opt.n) {
+				h.open(ctx)
+			}
+		}()
+	}
+
+	go h.sample(ctx)
+}
+
+func (h *holder) open(ctx context.Context) {
+	t1 := time.Now()
+	conn, err := h.dial(h.addr)
+	cost := time.Since(t1)
+	if err != nil {
+		if ctx.Err() == nil {
+			atomic.AddInt64(&h.failed, 1)
+			h.subs.record(holdConnectSubName, "error", cost)
+		}
+		return
+	}
+
+	h.mu.Lock()
+	if atomic.LoadInt32(&h.stopped) == 1 {
+		h.mu.Unlock()
+		_ = conn.Close()
+		return
+	}
+	h.conns[conn] = struct{}{}
+	h.mu.Unlock()
+
+	atomic.AddInt64(&h.established, 1)
+	h.subs.record(holdConnectSubName, "ok", cost)
+	atomicMax(&h.peak, atomic.AddInt64(&h.holding, 1))
+
+	h.wg.Add(1)
+	go h.hold(conn)
+}
+
+// hold holds the connection, until it is dropped by the peer or the holder stopped.
+// It waits the data from the peer until the next keep-alive, so that the dropping is detected at once.
+func (h *holder) hold(conn net.Conn) {
+	defer h.wg.Done()
+	t1 := time.Now()
+	br := bufio.NewReaderSize(conn, 1024)
+
+	err := func() error {
+		for {
+			var deadline time.Time
+			if h.opt.keepalive > 0 {
+				deadline = time.Now().Add(h.opt.keepalive)
+			}
+			if err := conn.SetReadDeadline(deadline); err != nil {
+				return err
+			}
+			if _, err := br.Peek(1); err == nil {
+				// 未请求而收到的数据，丢弃即可
+				_, _ = br.Discard(br.Buffered())
+				continue
+			} else if !isTimeout(err) {
+				return err
+			}
+
+			if err := h.keepalive(conn, br); err != nil {
+				return err
+			}
+		}
+	}()
+
+	h.mu.Lock()
+	delete(h.conns, conn)
+	h.mu.Unlock()
+	_ = conn.Close()
+
+	atomic.AddInt64(&h.holding, -1)
+	if atomic.LoadInt32(&h.stopped) == 0 {
+		atomic.AddInt64(&h.dropped, 1)
+		h.subs.record(holdDropSubName, dropStatus(err), time.Since(t1))
+	}
+}
+
+// keepalive sends a keep-alive request on the connection, and reads its response.
+func (h *holder) keepalive(conn net.Conn, br *bufio.Reader) error {
+	t1 := time.Now()
+	_ = conn.SetDeadline(t1.Add(h.opt.keepalive))
+	defer conn.SetWriteDeadline(time.Time{})
+
+	rsp := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseResponse(rsp)
+
+	_, err := conn.Write(h.request)
+	if err == nil {
+		err = rsp.Read(br)
+	}
+	if err != nil {
+		if atomic.LoadInt32(&h.stopped) == 0 {
+			h.subs.record(holdKeepaliveSubName, "error", time.Since(t1))
+		}
+		return err
+	}
+
+	h.subs.record(holdKeepaliveSubName, strconv.Itoa(rsp.StatusCode()), time.Since(t1))
+	if rsp.ConnectionClose() {
+		return io.EOF
+	}
+	return nil
+}
+
+// isTimeout tells the error is a timeout, like the net.Error or fasthttp.ErrTimeout which implements Timeout only.
+func isTimeout(err error) bool {
+	var te interface{ Timeout() bool }
+	return errors.As(err, &te) && te.Timeout()
+}
+
+func dropStatus(err error) string {
+	switch {
+	case errors.Is(err, io.EOF):
+		return "eof"
+	case errors.Is(err, syscall.ECONNRESET):
+		return "reset"
+	case isTimeout(err):
+		return "timeout"
+	default:
+		return "error"
+	}
+}
+
+// sample samples the held connections every -hold.report for the timeline.
+func (h *holder) sample(ctx context.Context) {
+	ticker := time.NewTicker(h.opt.report)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			h.mu.Lock()
+			h.timeline = append(h.timeline, h.point())
+			h.mu.Unlock()
+		}
+	}
+}
+
+func (h *holder) point() holdPoint {
+	return holdPoint{
+		elapsed:     time.Since(h.started).Round(time.Second),
+		holding:     atomic.LoadInt64(&h.holding),
+		established: atomic.LoadInt64(&h.established),
+		failed:      atomic.LoadInt64(&h.failed),
+		dropped:     atomic.LoadInt64(&h.dropped),
+		peak:        atomic.LoadInt64(&h.peak),
+	}
+}
+
+// stop closes all the held connections.
+func (h *holder) stop() {
+	h.mu.Lock()
+	atomic.StoreInt32(&h.stopped, 1)
+	h.timeline = append(h.timeline, h.point())
+	for conn := range h.conns {
+		_ = conn.Close()
+	}
+	h.mu.Unlock()
+
+	h.cancel()
+	h.wg.Wait()
+}
+
+// report prints the timeline of the held connections.
+func (h *holder) report(w io.Writer) {
+	last := h.timeline[len(h.timeline)-1]
+	_, _ = fmt.Fprintf(w, "\nHeld connections: target %d, established %d, failed %d, dropped by peer %d, holding %d, peak %d\n",
+		h.opt.n, last.established, last.failed, last.dropped, last.holding, last.peak)
+	_, _ = fmt.Fprintf(w, "%10s %10s %12s %10s %10s\n", "Elapsed", "Holding", "Established", "Failed", "Dropped")
+	for _, p := range h.timeline {
+		_, _ = fmt.Fprintf(w, "%10s %10d %12d %10d %10d\n", p.elapsed, p.holding, p.established, p.failed, p.dropped)
+	}
+}
@@ -0,0 +1,45 @@
+package blow
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/bingoohuang/berf"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHolder(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	u, _ := url.Parse(ts.URL + "/ping")
+	opt := &Opt{parsedUrls: []*url.URL{u}, hold: holdOption{n: 5, keepalive: 50 * time.Millisecond, report: time.Hour}}
+	subs := &subRecorder{}
+	h, err := newHolder(opt, ProxyHTTPDialerTimeout(0, dialer, false), subs)
+	assert.Nil(t, err)
+
+	h.start(context.Background())
+	assert.Eventually(t, func() bool { return h.point().holding == 5 }, time.Second, 10*time.Millisecond)
+	time.Sleep(120 * time.Millisecond)
+
+	ts.CloseClientConnections()
+	assert.Eventually(t, func() bool { return h.point().dropped == 5 }, time.Second, 10*time.Millisecond)
+	h.stop()
+
+	last := h.timeline[len(h.timeline)-1]
+	assert.Equal(t, holdPoint{elapsed: last.elapsed, established: 5, dropped: 5, peak: 5}, last)
+
+	rr := &berf.Result{}
+	subs.drain(rr)
+	statuses := map[string]int{}
+	for _, sub := range rr.Subs {
+		statuses[sub.Name+" "+sub.Status]++
+	}
+	assert.Equal(t, 5, statuses[holdConnectSubName+" ok"])
+	assert.Equal(t, 5, statuses[holdDropSubName+" eof"])
+	assert.GreaterOrEqual(t, statuses[holdKeepaliveSubName+" 200"], 5)
+}
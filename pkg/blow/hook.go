@@ -0,0 +1,112 @@
+package blow
+
+import (
+	"context"
+	"errors"
+
+	"github.com/bingoohuang/berf/pkg/blow/script"
+	"github.com/valyala/fasthttp"
+)
+
+// errScriptFailed tells the request is marked as failed by fail() in the scripts.
+var errScriptFailed = errors.New("failed by script")
+
+// scriptRuntime gets the script runtime of the virtual user, created on first use.
+func (s *vuState) scriptRuntime() *script.Runtime {
+	if s.script == nil {
+		s.script = script.NewRuntime(s.vars)
+	}
+	return s.script
+}
+
+// preHooks runs the pre-request scripts and applies their changes to req.
+func (r *Invoker) preHooks(ctx context.Context, req *fasthttp.Request, scripts ...*script.Script) (failed string, err error) {
+	var rt *script.Runtime
+	for _, s := range scripts {
+		if s == nil {
+			continue
+		}
+		if rt == nil {
+			rt = r.vuState(ctx).scriptRuntime()
+		}
+
+		sr := scriptRequest(req)
+		if failed, err = rt.Pre(s, sr); err != nil || failed != "" {
+			return failed, err
+		}
+		applyScriptRequest(req, sr)
+	}
+
+	return "", nil
+}
+
+// postHooks runs the post-response scripts.
+func (r *Invoker) postHooks(ctx context.Context, req *fasthttp.Request, rsp *fasthttp.Response, scripts ...*script.Script) (failed string, err error) {
+	var rt *script.Runtime
+	var sr *script.Request
+	var sp *script.Response
+	for _, s := range scripts {
+		if s == nil {
+			continue
+		}
+		if rt == nil {
+			rt, sr, sp = r.vuState(ctx).scriptRuntime(), scriptRequest(req), scriptResponse(rsp)
+		}
+
+		if failed, err = rt.Post(s, sr, sp); err != nil || failed != "" {
+			return failed, err
+		}
+	}
+
+	return "", nil
+}
+
+func scriptRequest(req *fasthttp.Request) *script.Request {
+	sr := &script.Request{
+		Method:  string(req.Header.Method()),
+		URL:     string(req.URI().FullURI()),
+		Headers: map[string]string{},
+	}
+	if !req.IsBodyStream() {
+		sr.Body = string(req.Body())
+	}
+	req.Header.VisitAll(func(k, v []byte) {
+		sr.Headers[string(k)] = string(v)
+	})
+	return sr
+}
+
+// applyScriptRequest writes the changes of the pre-request script back to req.
+func applyScriptRequest(req *fasthttp.Request, sr *script.Request) {
+	old := scriptRequest(req)
+	if sr.Method != old.Method {
+		req.Header.SetMethod(sr.Method)
+	}
+	if sr.URL != old.URL {
+		req.SetRequestURI(sr.URL)
+	}
+	for k := range old.Headers {
+		if _, ok := sr.Headers[k]; !ok {
+			req.Header.Del(k)
+		}
+	}
+	for k, v := range sr.Headers {
+		if old.Headers[k] != v {
+			req.Header.Set(k, v)
+		}
+	}
+	if !req.IsBodyStream() && sr.Body != old.Body {
+		req.SetBodyString(sr.Body)
+	}
+}
+
+func scriptResponse(rsp *fasthttp.Response) *script.Response {
+	sp := &script.Response{Status: rsp.StatusCode(), Headers: map[string]string{}}
+	if body, err := rsp.BodyUncompressed(); err == nil {
+		sp.Body = string(body)
+	}
+	rsp.Header.VisitAll(func(k, v []byte) {
+		sp.Headers[string(k)] = string(v)
+	})
+	return sp
+}
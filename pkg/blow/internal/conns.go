@@ -0,0 +1,43 @@
+package internal
+
+import (
+	"net"
+	"sync/atomic"
+)
+
+// ConnStats is the lifecycle counters of the connections.
+type ConnStats struct {
+	// Opened and Closed are the numbers of the connections dialed and closed,
+	// ServerClosed is the number of the connections found closed by the server, like the idle timeout of keep-alive.
+	Opened, Closed, ServerClosed int64
+	// Fresh and Reused are the numbers of the requests sent on new connections and on reused keep-alive ones.
+	Fresh, Reused int64
+}
+
+var connStats ConnStats
+
+// GetConnStats returns the lifecycle counters of the connections.
+func GetConnStats() ConnStats {
+	return ConnStats{
+		Opened:       atomic.LoadInt64(&connStats.Opened),
+		Closed:       atomic.LoadInt64(&connStats.Closed),
+		ServerClosed: atomic.LoadInt64(&connStats.ServerClosed),
+		Fresh:        atomic.LoadInt64(&connStats.Fresh),
+		Reused:       atomic.LoadInt64(&connStats.Reused),
+	}
+}
+
+// CountRequest counts the request as fresh or reused by the trace of its connection found by the local address,
+// it is called once per completed request, so the TLS handshake messages are never taken as a request.
+// The connection may already serve the request of another goroutine, so the trace is counted atomically.
+func CountRequest(addr net.Addr) {
+	t := GetConnTrace(addr)
+	if t == nil {
+		return
+	}
+	if atomic.AddInt32(&t.counted, 1) == 1 {
+		atomic.AddInt64(&connStats.Fresh, 1)
+	} else {
+		atomic.AddInt64(&connStats.Reused, 1)
+	}
+}
@@ -0,0 +1,365 @@
+package internal
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"net/textproto"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/bingoohuang/gg/pkg/ss"
+)
+
+// IsCurlProfile tells the profile content is curl command lines, like copied from browser devtools.
+func IsCurlProfile(data []byte) bool {
+	for _, l := range strings.Split(string(data), "\n") {
+		if l = strings.TrimSpace(l); l == "" || strings.HasPrefix(l, "#") {
+			continue
+		}
+		return l == "curl" || strings.HasPrefix(l, "curl ")
+	}
+	return false
+}
+
+// ParseCurlProfiles parses the curl command lines to profiles,
+// the comments before a curl command are kept as the profile's comments, like # [tag=1 eval].
+func ParseCurlProfiles(r io.Reader) ([]*Profile, error) {
+	var profiles []*Profile
+	var comments []string
+	var cmd strings.Builder
+
+	flush := func() error {
+		line := strings.TrimSpace(cmd.String())
+		cmd.Reset()
+		if line == "" {
+			return nil
+		}
+
+		p, err := ParseCurl(line)
+		if err != nil {
+			return err
+		}
+		p.Comments = append(comments, p.Comments...)
+		comments = nil
+		profiles = append(profiles, p)
+		return nil
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+	for scanner.Scan() {
+		l := strings.TrimSpace(scanner.Text())
+		if cmd.Len() == 0 {
+			if l == "" {
+				continue
+			}
+			if strings.HasPrefix(l, "#") {
+				comments = append(comments, l)
+				continue
+			}
+		}
+
+		// 续行符，例如 devtools 复制出来的多行 curl 命令
+		if strings.HasSuffix(l, `\`) {
+			cmd.WriteString(strings.TrimSuffix(l, `\`))
+			cmd.WriteString(" ")
+			continue
+		}
+
+		cmd.WriteString(l)
+		if err := flush(); err != nil {
+			return nil, err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+
+	if err := postProcessProfiles(profiles); err != nil {
+		return nil, err
+	}
+	return profiles, nil
+}
+
+// curl 中不影响请求本身的无参数选项
+var curlIgnoredFlags = map[string]bool{
+	"-s": true, "--silent": true, "-S": true, "--show-error": true, "-v": true, "--verbose": true,
+	"-i": true, "--include": true, "-L": true, "--location": true, "--compressed": true,
+	"--http1.1": true, "--http2": true, "-N": true, "--no-buffer": true, "-f": true, "--fail": true,
+}
+
+// curl 中不影响请求本身的带参数选项
+var curlIgnoredArgFlags = map[string]bool{
+	"-o": true, "--output": true, "-m": true, "--max-time": true, "--connect-timeout": true,
+	"-w": true, "--write-out": true, "--retry": true,
+}
+
+// ParseCurl parses a curl command line to a profile,
+// supports -X, -H, -d/--data/--data-raw/--data-binary/--data-urlencode (@file), -F (@file, <file), -u, --digest, -k, -G, -I, -A, -b, -e.
+func ParseCurl(line string) (*Profile, error) {
+	args, err := splitShellWords(line)
+	if err != nil {
+		return nil, fmt.Errorf("parse curl %s: %w", line, err)
+	}
+	if len(args) == 0 || args[0] != "curl" {
+		return nil, fmt.Errorf("not a curl command: %s", line)
+	}
+
+	p := &Profile{
+		Header:  map[string]string{},
+		Query:   map[string]string{},
+		Form:    map[string]string{},
+		Files:   map[string]string{},
+		RawJSON: map[string]string{},
+		EnvVars: EnvVars{},
+	}
+
+	var data []string
+	var get, digest, insecure bool
+	for i := 1; i < len(args); i++ {
+		arg := args[i]
+		name, value, hasValue := arg, "", false
+		if strings.HasPrefix(arg, "--") {
+			name, value, hasValue = strings.Cut(arg, "=")
+		} else if len(arg) > 2 && arg[0] == '-' && strings.ContainsRune("XHdFuAbe", rune(arg[1])) {
+			name, value, hasValue = arg[:2], arg[2:], true // -XPOST
+		}
+
+		nextValue := func() (string, error) {
+			if hasValue {
+				return value, nil
+			}
+			if i+1 >= len(args) {
+				return "", fmt.Errorf("curl option %s requires a value", name)
+			}
+			i++
+			return args[i], nil
+		}
+
+		switch {
+		case !strings.HasPrefix(name, "-"):
+			p.URL = arg
+		case name == "--url":
+			if p.URL, err = nextValue(); err != nil {
+				return nil, err
+			}
+		case name == "-X" || name == "--request":
+			if p.Method, err = nextValue(); err != nil {
+				return nil, err
+			}
+			p.Method = strings.ToUpper(p.Method)
+		case name == "-H" || name == "--header":
+			v, err := nextValue()
+			if err != nil {
+				return nil, err
+			}
+			if k, hv, ok := strings.Cut(v, ":"); ok {
+				p.Header[textproto.CanonicalMIMEHeaderKey(strings.TrimSpace(k))] = strings.TrimSpace(hv)
+			}
+		case name == "-A" || name == "--user-agent":
+			if p.Header["User-Agent"], err = nextValue(); err != nil {
+				return nil, err
+			}
+		case name == "-b" || name == "--cookie":
+			if p.Header["Cookie"], err = nextValue(); err != nil {
+				return nil, err
+			}
+		case name == "-e" || name == "--referer":
+			if p.Header["Referer"], err = nextValue(); err != nil {
+				return nil, err
+			}
+		case name == "-u" || name == "--user":
+			// 由 createHeader 转换为 Authorization: Basic base64(user:pass)
+			if p.Header["Basic"], err = nextValue(); err != nil {
+				return nil, err
+			}
+		case name == "-d" || name == "--data" || name == "--data-raw" || name == "--data-ascii" ||
+			name == "--data-binary" || name == "--data-urlencode":
+			v, err := nextValue()
+			if err != nil {
+				return nil, err
+			}
+			if name == "--data-urlencode" {
+				if k, dv, ok := strings.Cut(v, "="); ok {
+					v = k + "=" + url.QueryEscape(dv)
+				} else {
+					v = url.QueryEscape(v)
+				}
+			}
+			data = append(data, v)
+		case name == "-F" || name == "--form":
+			v, err := nextValue()
+			if err != nil {
+				return nil, err
+			}
+			if k, fv, ok := strings.Cut(v, "="); ok {
+				switch {
+				case strings.HasPrefix(fv, "@"): // -F name=@file 上传文件
+					p.Files[k] = fv[1:]
+				case strings.HasPrefix(fv, "<"): // -F name=<file 读取文件内容作为文本字段值，而不是上传文件
+					data, err := os.ReadFile(fv[1:])
+					if err != nil {
+						return nil, fmt.Errorf("curl option %s %s: %w", name, v, err)
+					}
+					p.Form[k] = string(data)
+				default:
+					p.Form[k] = fv
+				}
+			}
+		case name == "-G" || name == "--get":
+			get = true
+		case name == "--digest":
+			digest = true
+		case name == "-I" || name == "--head":
+			p.Method = "HEAD"
+		case name == "-k" || name == "--insecure":
+			insecure = true
+		case curlIgnoredFlags[name]:
+		case curlIgnoredArgFlags[name]:
+			if _, err := nextValue(); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("unsupported curl option %s", arg)
+		}
+	}
+
+	if p.URL == "" {
+		return nil, fmt.Errorf("no URL found in curl: %s", line)
+	}
+	if digest && p.Header["Basic"] != "" {
+		p.Header["Digest"] = p.Header["Basic"]
+		delete(p.Header, "Basic")
+	}
+
+	switch {
+	case get:
+		u, err := url.Parse(p.URL)
+		if err != nil {
+			return nil, err
+		}
+		q := u.RawQuery
+		for _, d := range data {
+			q += ss.If(q != "", "&", "") + d
+		}
+		u.RawQuery = q
+		p.URL = u.String()
+	case len(data) == 1 && strings.HasPrefix(data[0], "@"):
+		p.Body = data[0]
+	case len(data) > 0:
+		p.Body = strings.Join(data, "&")
+	}
+
+	if p.Method == "" {
+		p.Method = "GET"
+		if !get && (len(data) > 0 || len(p.Form) > 0 || len(p.Files) > 0) {
+			p.Method = "POST"
+		}
+	}
+	if len(data) > 0 && !get && p.Header[ContentTypeName] == "" && !jsonLike(p.Body) {
+		p.Header[ContentTypeName] = "application/x-www-form-urlencoded"
+	}
+	if len(p.Form)+len(p.Files) > 0 && p.Header[ContentTypeName] == "" {
+		// curl -F 总是发送多部分表单，即使只有文本字段
+		p.Header[ContentTypeName] = ContentTypeMultipart
+	}
+	if insecure {
+		// blow 默认不校验服务端证书，与 curl -k 一致，但 -opt tlsVerify 时仍然校验
+		p.Comments = append(p.Comments, "# curl -k/--insecure: the server's cert is not verified unless -opt tlsVerify")
+		log.Printf("curl -k/--insecure of %s: the server's cert is not verified unless -opt tlsVerify", p.URL)
+	}
+
+	p.URL = fixUrl("", p.URL)
+	return p, nil
+}
+
+func jsonLike(s string) bool {
+	s = strings.TrimSpace(s)
+	return strings.HasPrefix(s, "{") || strings.HasPrefix(s, "[")
+}
+
+// splitShellWords splits the command line to words like a POSIX shell,
+// supports single quotes, double quotes, $'...' ANSI-C quotes and backslash escapes.
+func splitShellWords(s string) ([]string, error) {
+	var words []string
+	var word bytes.Buffer
+	inWord := false
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		case c == '\\':
+			inWord = true
+			if i+1 < len(s) {
+				i++
+				word.WriteByte(s[i])
+			}
+		case c == '\'':
+			inWord = true
+			end := strings.IndexByte(s[i+1:], '\'')
+			if end < 0 {
+				return nil, fmt.Errorf("unclosed single quote")
+			}
+			word.WriteString(s[i+1 : i+1+end])
+			i += end + 1
+		case c == '$' && i+1 < len(s) && s[i+1] == '\'':
+			inWord = true
+			j := i + 2
+			for ; j < len(s) && s[j] != '\''; j++ {
+				if s[j] != '\\' || j+1 >= len(s) {
+					word.WriteByte(s[j])
+					continue
+				}
+				j++
+				switch s[j] {
+				case 'n':
+					word.WriteByte('\n')
+				case 't':
+					word.WriteByte('\t')
+				case 'r':
+					word.WriteByte('\r')
+				default:
+					word.WriteByte(s[j])
+				}
+			}
+			if j >= len(s) {
+				return nil, fmt.Errorf("unclosed $' quote")
+			}
+			i = j
+		case c == '"':
+			inWord = true
+			j := i + 1
+			for ; j < len(s) && s[j] != '"'; j++ {
+				if s[j] == '\\' && j+1 < len(s) && strings.IndexByte("\"\\$`\n", s[j+1]) >= 0 {
+					j++
+				}
+				word.WriteByte(s[j])
+			}
+			if j >= len(s) {
+				return nil, fmt.Errorf("unclosed double quote")
+			}
+			i = j
+		default:
+			inWord = true
+			word.WriteByte(c)
+		}
+	}
+
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
@@ -0,0 +1,124 @@
+package internal
+
+import (
+	"bytes"
+	"mime"
+	"mime/multipart"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/valyala/fasthttp"
+)
+
+func TestSplitShellWords(t *testing.T) {
+	words, err := splitShellWords(`curl 'http://a.cn/x?a=1&b=2' -H "X-Name: \"bingoo\"" --data-raw $'{"a":"it\'s\n"}' -u scott\ tiger`)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"curl", "http://a.cn/x?a=1&b=2", "-H", `X-Name: "bingoo"`,
+		"--data-raw", "{\"a\":\"it's\n\"}", "-u", "scott tiger"}, words)
+
+	_, err = splitShellWords(`curl 'http://a.cn`)
+	assert.NotNil(t, err)
+}
+
+func TestParseCurl(t *testing.T) {
+	dir := t.TempDir()
+	note := filepath.Join(dir, "note.txt")
+	assert.Nil(t, os.WriteFile(note, []byte("hello"), 0o644))
+
+	cases := []struct {
+		name, line string
+		want       Profile
+	}{
+		{
+			name: "method and header",
+			line: `curl -X put http://a.cn/x -H 'X-Name: bingoo' -A blow`,
+			want: Profile{Method: "PUT", URL: "http://a.cn/x", Header: map[string]string{"X-Name": "bingoo", "User-Agent": "blow"}},
+		},
+		{
+			name: "data",
+			line: `curl http://a.cn/x -d a=1 -d b=2`,
+			want: Profile{Method: "POST", URL: "http://a.cn/x", Body: "a=1&b=2",
+				Header: map[string]string{ContentTypeName: "application/x-www-form-urlencoded"}},
+		},
+		{
+			name: "data binary file",
+			line: `curl http://a.cn/x --data-binary @body.json -H 'Content-Type: application/json'`,
+			want: Profile{Method: "POST", URL: "http://a.cn/x", Body: "@body.json",
+				Header: map[string]string{ContentTypeName: "application/json"}},
+		},
+		{
+			name: "form upload and text from file",
+			line: `curl http://a.cn/x -F file=@a.png -F note=<` + note,
+			want: Profile{Method: "POST", URL: "http://a.cn/x", Form: map[string]string{"note": "hello"}, Files: map[string]string{"file": "a.png"},
+				Header: map[string]string{ContentTypeName: ContentTypeMultipart}},
+		},
+		{
+			name: "basic auth",
+			line: `curl -u scott:tiger http://a.cn/x`,
+			want: Profile{Method: "GET", URL: "http://a.cn/x", Header: map[string]string{"Basic": "scott:tiger"}},
+		},
+		{
+			name: "digest auth",
+			line: `curl --digest -u scott:tiger http://a.cn/x`,
+			want: Profile{Method: "GET", URL: "http://a.cn/x", Header: map[string]string{"Digest": "scott:tiger"}},
+		},
+		{
+			name: "get with data",
+			line: `curl -G http://a.cn/x?a=1 --data-urlencode 'q=a b'`,
+			want: Profile{Method: "GET", URL: "http://a.cn/x?a=1&q=a+b", Header: map[string]string{}},
+		},
+		{
+			name: "head",
+			line: `curl -I http://a.cn/x`,
+			want: Profile{Method: "HEAD", URL: "http://a.cn/x", Header: map[string]string{}},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			p, err := ParseCurl(c.line)
+			assert.Nil(t, err)
+			assert.Equal(t, c.want.Method, p.Method)
+			assert.Equal(t, c.want.URL, p.URL)
+			assert.Equal(t, c.want.Body, p.Body)
+			assert.Equal(t, c.want.Header, p.Header)
+			if c.want.Form == nil {
+				c.want.Form = map[string]string{}
+			}
+			assert.Equal(t, c.want.Form, p.Form)
+			if c.want.Files == nil {
+				c.want.Files = map[string]string{}
+			}
+			assert.Equal(t, c.want.Files, p.Files)
+		})
+	}
+
+	_, err := ParseCurl(`curl http://a.cn/x -F note=<` + filepath.Join(dir, "missing.txt"))
+	assert.NotNil(t, err)
+	_, err = ParseCurl(`curl http://a.cn/x --proxy-negotiate`)
+	assert.NotNil(t, err)
+
+	p, err := ParseCurl(`curl -k https://a.cn/x`)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"# curl -k/--insecure: the server's cert is not verified unless -opt tlsVerify"}, p.Comments)
+}
+
+func TestCurlFormMultipart(t *testing.T) {
+	profiles, err := ParseCurlProfiles(strings.NewReader("curl http://a.cn/x -F name=bingoo -F age=18\n"))
+	assert.Nil(t, err)
+
+	req := fasthttp.AcquireRequest()
+	defer fasthttp.ReleaseRequest(req)
+	_, err = profiles[0].CreateReq(false, req, false, false, nil)
+	assert.Nil(t, err)
+
+	mediaType, params, err := mime.ParseMediaType(string(req.Header.ContentType()))
+	assert.Nil(t, err)
+	assert.Equal(t, ContentTypeMultipart, mediaType)
+	form, err := multipart.NewReader(bytes.NewReader(req.Body()), params["boundary"]).ReadForm(1024)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string][]string{"name": {"bingoo"}, "age": {"18"}}, form.Value)
+}
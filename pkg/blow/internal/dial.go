@@ -1,41 +1,69 @@
 package internal
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"net"
-	"strings"
 	"sync/atomic"
 	"time"
 
 	"github.com/bingoohuang/berf/pkg/blow/lossy"
 	"github.com/bingoohuang/gg/pkg/osx/env"
-	"github.com/dustin/go-humanize"
 	"github.com/valyala/fasthttp"
 )
 
 type MyConn struct {
 	net.Conn
 	r, w *int64
+	// trace is the trace of the connection for the reuse counting and the latency phases, never nil.
+	trace *ConnTrace
+	// closed and serverClosed are the flags to count the connection closed only once in the ConnStats.
+	closed, serverClosed int32
 }
 
 func NewMyConn(conn net.Conn, r, w *int64) (*MyConn, error) {
-	return &MyConn{Conn: conn, r: r, w: w}, nil
+	return newMyConn(conn, r, w, &ConnTrace{}), nil
+}
+
+func newMyConn(conn net.Conn, r, w *int64, trace *ConnTrace) *MyConn {
+	atomic.AddInt64(&connStats.Opened, 1)
+	return &MyConn{Conn: conn, r: r, w: w, trace: trace}
 }
 
 var Debug = env.Bool("DEBUG", false)
 
 func (c *MyConn) Read(b []byte) (n int, err error) {
 	if n, err = c.Conn.Read(b); n > 0 {
+		if c.trace.timer != nil {
+			c.trace.timer.read(time.Now())
+		}
 		if Debug {
 			fmt.Printf("%s", b)
 		}
 		atomic.AddInt64(c.r, int64(n))
+	} else if errors.Is(err, io.EOF) && atomic.CompareAndSwapInt32(&c.serverClosed, 0, 1) {
+		atomic.AddInt64(&connStats.ServerClosed, 1)
 	}
 	return
 }
 
+func (c *MyConn) Close() error {
+	if atomic.CompareAndSwapInt32(&c.closed, 0, 1) {
+		atomic.AddInt64(&connStats.Closed, 1)
+	}
+	return c.Conn.Close()
+}
+
 func (c *MyConn) Write(b []byte) (n int, err error) {
+	var start time.Time
+	if c.trace.timer != nil {
+		start = time.Now()
+	}
 	if n, err = c.Conn.Write(b); n > 0 {
+		if c.trace.timer != nil {
+			c.trace.timer.write(start, time.Now())
+		}
 		if Debug {
 			fmt.Printf("%s", b)
 		}
@@ -44,6 +72,17 @@ func (c *MyConn) Write(b []byte) (n int, err error) {
 	return
 }
 
+// LocalAddr returns the local address, by which the trace of the connection is found by GetConnTrace.
+// fasthttp gets the local address of the connection for every request right after the connection is acquired,
+// so the timing of a new request is begun here, if the requests are timed.
+func (c *MyConn) LocalAddr() net.Addr {
+	a := &traceAddr{Addr: c.Conn.LocalAddr(), trace: c.trace}
+	if c.trace.timer != nil {
+		a.request = c.trace.timer.begin()
+	}
+	return a
+}
+
 type NetworkWrapper func(net.Conn) net.Conn
 
 func ThroughputStatDial(wrap NetworkWrapper, dial fasthttp.DialFunc, r, w *int64) fasthttp.DialFunc {
@@ -57,36 +96,17 @@ func ThroughputStatDial(wrap NetworkWrapper, dial fasthttp.DialFunc, r, w *int64
 	}
 }
 
-func NetworkWrap(network string) NetworkWrapper {
-	var bandwidth uint64
-	var latency time.Duration
-	noop := func(conn net.Conn) net.Conn { return conn }
-	switch strings.ToLower(network) {
-	case "", "local":
-	case "lan": // 100M
-		bandwidth = 100 * 1024 * 1024
-		latency = 2 * time.Millisecond
-	case "wan": // 20M
-		bandwidth = 20 * 1024 * 1024
-		latency = 30 * time.Millisecond
-	case "bad":
-		bandwidth = 20 * 1024 * 1024
-		latency = 200 * time.Millisecond
-	default:
-		parts := strings.Split(network, ":")
-		if len(parts) >= 1 {
-			bandwidth, _ = humanize.ParseBytes(parts[0])
-		}
-		if len(parts) >= 2 {
-			latency, _ = time.ParseDuration(parts[1])
-		}
+// NetworkWrap creates the wrapper to simulate the network impairment of -network, see lossy.Parse.
+func NetworkWrap(network string) (NetworkWrapper, error) {
+	c, err := lossy.Parse(network)
+	if err != nil {
+		return nil, err
 	}
-
-	if bandwidth == 0 && latency == 0 {
-		return noop
+	if !c.Enabled() {
+		return func(conn net.Conn) net.Conn { return conn }, nil
 	}
 
 	return func(conn net.Conn) net.Conn {
-		return lossy.NewConn(conn, bandwidth, latency, latency)
-	}
+		return lossy.NewConn(conn, c)
+	}, nil
 }
@@ -18,11 +18,35 @@ const (
 var gen = jj.NewGenContext(Valuer)
 
 func Gen(s string, mode StringMode) string {
+	return GenVars(s, mode, nil)
+}
+
+// Vars are the variables of a virtual user, like the ones extracted by result.xx from the responses,
+// they take precedence over the global Valuer.
+type Vars map[string]string
+
+func (v Vars) Value(name, params, expr string) (interface{}, error) {
+	if x, ok := v[name]; ok {
+		return x, nil
+	}
+	return Valuer.Value(name, params, expr)
+}
+
+func (v Vars) Register(fn string, f interface{}) { Valuer.Register(fn, f) }
+
+// GenVars generates s with the variables of the virtual user.
+func GenVars(s string, mode StringMode, v Vars) string {
+	var valuer jj.Substitute = Valuer
+	g := gen
+	if len(v) > 0 {
+		valuer, g = v, jj.NewGenContext(v)
+	}
+
 	if mode == SureJSON || mode == MayJSON && jj.Valid(s) {
-		gs, _ := gen.Gen(s)
+		gs, _ := g.Gen(s)
 		return gs
 	}
 
-	eval, _ := vars.ParseExpr(s).Eval(Valuer)
+	eval, _ := vars.ParseExpr(s).Eval(valuer)
 	return vars.ToString(eval)
 }
@@ -0,0 +1,234 @@
+package internal
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// HAR is the HTTP Archive, see http://www.softwareishard.com/blog/har-12-spec/
+type HAR struct {
+	Log struct {
+		Entries []HAREntry `json:"entries"`
+	} `json:"log"`
+}
+
+type HAREntry struct {
+	StartedDateTime time.Time `json:"startedDateTime"`
+	Request         struct {
+		PostData *struct {
+			MimeType string `json:"mimeType"`
+			Text     string `json:"text"`
+			Encoding string `json:"encoding"`
+			Params   []struct {
+				Name        string `json:"name"`
+				Value       string `json:"value"`
+				FileName    string `json:"fileName"`
+				ContentType string `json:"contentType"`
+			} `json:"params"`
+		} `json:"postData"`
+		Method  string         `json:"method"`
+		URL     string         `json:"url"`
+		Headers []HARNameValue `json:"headers"`
+	} `json:"request"`
+	Response struct {
+		Content struct {
+			MimeType string `json:"mimeType"`
+		} `json:"content"`
+	} `json:"response"`
+	// Time is the elapsed time of the request in milliseconds.
+	Time float64 `json:"time"`
+}
+
+type HARNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// HAROption is the options to convert HAR to profiles.
+type HAROption struct {
+	// Domains 仅保留这些域名（及其子域名）的请求，为空时保留全部
+	Domains []string
+	// Static 保留静态资源请求（js/css/图片/字体等），默认过滤掉
+	Static bool
+	// Think 保留原始请求之间的间隔，作为 [think=xx] 选项
+	Think bool
+	// BodyFilePrefix 非 JSON 请求体写入的文件前缀，例如 session 生成 session.1.body
+	BodyFilePrefix string
+	// ProfileDir 生成的 Profile 所在目录，请求体文件以相对于该目录的路径引用，为空时按 BodyFilePrefix 原样引用
+	ProfileDir string
+}
+
+// ReadHAR reads the HAR file.
+func ReadHAR(r io.Reader) (*HAR, error) {
+	var h HAR
+	if err := json.NewDecoder(r).Decode(&h); err != nil {
+		return nil, fmt.Errorf("decode HAR: %w", err)
+	}
+	return &h, nil
+}
+
+// ConvertHARFile converts the HAR file to the profile file like demo.http.
+func ConvertHARFile(harFile, profileFile string, opt HAROption) error {
+	f, err := os.Open(harFile)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	h, err := ReadHAR(f)
+	if err != nil {
+		return err
+	}
+
+	if opt.BodyFilePrefix == "" {
+		opt.BodyFilePrefix = strings.TrimSuffix(profileFile, filepath.Ext(profileFile))
+	}
+	opt.ProfileDir = filepath.Dir(profileFile)
+
+	out, err := os.Create(profileFile)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	return h.WriteProfiles(out, opt)
+}
+
+// 不需要保留的请求头，由客户端自行生成，或者由 cookie jar 管理
+var harSkipHeaders = map[string]bool{
+	"content-length": true, "connection": true, "keep-alive": true, "transfer-encoding": true,
+	"upgrade": true, "te": true, "accept-encoding": true, "cookie": true,
+}
+
+var harStaticExts = map[string]bool{
+	".js": true, ".mjs": true, ".css": true, ".map": true, ".png": true, ".jpg": true, ".jpeg": true,
+	".gif": true, ".svg": true, ".ico": true, ".webp": true, ".bmp": true, ".woff": true, ".woff2": true,
+	".ttf": true, ".otf": true, ".eot": true, ".mp3": true, ".mp4": true, ".webm": true,
+}
+
+func (e *HAREntry) isStatic() bool {
+	if u, err := url.Parse(e.Request.URL); err == nil && harStaticExts[strings.ToLower(filepath.Ext(u.Path))] {
+		return true
+	}
+
+	mime := strings.ToLower(e.Response.Content.MimeType)
+	for _, prefix := range []string{"image/", "font/", "audio/", "video/", "text/css", "text/javascript", "application/javascript"} {
+		if strings.HasPrefix(mime, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *HAREntry) matchDomains(domains []string) bool {
+	if len(domains) == 0 {
+		return true
+	}
+
+	u, err := url.Parse(e.Request.URL)
+	if err != nil {
+		return false
+	}
+
+	host := u.Hostname()
+	for _, d := range domains {
+		if host == d || strings.HasSuffix(host, "."+d) {
+			return true
+		}
+	}
+	return false
+}
+
+// Filter filters the entries by the option.
+func (h *HAR) Filter(opt HAROption) []HAREntry {
+	var entries []HAREntry
+	for _, e := range h.Log.Entries {
+		if strings.HasPrefix(e.Request.URL, "data:") || !e.matchDomains(opt.Domains) {
+			continue
+		}
+		if !opt.Static && e.isStatic() {
+			continue
+		}
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+// WriteProfiles writes the entries as profiles which can be parsed by ParseProfiles.
+func (h *HAR) WriteProfiles(w io.Writer, opt HAROption) error {
+	entries := h.Filter(opt)
+	if len(entries) == 0 {
+		return fmt.Errorf("no requests left in HAR after filtering")
+	}
+
+	profileEntries := make([]*ProfileEntry, 0, len(entries))
+	var lastEnd time.Time
+	for i, e := range entries {
+		pe, err := e.profileEntry()
+		if err != nil {
+			return err
+		}
+
+		pe.Options = []string{fmt.Sprintf("tag=%d", i+1)}
+		if opt.Think && !lastEnd.IsZero() {
+			if think := e.StartedDateTime.Sub(lastEnd).Truncate(time.Millisecond); think > 0 {
+				pe.Options = append(pe.Options, "think="+think.String())
+			}
+		}
+		lastEnd = e.StartedDateTime.Add(time.Duration(e.Time * float64(time.Millisecond)))
+		profileEntries = append(profileEntries, pe)
+	}
+
+	return WriteProfileEntries(w, profileEntries, opt.BodyFilePrefix, opt.ProfileDir)
+}
+
+func (e *HAREntry) profileEntry() (*ProfileEntry, error) {
+	pe := &ProfileEntry{Method: e.Request.Method, URL: e.Request.URL}
+	pd := e.Request.PostData
+	multipart := pd != nil && strings.HasPrefix(strings.ToLower(pd.MimeType), "multipart/form-data")
+	// 多部分表单没有原始请求体时，使用 httpie 风格的 field@file 字段，由 blow 重新生成边界
+	rebuildMultipart := multipart && pd.Text == "" && len(pd.Params) > 0
+
+	for _, hv := range e.Request.Headers {
+		name := strings.ToLower(hv.Name)
+		if strings.HasPrefix(name, ":") || harSkipHeaders[name] {
+			continue
+		}
+		if rebuildMultipart && name == "content-type" {
+			continue
+		}
+		pe.Headers = append(pe.Headers, [2]string{hv.Name, hv.Value})
+	}
+
+	if pd == nil {
+		return pe, nil
+	}
+
+	if rebuildMultipart {
+		for _, p := range pd.Params {
+			if p.FileName != "" {
+				pe.Fields = append(pe.Fields, p.Name+"@"+p.FileName)
+			} else {
+				pe.Fields = append(pe.Fields, p.Name+"="+p.Value)
+			}
+		}
+		return pe, nil
+	}
+
+	pe.Body = []byte(pd.Text)
+	if pd.Encoding == "base64" {
+		var err error
+		if pe.Body, err = base64.StdEncoding.DecodeString(pd.Text); err != nil {
+			return nil, fmt.Errorf("decode base64 body of %s: %w", e.Request.URL, err)
+		}
+	}
+
+	return pe, nil
+}
@@ -0,0 +1,91 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const harDemo = `{"log": {"entries": [
+{"startedDateTime": "2023-06-01T10:00:00.000Z", "time": 100,
+ "request": {"method": "POST", "url": "https://api.example.com/login",
+   "headers": [{"name": ":authority", "value": "api.example.com"}, {"name": "Content-Type", "value": "application/json"},
+               {"name": "Cookie", "value": "a=b"}, {"name": "X-Trace", "value": "1"}],
+   "postData": {"mimeType": "application/json", "text": "{\n  \"name\": \"bingoo\"\n}"}},
+ "response": {"content": {"mimeType": "application/json"}}},
+{"startedDateTime": "2023-06-01T10:00:00.200Z", "time": 10,
+ "request": {"method": "GET", "url": "https://cdn.example.com/app.js", "headers": []},
+ "response": {"content": {"mimeType": "application/javascript"}}},
+{"startedDateTime": "2023-06-01T10:00:01.600Z", "time": 10,
+ "request": {"method": "POST", "url": "https://api.example.com/form",
+   "headers": [{"name": "Content-Type", "value": "application/x-www-form-urlencoded"}],
+   "postData": {"mimeType": "application/x-www-form-urlencoded", "text": "a=1&b=2"}},
+ "response": {"content": {"mimeType": "text/html"}}},
+{"startedDateTime": "2023-06-01T10:00:02.000Z", "time": 10,
+ "request": {"method": "POST", "url": "https://api.example.com/upload",
+   "headers": [{"name": "Content-Type", "value": "multipart/form-data; boundary=xx"}],
+   "postData": {"mimeType": "multipart/form-data", "params": [{"name": "file", "fileName": "a.png"}]}},
+ "response": {"content": {"mimeType": "application/json"}}},
+{"startedDateTime": "2023-06-01T10:00:03.000Z", "time": 10,
+ "request": {"method": "GET", "url": "https://other.com/track", "headers": []},
+ "response": {"content": {"mimeType": "application/json"}}}
+]}}`
+
+func TestHARWriteProfiles(t *testing.T) {
+	h, err := ReadHAR(strings.NewReader(harDemo))
+	assert.Nil(t, err)
+
+	prefix := filepath.Join(t.TempDir(), "session")
+	var b strings.Builder
+	err = h.WriteProfiles(&b, HAROption{Domains: []string{"example.com"}, Think: true, BodyFilePrefix: prefix})
+	assert.Nil(t, err)
+
+	assert.Equal(t, `### [tag=1]
+POST https://api.example.com/login
+Content-Type: application/json
+X-Trace: 1
+
+{"name":"bingoo"}
+
+### [tag=2 think=1.5s]
+POST https://api.example.com/form
+Content-Type: application/x-www-form-urlencoded
+
+@`+prefix+`.2.body
+
+### [tag=3 think=390ms]
+POST https://api.example.com/upload
+file@a.png
+
+`, b.String())
+
+	body, err := os.ReadFile(prefix + ".2.body")
+	assert.Nil(t, err)
+	assert.Equal(t, "a=1&b=2", string(body))
+}
+
+func TestConvertHARFileBodyRef(t *testing.T) {
+	dir := t.TempDir()
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "session.har"), []byte(harDemo), 0o644))
+	assert.Nil(t, os.MkdirAll(filepath.Join(dir, "profiles"), 0o755))
+
+	// 在 dir 中把 Profile 写到子目录 profiles，请求体文件以相对于 Profile 的路径引用
+	wd, err := os.Getwd()
+	assert.Nil(t, err)
+	assert.Nil(t, os.Chdir(dir))
+	err = ConvertHARFile("session.har", filepath.Join("profiles", "session.http"), HAROption{Domains: []string{"example.com"}})
+	assert.Nil(t, os.Chdir(wd))
+	assert.Nil(t, err)
+
+	out := filepath.Join(dir, "profiles", "session.http")
+	data, err := os.ReadFile(out)
+	assert.Nil(t, err)
+	assert.Contains(t, string(data), "\n@session.2.body\n")
+
+	profiles, err := ParseProfileFile(out, &ProfileOption{})
+	assert.Nil(t, err)
+	assert.Equal(t, "a=1&b=2", string(profiles[1].bodyFileData))
+}
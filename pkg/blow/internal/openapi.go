@@ -0,0 +1,440 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/bingoohuang/gg/pkg/ss"
+	"gopkg.in/yaml.v3"
+)
+
+// OpenAPIOption is the options to generate profiles from OpenAPI 3 documents.
+type OpenAPIOption struct {
+	// BaseURL 覆盖文档中的 servers[0].url
+	BaseURL string
+	// Tags 仅生成这些标签的操作
+	Tags []string
+	// Ops 仅生成这些 operationId 的操作
+	Ops []string
+}
+
+// OpenAPI is the OpenAPI 3 document, kept as generic maps to resolve $ref.
+type OpenAPI struct {
+	doc map[string]interface{}
+}
+
+// ReadOpenAPI reads the OpenAPI 3 document in JSON or YAML.
+func ReadOpenAPI(r io.Reader) (*OpenAPI, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc map[string]interface{}
+	// YAML 是 JSON 的超集，统一使用 YAML 解析
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("parse OpenAPI document: %w", err)
+	}
+	if v, _ := doc["openapi"].(string); !strings.HasPrefix(v, "3.") {
+		return nil, fmt.Errorf("only OpenAPI 3 is supported, got openapi: %v", doc["openapi"])
+	}
+
+	return &OpenAPI{doc: doc}, nil
+}
+
+// ConvertOpenAPIFile converts the OpenAPI 3 document file to the profile file like demo.http.
+func ConvertOpenAPIFile(specFile, profileFile string, opt OpenAPIOption) error {
+	f, err := os.Open(specFile)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	o, err := ReadOpenAPI(f)
+	if err != nil {
+		return err
+	}
+
+	out, err := os.Create(profileFile)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	return o.WriteProfiles(out, opt)
+}
+
+var openAPIMethods = []string{"get", "post", "put", "patch", "delete", "head", "options", "trace"}
+
+// WriteProfiles writes one profile per operation, with path and query parameters filled,
+// and JSON bodies generated by the jj generator functions like @姓名, @身份证.
+func (o *OpenAPI) WriteProfiles(w io.Writer, opt OpenAPIOption) error {
+	baseURL, err := o.baseURL(opt.BaseURL)
+	if err != nil {
+		return err
+	}
+
+	paths, _ := o.doc["paths"].(map[string]interface{})
+	pathNames := make([]string, 0, len(paths))
+	for p := range paths {
+		pathNames = append(pathNames, p)
+	}
+	sort.Strings(pathNames)
+
+	b := &strings.Builder{}
+	num := 0
+	for _, path := range pathNames {
+		item, _ := o.resolve(paths[path]).(map[string]interface{})
+		for _, method := range openAPIMethods {
+			op, ok := item[method].(map[string]interface{})
+			if !ok || !o.selected(op, opt) {
+				continue
+			}
+
+			num++
+			if err := o.writeOperation(b, baseURL, path, method, item, op, num); err != nil {
+				return fmt.Errorf("%s %s: %w", strings.ToUpper(method), path, err)
+			}
+		}
+	}
+
+	if num == 0 {
+		return fmt.Errorf("no operations found in OpenAPI document")
+	}
+
+	_, err = io.WriteString(w, b.String())
+	return err
+}
+
+func (o *OpenAPI) baseURL(override string) (string, error) {
+	base := override
+	if base == "" {
+		if servers, _ := o.doc["servers"].([]interface{}); len(servers) > 0 {
+			server, _ := servers[0].(map[string]interface{})
+			base, _ = server["url"].(string)
+			// 服务器变量使用默认值，例如 https://{env}.example.com
+			vars, _ := server["variables"].(map[string]interface{})
+			for k, v := range vars {
+				def, _ := v.(map[string]interface{})["default"]
+				base = strings.ReplaceAll(base, "{"+k+"}", fmt.Sprintf("%v", def))
+			}
+		}
+	}
+
+	if base == "" || strings.HasPrefix(base, "/") {
+		base = "http://127.0.0.1:8080" + base
+	}
+	if _, err := url.Parse(base); err != nil {
+		return "", fmt.Errorf("bad base URL %s: %w", base, err)
+	}
+
+	return strings.TrimSuffix(base, "/"), nil
+}
+
+func (o *OpenAPI) selected(op map[string]interface{}, opt OpenAPIOption) bool {
+	if len(opt.Tags) == 0 && len(opt.Ops) == 0 {
+		return true
+	}
+
+	opID, _ := op["operationId"].(string)
+	for _, id := range opt.Ops {
+		if strings.EqualFold(id, opID) {
+			return true
+		}
+	}
+
+	tags, _ := op["tags"].([]interface{})
+	for _, tag := range tags {
+		for _, t := range opt.Tags {
+			if strings.EqualFold(t, fmt.Sprintf("%v", tag)) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+var nonTagChar = regexp.MustCompile(`[^\w.]+`)
+
+func (o *OpenAPI) writeOperation(b *strings.Builder, baseURL, path, method string,
+	item, op map[string]interface{}, num int,
+) error {
+	// 标签用于 -P file:tag 选择，选择范围使用 - 分隔，因此去掉 operationId 中的特殊字符
+	tag := fmt.Sprintf("%d", num)
+	if opID, _ := op["operationId"].(string); opID != "" {
+		tag = nonTagChar.ReplaceAllString(opID, "_")
+	}
+
+	if summary, _ := op["summary"].(string); summary != "" {
+		fmt.Fprintf(b, "# %s\n", strings.Join(strings.Fields(summary), " "))
+	}
+	fmt.Fprintf(b, "### [tag=%s eval]\n", tag)
+
+	var query []string
+	var headers [][2]string
+	params := append(o.list(item["parameters"]), o.list(op["parameters"])...)
+	for _, p := range params {
+		param, _ := o.resolve(p).(map[string]interface{})
+		name, _ := param["name"].(string)
+		required, _ := param["required"].(bool)
+		schema, _ := o.resolve(param["schema"]).(map[string]interface{})
+		value := param["example"]
+		if value == nil {
+			value = o.generate(name, schema, 0)
+		}
+		v := fmt.Sprintf("%v", value)
+
+		switch param["in"] {
+		case "path":
+			path = strings.ReplaceAll(path, "{"+name+"}", v)
+		case "query":
+			// 可选参数仅在有示例或者默认值时填充
+			if required || param["example"] != nil || schema["default"] != nil || schema["example"] != nil {
+				// 生成表达式保持原样，便于 eval 生成
+				query = append(query, url.QueryEscape(name)+"="+ss.If(strings.HasPrefix(v, "@"), v, url.QueryEscape(v)))
+			}
+		case "header":
+			if required || param["example"] != nil {
+				headers = append(headers, [2]string{name, v})
+			}
+		}
+	}
+
+	addr := baseURL + path
+	if len(query) > 0 {
+		addr += "?" + strings.Join(query, "&")
+	}
+	fmt.Fprintf(b, "%s %s\n", strings.ToUpper(method), addr)
+	for _, h := range headers {
+		fmt.Fprintf(b, "%s: %s\n", h[0], h[1])
+	}
+
+	if err := o.writeRequestBody(b, op); err != nil {
+		return err
+	}
+	b.WriteString("\n")
+	return nil
+}
+
+func (o *OpenAPI) writeRequestBody(b *strings.Builder, op map[string]interface{}) error {
+	body, _ := o.resolve(op["requestBody"]).(map[string]interface{})
+	content, _ := body["content"].(map[string]interface{})
+	if len(content) == 0 {
+		return nil
+	}
+
+	for _, ct := range []string{"application/json", "multipart/form-data", "application/x-www-form-urlencoded"} {
+		media, ok := content[ct].(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		schema, _ := o.resolve(media["schema"]).(map[string]interface{})
+		value := media["example"]
+		if value == nil {
+			value = o.generate("", schema, 0)
+		}
+
+		switch ct {
+		case "application/json":
+			buf := &bytes.Buffer{}
+			enc := json.NewEncoder(buf)
+			enc.SetEscapeHTML(false)
+			enc.SetIndent("", "  ")
+			if err := enc.Encode(value); err != nil {
+				return err
+			}
+			b.WriteString("\n")
+			b.Write(buf.Bytes())
+		default: // 表单使用 field=value 字段，值中的 @姓名 等由 eval 生成
+			if ct == ContentTypeMultipart {
+				fmt.Fprintf(b, "%s: %s\n", ContentTypeName, ct)
+			}
+			fields, _ := value.(map[string]interface{})
+			for _, k := range sortedKeys(fields) {
+				if v := fields[k]; v == openAPIBinary {
+					// 上传字段没有可用的文件，由用户提供后使用 field@file 字段上传
+					fmt.Fprintf(b, "# %s@/path/to/file: supply a file to upload\n", k)
+				} else {
+					fmt.Fprintf(b, "%s=%v\n", k, v)
+				}
+			}
+		}
+		return nil
+	}
+
+	return nil
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (o *OpenAPI) list(v interface{}) []interface{} {
+	l, _ := o.resolve(v).([]interface{})
+	return l
+}
+
+// resolve resolves the local $ref like #/components/schemas/User.
+func (o *OpenAPI) resolve(v interface{}) interface{} {
+	for i := 0; i < 10; i++ {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return v
+		}
+		ref, ok := m["$ref"].(string)
+		if !ok || !strings.HasPrefix(ref, "#/") {
+			return v
+		}
+
+		var node interface{} = o.doc
+		for _, key := range strings.Split(ref[2:], "/") {
+			key = strings.NewReplacer("~1", "/", "~0", "~").Replace(key)
+			parent, _ := node.(map[string]interface{})
+			node = parent[key]
+		}
+		v = node
+	}
+	return v
+}
+
+const openAPIBinary = "@binary"
+
+// generate generates the value of the schema, the strings are jj generator expressions evaluated by [eval].
+func (o *OpenAPI) generate(name string, schema map[string]interface{}, depth int) interface{} {
+	if schema == nil || depth > 8 {
+		return nil
+	}
+	if v, ok := schema["example"]; ok {
+		return v
+	}
+	if v, ok := schema["default"]; ok {
+		return v
+	}
+	if enum, _ := schema["enum"].([]interface{}); len(enum) > 0 {
+		values := make([]string, 0, len(enum))
+		for _, e := range enum {
+			s := fmt.Sprintf("%v", e)
+			if strings.ContainsAny(s, ",() ") {
+				return e
+			}
+			values = append(values, s)
+		}
+		return "@random(" + strings.Join(values, ",") + ")"
+	}
+
+	for _, key := range []string{"allOf", "oneOf", "anyOf"} {
+		subs := o.list(schema[key])
+		if len(subs) == 0 {
+			continue
+		}
+		if key != "allOf" {
+			sub, _ := o.resolve(subs[0]).(map[string]interface{})
+			return o.generate(name, sub, depth+1)
+		}
+
+		merged := map[string]interface{}{}
+		for _, s := range subs {
+			sub, _ := o.resolve(s).(map[string]interface{})
+			if m, ok := o.generate(name, sub, depth+1).(map[string]interface{}); ok {
+				for k, v := range m {
+					merged[k] = v
+				}
+			}
+		}
+		return merged
+	}
+
+	typ, _ := schema["type"].(string)
+	if typ == "" && schema["properties"] != nil {
+		typ = "object"
+	}
+
+	switch typ {
+	case "object":
+		obj := map[string]interface{}{}
+		props, _ := schema["properties"].(map[string]interface{})
+		for k, v := range props {
+			prop, _ := o.resolve(v).(map[string]interface{})
+			if pv := o.generate(k, prop, depth+1); pv != nil {
+				obj[k] = pv
+			}
+		}
+		return obj
+	case "array":
+		items, _ := o.resolve(schema["items"]).(map[string]interface{})
+		if item := o.generate(name, items, depth+1); item != nil {
+			return []interface{}{item}
+		}
+		return []interface{}{}
+	case "integer", "number":
+		min, max := 1, 1000
+		if v, ok := schema["minimum"].(int); ok {
+			min = v
+		}
+		if v, ok := schema["maximum"].(int); ok {
+			max = v
+		}
+		if max < min {
+			max = min
+		}
+		return fmt.Sprintf("@random_int(%d-%d)", min, max)
+	case "boolean":
+		return "@random_bool"
+	default:
+		return generateString(name, schema)
+	}
+}
+
+// generateString generates the string by the format or the field name.
+func generateString(name string, schema map[string]interface{}) string {
+	switch format, _ := schema["format"].(string); format {
+	case "uuid":
+		return "@uuid"
+	case "date":
+		return "@random_time(yyyy-MM-dd)"
+	case "date-time":
+		return "@random_time(yyyy-MM-ddTHH:mm:ss)"
+	case "email":
+		return "@邮箱"
+	case "byte":
+		return "@base64(size=16)"
+	case "binary":
+		return openAPIBinary
+	}
+
+	n := strings.ToLower(strings.NewReplacer("_", "", "-", "").Replace(name))
+	switch {
+	case strings.Contains(n, "idcard") || strings.Contains(n, "idno") || strings.Contains(n, "chinaid") || n == "identity":
+		return "@身份证"
+	case strings.Contains(n, "mobile") || strings.Contains(n, "phone"):
+		return "@手机"
+	case strings.Contains(n, "email") || n == "mail":
+		return "@邮箱"
+	case strings.Contains(n, "address") || n == "addr":
+		return "@地址"
+	case strings.Contains(n, "bankcard") || strings.Contains(n, "cardno"):
+		return "@银行卡"
+	case n == "gender" || n == "sex":
+		return "@性别"
+	case n == "name" || n == "realname" || n == "fullname" || n == "username":
+		return "@姓名"
+	case n == "id" || strings.HasSuffix(n, "id"):
+		return "@ksuid"
+	}
+
+	return "@regex([a-zA-Z0-9]{8})"
+}
@@ -0,0 +1,143 @@
+package internal
+
+import (
+	"bytes"
+	"mime"
+	"mime/multipart"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/valyala/fasthttp"
+)
+
+const openAPIDemo = `
+openapi: 3.0.1
+servers:
+  - url: https://{env}.example.com/api
+    variables:
+      env: {default: test}
+paths:
+  /users/{id}:
+    parameters:
+      - {name: id, in: path, required: true, schema: {type: integer, minimum: 1, maximum: 99}}
+    get:
+      operationId: getUser
+      tags: [user]
+      parameters:
+        - {name: fields, in: query, schema: {type: string}}
+        - {name: page, in: query, required: true, example: 10}
+  /users:
+    post:
+      operationId: create-user
+      tags: [user]
+      requestBody:
+        content:
+          application/json:
+            schema: {$ref: '#/components/schemas/User'}
+  /orders:
+    get:
+      operationId: listOrders
+      tags: [order]
+components:
+  schemas:
+    User:
+      type: object
+      properties:
+        name: {type: string}
+        mobile: {type: string}
+        gender: {type: string, enum: [male, female]}
+`
+
+func TestOpenAPIWriteProfiles(t *testing.T) {
+	o, err := ReadOpenAPI(strings.NewReader(openAPIDemo))
+	assert.Nil(t, err)
+
+	var b strings.Builder
+	assert.Nil(t, o.WriteProfiles(&b, OpenAPIOption{Tags: []string{"user"}}))
+	assert.Equal(t, `### [tag=create_user eval]
+POST https://test.example.com/api/users
+
+{
+  "gender": "@random(male,female)",
+  "mobile": "@手机",
+  "name": "@姓名"
+}
+
+### [tag=getUser eval]
+GET https://test.example.com/api/users/@random_int(1-99)?page=10
+
+`, b.String())
+}
+
+func TestOpenAPIFormProfiles(t *testing.T) {
+	o, err := ReadOpenAPI(strings.NewReader(`
+openapi: 3.0.1
+paths:
+  /login:
+    post:
+      operationId: login
+      requestBody:
+        content:
+          application/x-www-form-urlencoded:
+            schema:
+              properties:
+                id: {type: string, format: uuid}
+                age: {type: integer, minimum: 18, maximum: 18}
+  /avatar:
+    post:
+      operationId: avatar
+      requestBody:
+        content:
+          multipart/form-data:
+            schema:
+              properties:
+                id: {type: string, format: uuid}
+                file: {type: string, format: binary}
+`))
+	assert.Nil(t, err)
+
+	var b strings.Builder
+	assert.Nil(t, o.WriteProfiles(&b, OpenAPIOption{}))
+	assert.Equal(t, `### [tag=avatar eval]
+POST http://127.0.0.1:8080/avatar
+Content-Type: multipart/form-data
+# file@/path/to/file: supply a file to upload
+id=@uuid
+
+### [tag=login eval]
+POST http://127.0.0.1:8080/login
+age=@random_int(18-18)
+id=@uuid
+
+`, b.String())
+
+	profiles, err := ParseProfiles(strings.NewReader(b.String()), "")
+	assert.Nil(t, err)
+	assert.Len(t, profiles, 2)
+
+	req := fasthttp.AcquireRequest()
+	defer fasthttp.ReleaseRequest(req)
+
+	_, err = profiles[0].CreateReq(false, req, false, false, Vars{})
+	assert.Nil(t, err)
+	mediaType, params, err := mime.ParseMediaType(string(req.Header.ContentType()))
+	assert.Nil(t, err)
+	assert.Equal(t, ContentTypeMultipart, mediaType)
+	form, err := multipart.NewReader(bytes.NewReader(req.Body()), params["boundary"]).ReadForm(1024)
+	assert.Nil(t, err)
+	// 字段值由 eval 生成，而不是作为上传文件
+	assert.Len(t, form.Value["id"], 1)
+	assert.False(t, strings.HasPrefix(form.Value["id"][0], "@"))
+
+	req.Reset()
+	_, err = profiles[1].CreateReq(false, req, false, false, Vars{})
+	assert.Nil(t, err)
+	assert.Equal(t, "application/x-www-form-urlencoded", string(req.Header.ContentType()))
+	values, err := url.ParseQuery(string(req.Body()))
+	assert.Nil(t, err)
+	assert.Contains(t, values, "age")
+	assert.Contains(t, values, "id")
+	assert.False(t, strings.HasPrefix(values.Get("id"), "@"))
+}
@@ -2,28 +2,42 @@ package internal
 
 import (
 	"bufio"
+	"bytes"
 	_ "embed"
 	"encoding/base64"
 	"errors"
+	"fmt"
 	"io"
+	"math/rand"
+	"mime/multipart"
 	"net/textproto"
 	"net/url"
 	"os"
+	"path/filepath"
 	"regexp"
+	"sort"
 	"strings"
 	"unicode"
 
+	"github.com/bingoohuang/berf/pkg/blow/script"
+	"github.com/bingoohuang/gg/pkg/filex"
 	"github.com/bingoohuang/gg/pkg/gz"
-	"github.com/bingoohuang/gg/pkg/iox"
 	"github.com/bingoohuang/gg/pkg/rest"
+	"github.com/bingoohuang/gg/pkg/thinktime"
 	"github.com/bingoohuang/jj"
 	"github.com/valyala/fasthttp"
 )
 
-func (p *Profile) CreateReq(isTLS bool, req *fasthttp.Request, enableGzip, uploadIndex bool) (Closers, error) {
+// CreateReq creates the request of the profile, vars are the variables of the virtual user used by eval.
+func (p *Profile) CreateReq(isTLS bool, req *fasthttp.Request, enableGzip, uploadIndex bool, vars Vars) (Closers, error) {
 	p.requestHeader.CopyTo(&req.Header)
 	if !p.Init && p.Eval {
-		req.Header.SetRequestURI(Gen(p.URL, IgnoreJSON))
+		req.Header.SetRequestURI(GenVars(p.URL, IgnoreJSON, vars))
+		for k, v := range p.Header {
+			if evalHeaderRegexp.MatchString(v) {
+				req.Header.Set(k, GenVars(v, IgnoreJSON, vars))
+			}
+		}
 	}
 
 	if isTLS {
@@ -48,14 +62,13 @@ func (p *Profile) CreateReq(isTLS bool, req *fasthttp.Request, enableGzip, uploa
 	var bodyBytes []byte
 	if len(p.bodyFileData) > 0 {
 		bodyBytes = p.bodyFileData
-	}
-	if p.Body != "" {
+	} else if p.Body != "" {
 		bodyBytes = []byte(p.Body)
 	}
 
 	if len(bodyBytes) > 0 {
 		if p.Eval {
-			bodyBytes = []byte(Gen(string(bodyBytes), If(p.JsonBody, SureJSON, MayJSON)))
+			bodyBytes = []byte(GenVars(string(bodyBytes), If(p.JsonBody, SureJSON, MayJSON), vars))
 		}
 
 		bodyBytes = []byte(p.EnvVars.Eval(string(bodyBytes)))
@@ -71,25 +84,75 @@ func (p *Profile) CreateReq(isTLS bool, req *fasthttp.Request, enableGzip, uploa
 		return nil, nil
 	}
 
-	for k, v := range p.Form {
-		// 先处理，只上传一个文件的情形
-		if strings.HasPrefix(v, "@") {
-			fr := &fileReader{File: v[1:], uploadFileField: k}
-			uv := fr.Read(false)
-			data := uv.Data()
-			multi := data.CreateFileField(k, uploadIndex)
-			for k, v := range multi.Headers {
-				SetHeader(req, k, v)
+	// 先处理，只上传一个文件的情形
+	for k, v := range p.Files {
+		fr := &fileReader{File: v, uploadFileField: k}
+		uv := fr.Read(false)
+		data := uv.Data()
+		multi := data.CreateFileField(k, uploadIndex)
+		for k, v := range multi.Headers {
+			SetHeader(req, k, v)
+		}
+		req.Header.Set("Beefs-Original", data.Payload.Original)
+		req.SetBodyStream(multi.NewReader(), int(multi.Size))
+		return nil, nil
+	}
+
+	if p.hasFormBody() {
+		form := url.Values{}
+		for k, v := range p.Form {
+			if p.Eval {
+				v = GenVars(v, IgnoreJSON, vars)
 			}
-			req.Header.Set("Beefs-Original", data.Payload.Original)
-			req.SetBodyStream(multi.NewReader(), int(multi.Size))
-			return nil, nil
+			form.Set(k, p.EnvVars.Eval(v))
+		}
+		if p.multipartForm {
+			return nil, setMultipartForm(req, form)
 		}
+		req.SetBodyString(form.Encode())
 	}
 
 	return nil, nil
 }
 
+// setMultipartForm sets the text fields as the multipart/form-data body, like curl -F name=value.
+func setMultipartForm(req *fasthttp.Request, form url.Values) error {
+	keys := make([]string, 0, len(form))
+	for k := range form {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	for _, k := range keys {
+		if err := w.WriteField(k, form.Get(k)); err != nil {
+			return err
+		}
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	req.Header.SetContentType(w.FormDataContentType())
+	req.SetBodyRaw(buf.Bytes())
+	return nil
+}
+
+// hasFormBody tells the form fields (field=value) should be sent as the form-encoded body,
+// the values like @姓名 are evaluated by eval, not taken as the files to upload.
+func (p *Profile) hasFormBody() bool {
+	return len(p.Form) > 0 && len(p.Files) == 0 && p.Body == "" && !isQueryMethod(p.Method)
+}
+
+func isQueryMethod(method string) bool {
+	switch method {
+	case "GET", "HEAD", "CONNECT", "OPTIONS", "TRACE":
+		return true
+	}
+	return false
+}
+
 func (p *Profile) createHeader() error {
 	u, err := url.Parse(p.URL)
 	if err != nil {
@@ -99,9 +162,14 @@ func (p *Profile) createHeader() error {
 	contentType := p.Header[ContentTypeName]
 	if contentType == "" {
 		contentType = `plain/text; charset=utf-8`
+		if p.hasFormBody() {
+			contentType = "application/x-www-form-urlencoded"
+		}
 	} else {
 		delete(p.Header, ContentTypeName)
 	}
+	// Content-Type: multipart/form-data 时，文本字段使用多部分表单发送，由 blow 生成边界
+	p.multipartForm = strings.HasPrefix(strings.ToLower(contentType), ContentTypeMultipart)
 
 	host := u.Host
 	if v := p.Header["Host"]; v != "" {
@@ -121,6 +189,11 @@ func (p *Profile) createHeader() error {
 		p.requestHeader.Set("Authorization", "Basic "+b)
 		delete(p.Header, "Basic")
 	}
+	// Digest: user:pass 使用 HTTP Digest 认证，由 401 质询后计算认证头
+	if v := p.Header["Digest"]; v != "" {
+		p.Digest = v
+		delete(p.Header, "Digest")
+	}
 
 	p.requestHeader.Set("Accept", "application/json")
 	for k, v := range p.Header {
@@ -131,8 +204,7 @@ func (p *Profile) createHeader() error {
 }
 
 func (p *Profile) makeQuery(query url.Values) url.Values {
-	switch p.Method {
-	case "GET", "HEAD", "CONNECT", "OPTIONS", "TRACE":
+	if isQueryMethod(p.Method) {
 		for k, v := range p.Form {
 			query.Set(k, v)
 		}
@@ -147,6 +219,7 @@ type Option struct {
 	// 从结果 JSON 中 使用 jj.Get 提取值, 参见 demo.http 中写法
 	// 例如：result.id=chinaID，表示设置 @id = jj.Get(responseJSON, "chinaID")
 	// 一般配合初始化调用使用，例如从登录结果中提取 accessToken 等
+	// 非初始化调用提取的值，仅对当前虚拟用户（协程）后续 eval 的请求可见
 	ResultExpr map[string]string `prefix:"result."`
 	Tag        string
 	Eval       bool
@@ -154,6 +227,27 @@ type Option struct {
 
 	// 作为初始化调用，例如登录
 	Init bool
+
+	// 请求前的思考时间，例如 think=1s 或者 think=1s-3s
+	Think string
+
+	// 步骤重复执行的次数，例如 repeat=5
+	Repeat int
+	// 权重，相邻的带权重的步骤为一组，每次迭代按照权重随机选取其中一个执行，例如 weight=3
+	Weight int
+	// 执行条件，当前虚拟用户的变量非空（且不为 0 或 false）时才执行，例如 if=${orderId} 或者 if=!@orderId
+	If string
+	// 步骤出错或者响应非 2xx 时，继续执行后续的步骤，默认停止本次迭代
+	ContinueOnError bool
+	// 分组，同组步骤的耗时合计后在子操作中统计，例如 group=checkout
+	Group string
+
+	// 请求签名，为空时使用 -sign 的默认签名，off 不签名，或者 -sign 中命名的签名，或者签名定义，例如 sign=hmac:key=secret
+	Sign string
+
+	// 作为令牌获取调用，配合 -token 使用，使用 result.token 提取令牌，result.expires_in 提取有效秒数
+	// 令牌在过期前或者响应 401 时，重新调用获取
+	Auth bool
 }
 
 type Profile struct {
@@ -163,15 +257,73 @@ type Profile struct {
 	Query         map[string]string
 	RawJSON       map[string]string
 	Form          map[string]string
-	Header        map[string]string
-	EnvVars       EnvVars
-	Body          string
-	URL           string
-	Method        string
-	bodyFileName  string
-	Comments      []string
+	// Files are the file upload fields like field@file, by the file names.
+	Files        map[string]string
+	Header       map[string]string
+	EnvVars      EnvVars
+	Body         string
+	URL          string
+	Method       string
+	bodyFileName string
+	Comments     []string
+	// Digest is the user:pass of the header Digest: user:pass, for the HTTP Digest authentication.
+	Digest string
+	// dir is the directory of the profile file, to resolve the relative @file.
+	dir string
+
+	// PreScript runs before the request, like < {% request.headers["X-Sign"] = crypto.sha256(request.body) %}
+	PreScript *script.Script
+	// PostScript runs after the response, like > {% vars.set("orderId", response.json.data.id) %}
+	PostScript *script.Script
 
 	bodyFileData []byte
+	// multipartForm tells the form fields are sent as multipart/form-data by its Content-Type.
+	multipartForm bool
+
+	thinkTime *thinktime.ThinkTime
+}
+
+// ThinkNow sleeps the think time of the profile before its request.
+func (p *Profile) ThinkNow() {
+	if p.thinkTime != nil {
+		p.thinkTime.Think(true)
+	}
+}
+
+// Runnable tells whether the profile should run by its if condition with the variables of the virtual user.
+func (p *Profile) Runnable(v Vars) bool {
+	cond := strings.TrimSpace(p.If)
+	if cond == "" {
+		return true
+	}
+
+	negative := strings.HasPrefix(cond, "!")
+	cond = strings.TrimPrefix(cond, "!")
+	if strings.HasPrefix(cond, "${") && strings.HasSuffix(cond, "}") {
+		cond = cond[2 : len(cond)-1]
+	}
+	cond = strings.TrimPrefix(cond, "@")
+
+	val := v[cond]
+	ok := val != "" && val != "0" && val != "false"
+	return ok != negative
+}
+
+// PickWeighted picks a profile randomly by their weights.
+func PickWeighted(profiles []*Profile) *Profile {
+	total := 0
+	for _, p := range profiles {
+		total += p.Weight
+	}
+
+	n := rand.Intn(total)
+	for _, p := range profiles {
+		if n -= p.Weight; n < 0 {
+			return p
+		}
+	}
+
+	return profiles[len(profiles)-1]
 }
 
 var (
@@ -206,28 +358,42 @@ func regexFollows(reg *regexp.Regexp, s, following string) (isEnv, matchFollower
 //go:embed demo.http
 var DemoProfile []byte
 
-func ParseProfileFile(fileName, envName string) ([]*Profile, error) {
-	f, err := os.Open(fileName)
+// ProfileOption is the option to parse the profiles.
+type ProfileOption struct {
+	// Env is the env section selected, like test for ### env: test
+	Env string
+	// Vars are the variables from the command line, like -var baseURL=http://127.0.0.1:5003
+	Vars map[string]string
+	// VarsFile is the shared variables file loaded before parsing, with lines like export baseURL=http://127.0.0.1:5003
+	VarsFile string
+}
+
+func ParseProfileFile(fileName string, opt *ProfileOption) ([]*Profile, error) {
+	data, err := os.ReadFile(fileName)
 	if err != nil {
 		panic(err.Error())
 	}
-	defer iox.Close(f)
 
-	return ParseProfiles(f, envName)
+	if IsCurlProfile(data) {
+		return ParseCurlProfiles(bytes.NewReader(data))
+	}
+
+	pp, err := newProfileParser(opt)
+	if err != nil {
+		return nil, err
+	}
+	if abs, err := filepath.Abs(fileName); err == nil {
+		pp.including[abs] = true
+	}
+	return pp.parseAll(bytes.NewReader(data), filepath.Dir(fileName))
 }
 
 func ParseProfiles(r io.Reader, envName string) ([]*Profile, error) {
-	buf := bufio.NewReader(r)
-	profiles, err := parseRequests(buf, envName)
+	pp, err := newProfileParser(&ProfileOption{Env: envName})
 	if err != nil {
-		if errors.Is(err, io.EOF) {
-			return profiles, nil
-		}
-
 		return nil, err
 	}
-
-	return profiles, nil
+	return pp.parseAll(r, "")
 }
 
 type EnvVars map[string]string
@@ -248,28 +414,107 @@ func (e EnvVars) Eval(s string) string {
 	return s
 }
 
-func parseRequests(buf *bufio.Reader, envName string) (profiles []*Profile, err error) {
+// varLevel is the precedence of the variables:
+// command line -var > env section > @include and -vars shared file > OS environment.
+type varLevel int
+
+const (
+	varLevelInclude varLevel = iota + 1
+	varLevelEnv
+	varLevelCLI
+)
+
+var (
+	includeRegexp = regexp.MustCompile(`^@include\s+(.+?)\s*$`)
+	varLineRegexp = regexp.MustCompile(`^(?:export\s+)?(\w[\w_\d-]*)\s*=\s*(.*?)\s*$`)
+)
+
+type profileParser struct {
+	envName  string
+	envVars  EnvVars
+	levels   map[string]varLevel
+	profiles []*Profile
+
+	// pendingPre is the pre-request script before the request line.
+	pendingPre *script.Script
+	// scriptKind is < or > when parsing a multi-line script block {% ... %}.
+	scriptKind byte
+	scriptBuf  []string
+	// including are the files being parsed, to detect the circular includes.
+	including map[string]bool
+}
+
+func newProfileParser(opt *ProfileOption) (*profileParser, error) {
+	pp := &profileParser{
+		envName:   opt.Env,
+		envVars:   EnvVars{},
+		levels:    map[string]varLevel{},
+		including: map[string]bool{},
+	}
+
+	if opt.VarsFile != "" {
+		data, err := os.ReadFile(opt.VarsFile)
+		if err != nil {
+			return nil, fmt.Errorf("read vars file %s: %w", opt.VarsFile, err)
+		}
+		for _, l := range strings.Split(string(data), "\n") {
+			if l = strings.TrimSpace(l); l != "" && !strings.HasPrefix(l, "#") {
+				if subs := varLineRegexp.FindStringSubmatch(l); len(subs) > 0 {
+					pp.setVar(subs[1], subs[2], varLevelInclude)
+				}
+			}
+		}
+	}
+
+	for k, v := range opt.Vars {
+		pp.setVar(k, v, varLevelCLI)
+	}
+
+	return pp, nil
+}
+
+func (pp *profileParser) setVar(k, v string, level varLevel) {
+	if pp.levels[k] <= level {
+		pp.envVars[k], pp.levels[k] = v, level
+	}
+}
+
+func (pp *profileParser) parseAll(r io.Reader, dir string) ([]*Profile, error) {
+	if err := pp.parse(bufio.NewReader(r), dir, varLevelEnv); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+
+	if err := postProcessProfiles(pp.profiles); err != nil {
+		return nil, err
+	}
+
+	return pp.profiles, nil
+}
+
+// parse parses the requests in buf, dir is the directory of the file to resolve the relative paths.
+func (pp *profileParser) parse(buf *bufio.Reader, dir string, level varLevel) (err error) {
 	var p *Profile
 	var l string
 
-	envVars := EnvVars{}
-
 	var isEnv, hasFollower bool
 	for err == nil || len(l) > 0 {
 		if len(l) > 0 {
 			if strings.HasPrefix(l, "###") {
-				isEnv, hasFollower = regexFollows(envRegexp, l, envName)
+				isEnv, hasFollower = regexFollows(envRegexp, l, pp.envName)
 			} else if isEnv && hasFollower && !strings.HasPrefix(l, "#") {
 				if vars := exportRegexp.FindStringSubmatch(l); len(vars) > 0 {
-					envVars[vars[1]] = vars[2]
+					pp.setVar(vars[1], vars[2], level)
 				}
 			}
 
-			if !isEnv {
-				if p1 := processLine(p, l, envVars); p1 != p {
-					profiles = append(profiles, p1)
-					p = p1
-				}
+			var lerr error
+			if pp.scriptKind != 0 {
+				lerr = pp.scriptLine(p, l)
+			} else if !isEnv {
+				p, lerr = pp.processLine(p, l, dir, level)
+			}
+			if lerr != nil {
+				return lerr
 			}
 		}
 
@@ -277,18 +522,162 @@ func parseRequests(buf *bufio.Reader, envName string) (profiles []*Profile, err
 		l = strings.TrimSpace(l)
 	}
 
-	if err = postProcessProfiles(profiles); err != nil {
-		return nil, err
+	return err
+}
+
+func (pp *profileParser) processLine(p *Profile, l, dir string, level varLevel) (*Profile, error) {
+	if isScript, err := pp.scriptHead(p, l, dir); err != nil || isScript {
+		return p, err
+	}
+
+	if subs := includeRegexp.FindStringSubmatch(l); len(subs) > 0 {
+		// 引入文件之后的行，需要以新的请求开始
+		return nil, pp.include(filepath.Join(dir, pp.envVars.Eval(subs[1])))
+	}
+
+	if vars := exportRegexp.FindStringSubmatch(l); len(vars) > 0 && p == nil {
+		// 第一个请求之前的 export 对所有环境生效
+		pp.setVar(vars[1], vars[2], level)
+		return p, nil
 	}
 
-	return
+	if p1 := processLine(p, l, pp.envVars); p1 != p {
+		p1.dir = dir
+		p1.PreScript, pp.pendingPre = pp.pendingPre, nil
+		pp.profiles = append(pp.profiles, p1)
+		return p1, nil
+	}
+
+	return p, nil
+}
+
+// scriptHead parses the script lines like JetBrains HTTP client, < for the pre-request script before the request line,
+// and > for the post-response script after the request, inline like > {% ... %} or from file like > post.js.
+func (pp *profileParser) scriptHead(p *Profile, l, dir string) (bool, error) {
+	if !strings.HasPrefix(l, "< ") && !strings.HasPrefix(l, "> ") {
+		return false, nil
+	}
+
+	kind, rest := l[0], strings.TrimSpace(l[2:])
+	if strings.HasPrefix(rest, "{%") {
+		pp.scriptKind, pp.scriptBuf = kind, nil
+		return true, pp.scriptLine(p, rest[2:])
+	}
+
+	if !strings.HasSuffix(rest, ".js") {
+		return false, nil
+	}
+
+	file := rest
+	if !filepath.IsAbs(file) {
+		file = filepath.Join(dir, file)
+	}
+	s, err := script.Load(file)
+	if err != nil {
+		return true, err
+	}
+	return true, pp.setScript(p, kind, s)
+}
+
+// scriptLine collects the lines of the script block until %}.
+func (pp *profileParser) scriptLine(p *Profile, l string) error {
+	end := strings.HasSuffix(l, "%}")
+	pp.scriptBuf = append(pp.scriptBuf, strings.TrimSuffix(l, "%}"))
+	if !end {
+		return nil
+	}
+
+	kind, name := pp.scriptKind, "pre-request script"
+	if kind == '>' {
+		name = "post-response script"
+	}
+	if p != nil && kind == '>' {
+		name += " of " + p.Method + " " + p.URL
+	}
+	pp.scriptKind = 0
+
+	s, err := script.Compile(name, strings.Join(pp.scriptBuf, "\n"))
+	if err != nil {
+		return err
+	}
+	return pp.setScript(p, kind, s)
+}
+
+func (pp *profileParser) setScript(p *Profile, kind byte, s *script.Script) error {
+	if kind == '<' {
+		pp.pendingPre = s
+		return nil
+	}
+	if p == nil {
+		return fmt.Errorf("%s should be after a request", s)
+	}
+	p.PostScript = s
+	return nil
+}
+
+func (pp *profileParser) include(fileName string) error {
+	abs, err := filepath.Abs(fileName)
+	if err != nil {
+		return err
+	}
+	if pp.including[abs] {
+		return fmt.Errorf("circular @include %s", fileName)
+	}
+	pp.including[abs] = true
+	defer delete(pp.including, abs)
+
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return fmt.Errorf("@include %s: %w", fileName, err)
+	}
+
+	lastComments = nil
+	if IsCurlProfile(data) {
+		profiles, err := ParseCurlProfiles(bytes.NewReader(data))
+		if err != nil {
+			return fmt.Errorf("@include %s: %w", fileName, err)
+		}
+		pp.profiles = append(pp.profiles, profiles...)
+		return nil
+	}
+
+	if err := pp.parse(bufio.NewReader(bytes.NewReader(data)), filepath.Dir(fileName), varLevelInclude); err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	return nil
+}
+
+// resolveFileArg resolves the relative @file to the directory of the profile file if it exists there.
+func (p *Profile) resolveFileArg(v string) string {
+	if !strings.HasPrefix(v, "@") || p.dir == "" || filepath.IsAbs(v[1:]) {
+		return v
+	}
+	if f := filepath.Join(p.dir, v[1:]); filex.Exists(f) {
+		return "@" + f
+	}
+	return v
 }
 
 var tagRegexp = regexp.MustCompile(`\[.+]`)
 
+// evalHeaderRegexp matches the header values with variables, like Bearer @token.
+var evalHeaderRegexp = regexp.MustCompile(`(^|\s)@\w`)
+
 func postProcessProfiles(profiles []*Profile) error {
 	for _, p := range profiles {
+		for k, v := range p.Form {
+			// 兼容 field=@file 的写法，文件存在时作为上传文件，否则作为 eval 求值，例如 name=@姓名
+			if strings.HasPrefix(v, "@") && filex.Exists(p.resolveFileArg(v)[1:]) {
+				p.Files[k] = v[1:]
+				delete(p.Form, k)
+			}
+		}
+		for k, v := range p.Files {
+			p.Files[k] = strings.TrimPrefix(p.resolveFileArg("@"+v), "@")
+		}
+
 		if len(p.Body) > 0 {
+			p.Body = p.resolveFileArg(p.Body)
 			p.bodyFileName, p.bodyFileData, _ = ParseBodyArg(p.Body, false, false)
 
 			if p.Header[ContentTypeName] == "" && jj.Valid(p.Body) {
@@ -307,6 +696,13 @@ func postProcessProfiles(profiles []*Profile) error {
 			}
 		}
 
+		if p.Think != "" {
+			var err error
+			if p.thinkTime, err = thinktime.ParseThinkTime(p.Think); err != nil {
+				return fmt.Errorf("parse think %s: %w", p.Think, err)
+			}
+		}
+
 		if err := p.createHeader(); err != nil {
 			return err
 		}
@@ -317,6 +713,8 @@ func postProcessProfiles(profiles []*Profile) error {
 const (
 	ContentTypeName = "Content-Type"
 	ContentTypeJSON = "application/json;charset=utf-8"
+	// ContentTypeMultipart is the Content-Type to send the form fields as multipart/form-data.
+	ContentTypeMultipart = "multipart/form-data"
 )
 
 var headerReg = regexp.MustCompile(`(^\w+(?:-\w+)*)(==|:=|=|:|@)\s*(.*)$`)
@@ -344,6 +742,7 @@ func processLine(p *Profile, l string, envVars EnvVars) *Profile {
 			Header:   map[string]string{},
 			Query:    map[string]string{},
 			Form:     map[string]string{},
+			Files:    map[string]string{},
 			RawJSON:  map[string]string{},
 			EnvVars:  envVars,
 		}
@@ -356,6 +755,10 @@ func processLine(p *Profile, l string, envVars EnvVars) *Profile {
 		return p
 	}
 
+	if p == nil {
+		return p
+	}
+
 	p.Comments = append(p.Comments, lastComments...)
 	lastComments = nil
 
@@ -375,9 +778,10 @@ func processLine(p *Profile, l string, envVars EnvVars) *Profile {
 				// File upload fields: field@/dir/file, field@file;type=mime
 				// For example: screenshot@~/Pictures/img.png, cv@cv.txt;type=text/markdown
 				// the presence of a file field results in a --multipart request
-				p.Form[k] = "@" + v
+				p.Files[k] = v
 			case "=":
-				// Data Fields field=value, field=@file.txt
+				// Data Fields field=value, field=@姓名 (evaluated by eval),
+				// field=@file is still a file upload like field@file when the file exists
 				// Request Data fields to be serialized as a JSON object (default),
 				// to be form-encoded (with --form, -f),
 				// or to be serialized as multipart/form-Data (with --multipart)
@@ -0,0 +1,118 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProfileRunnable(t *testing.T) {
+	vars := Vars{"orderId": "1001", "empty": "", "off": "false"}
+
+	assert.True(t, (&Profile{}).Runnable(vars))
+	assert.True(t, (&Profile{Option: Option{If: "${orderId}"}}).Runnable(vars))
+	assert.True(t, (&Profile{Option: Option{If: "@orderId"}}).Runnable(vars))
+	assert.False(t, (&Profile{Option: Option{If: "!@orderId"}}).Runnable(vars))
+	assert.False(t, (&Profile{Option: Option{If: "${empty}"}}).Runnable(vars))
+	assert.False(t, (&Profile{Option: Option{If: "off"}}).Runnable(vars))
+	assert.False(t, (&Profile{Option: Option{If: "${missing}"}}).Runnable(nil))
+	assert.True(t, (&Profile{Option: Option{If: "!${missing}"}}).Runnable(nil))
+}
+
+func TestPickWeighted(t *testing.T) {
+	a := &Profile{Option: Option{Tag: "a", Weight: 3}}
+	b := &Profile{Option: Option{Tag: "b", Weight: 1}}
+
+	counts := map[string]int{}
+	for i := 0; i < 4000; i++ {
+		counts[PickWeighted([]*Profile{a, b}).Tag]++
+	}
+	assert.InDelta(t, 3000, counts["a"], 300)
+	assert.InDelta(t, 1000, counts["b"], 300)
+}
+
+func TestParseProfileFileInclude(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) {
+		assert.Nil(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644))
+	}
+	write("vars.env", "export host=vars\nexport port=1\nexport user=vars\n")
+	write("_common.http", "### env: test\nexport host=include\nexport port=2\n\n### [tag=login]\nGET http://a.cn/login\n")
+	write("body.json", `{"name":"bingoo"}`)
+	write("main.http", "@include _common.http\n\n### env: test\nexport port=3\n\n"+
+		"### [tag=1]\nPOST http://a.cn/users\nX-Host: ${host}\nX-Port: ${port}\nX-User: ${user}\n\n@body.json\n")
+
+	profiles, err := ParseProfileFile(filepath.Join(dir, "main.http"), &ProfileOption{
+		Env:      "test",
+		Vars:     map[string]string{"user": "cli"},
+		VarsFile: filepath.Join(dir, "vars.env"),
+	})
+	assert.Nil(t, err)
+	assert.Len(t, profiles, 2)
+	assert.Equal(t, "login", profiles[0].Tag)
+
+	p := profiles[1]
+	assert.Equal(t, "include", p.Header["X-Host"])
+	assert.Equal(t, "3", p.Header["X-Port"])
+	assert.Equal(t, "cli", p.Header["X-User"])
+	assert.Equal(t, `{"name":"bingoo"}`, string(p.bodyFileData))
+
+	write("loop.http", "@include loop.http\n")
+	_, err = ParseProfileFile(filepath.Join(dir, "loop.http"), &ProfileOption{})
+	assert.NotNil(t, err)
+}
+
+func TestParseTagInFile(t *testing.T) {
+	tag := ParseTag("login/1,order/2-3,report/,9")
+	assert.True(t, tag.ContainsIn("login", "1"))
+	assert.False(t, tag.ContainsIn("login", "2"))
+	assert.True(t, tag.ContainsIn("report", "any"))
+	assert.True(t, tag.ContainsIn("other", "9"))
+	assert.False(t, tag.ContainsIn("other", "1"))
+}
+
+func TestParseProfileScripts(t *testing.T) {
+	profiles, err := ParseProfiles(strings.NewReader(`
+### [tag=1]
+< {% request.headers["X-Sign"] = crypto.sha256(request.body) %}
+POST http://a.cn/orders
+
+{"name":"bingoo"}
+
+> {%
+vars.set("orderId", response.json.id)
+%}
+
+### [tag=2 if=${orderId}]
+GET http://a.cn/orders/@orderId
+`), "")
+	assert.Nil(t, err)
+	assert.Len(t, profiles, 2)
+	assert.NotNil(t, profiles[0].PreScript)
+	assert.NotNil(t, profiles[0].PostScript)
+	assert.Equal(t, `{"name":"bingoo"}`, profiles[0].Body)
+	assert.Nil(t, profiles[1].PreScript)
+	assert.Nil(t, profiles[1].PostScript)
+}
+
+func TestParseProfileFormFileCompat(t *testing.T) {
+	dir := t.TempDir()
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "a.png"), []byte("png"), 0o644))
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "form.http"), []byte(`
+###
+POST http://a.cn/upload
+file=@a.png
+name=@姓名
+id=@uuid
+`), 0o644))
+
+	profiles, err := ParseProfileFile(filepath.Join(dir, "form.http"), &ProfileOption{})
+	assert.Nil(t, err)
+	assert.Len(t, profiles, 1)
+	// 文件存在的 field=@file 仍然上传，其它作为 eval 求值的表单字段
+	assert.Equal(t, map[string]string{"file": filepath.Join(dir, "a.png")}, profiles[0].Files)
+	assert.Equal(t, map[string]string{"name": "@姓名", "id": "@uuid"}, profiles[0].Form)
+}
@@ -0,0 +1,235 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/bingoohuang/gg/pkg/ss"
+)
+
+// Exchange is a request and its response captured by the recording proxy.
+type Exchange struct {
+	Header    http.Header
+	RspHeader http.Header
+	Method    string
+	URL       string
+	Body      []byte
+	RspBody   []byte
+	Status    int
+}
+
+// 录制时不需要保留的请求头，由客户端自行生成，或者由 cookie jar 管理
+var recordSkipHeaders = map[string]bool{
+	"content-length": true, "connection": true, "keep-alive": true, "transfer-encoding": true,
+	"upgrade": true, "te": true, "accept-encoding": true, "cookie": true,
+	"proxy-connection": true, "proxy-authorization": true,
+}
+
+// dynamicKeyRegexp matches the JSON keys whose values are likely dynamic, like tokens and IDs.
+var dynamicKeyRegexp = regexp.MustCompile(`(?i)(token|session|ticket|jwt|uuid|nonce|(^|[a-z_])id)$`)
+
+var nonWordRegexp = regexp.MustCompile(`\W`)
+
+type dynamicValue struct {
+	name   string
+	path   string
+	value  string
+	source int
+}
+
+// ExchangesToProfileEntries converts the exchanges to profile entries, when extract is true,
+// the dynamic values like tokens and IDs in the JSON responses are detected, and when they are
+// used by the later requests, they are extracted by result.name=path and referenced by @name with eval.
+func ExchangesToProfileEntries(exchanges []*Exchange, extract bool) []*ProfileEntry {
+	entries := make([]*ProfileEntry, len(exchanges))
+	for i, x := range exchanges {
+		e := &ProfileEntry{
+			Options:  []string{fmt.Sprintf("tag=%d", i+1)},
+			Comments: []string{fmt.Sprintf("recorded status %d", x.Status)},
+			Method:   x.Method,
+			URL:      x.URL,
+			Body:     x.Body,
+		}
+
+		names := make([]string, 0, len(x.Header))
+		for k := range x.Header {
+			names = append(names, k)
+		}
+		sort.Strings(names)
+		for _, k := range names {
+			if !recordSkipHeaders[strings.ToLower(k)] {
+				e.Headers = append(e.Headers, [2]string{k, strings.Join(x.Header[k], ", ")})
+			}
+		}
+		entries[i] = e
+	}
+
+	if extract {
+		extractDynamicValues(exchanges, entries)
+	}
+
+	return entries
+}
+
+func extractDynamicValues(exchanges []*Exchange, entries []*ProfileEntry) {
+	// value -> the first response which produces it
+	known := map[string]*dynamicValue{}
+	used := map[string]bool{}
+	names := map[string]int{}
+
+	for i, x := range exchanges {
+		e := entries[i]
+		eval := false
+		for _, dv := range sortedDynamicValues(known) {
+			if replaceDynamicValue(e, dv) {
+				eval = true
+				if !used[dv.name] {
+					used[dv.name] = true
+					src := entries[dv.source]
+					src.Options = append(src.Options, "result."+dv.name+"="+dv.path)
+				}
+			}
+		}
+		if eval {
+			e.Options = append(e.Options, "eval")
+		}
+
+		if !strings.Contains(x.RspHeader.Get("Content-Type"), "json") {
+			continue
+		}
+
+		var v interface{}
+		if err := json.Unmarshal(x.RspBody, &v); err != nil {
+			continue
+		}
+
+		walkJSON(v, "", func(path, key, value string) {
+			if !dynamicKeyRegexp.MatchString(key) || len(value) < 3 || len(value) < 6 && !ss.IsDigits(value) {
+				return
+			}
+			// 相同的值，使用最先产生它的响应提取
+			if known[value] != nil {
+				return
+			}
+
+			name := nonWordRegexp.ReplaceAllString(key, "_")
+			// 同名的值来自不同的响应时，使用数字后缀区分
+			if n := names[name]; n > 0 {
+				names[name]++
+				name += strconv.Itoa(n + 1)
+			} else {
+				names[name] = 1
+			}
+			known[value] = &dynamicValue{name: name, path: path, value: value, source: i}
+		})
+	}
+}
+
+// sortedDynamicValues sorts the values with the longer ones first, to avoid replacing the prefixes.
+func sortedDynamicValues(known map[string]*dynamicValue) []*dynamicValue {
+	values := make([]*dynamicValue, 0, len(known))
+	for _, v := range known {
+		values = append(values, v)
+	}
+	sort.Slice(values, func(i, j int) bool {
+		if len(values[i].value) != len(values[j].value) {
+			return len(values[i].value) > len(values[j].value)
+		}
+		return values[i].value < values[j].value
+	})
+	return values
+}
+
+func replaceDynamicValue(e *ProfileEntry, dv *dynamicValue) bool {
+	ref := "@" + dv.name
+	replaced := false
+
+	// URL 中仅替换完整的路径段及查询参数值
+	if u, err := url.Parse(e.URL); err == nil {
+		segments := strings.Split(u.EscapedPath(), "/")
+		for i, s := range segments {
+			if s == url.PathEscape(dv.value) {
+				segments[i], replaced = ref, true
+			}
+		}
+		query := strings.Split(u.RawQuery, "&")
+		for i, q := range query {
+			if k, v, ok := strings.Cut(q, "="); ok && v == url.QueryEscape(dv.value) {
+				query[i], replaced = k+"="+ref, true
+			}
+		}
+		if replaced {
+			u.Path, u.RawPath, u.RawQuery = "", "", ""
+			e.URL = u.Scheme + "://" + u.Host + strings.Join(segments, "/") + queryString(query)
+		}
+	}
+
+	// 请求头中替换完整的值，或者 Bearer 之类的认证值
+	for i, h := range e.Headers {
+		switch {
+		case h[1] == dv.value:
+			e.Headers[i][1], replaced = ref, true
+		case strings.HasSuffix(h[1], " "+dv.value):
+			e.Headers[i][1], replaced = strings.TrimSuffix(h[1], dv.value)+ref, true
+		}
+	}
+
+	// 请求体中仅替换 JSON 字符串值
+	if quoted := `"` + dv.value + `"`; strings.Contains(string(e.Body), quoted) {
+		e.Body, replaced = []byte(strings.ReplaceAll(string(e.Body), quoted, `"`+ref+`"`)), true
+	}
+
+	return replaced
+}
+
+func queryString(query []string) string {
+	if q := strings.Join(query, "&"); q != "" {
+		return "?" + q
+	}
+	return ""
+}
+
+// walkJSON walks the leaf values of the JSON with their jj paths, like data.items.0.id.
+func walkJSON(v interface{}, path string, f func(path, key, value string)) {
+	join := func(key string) string {
+		if path == "" {
+			return key
+		}
+		return path + "." + key
+	}
+
+	switch x := v.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(x))
+		for k := range x {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if strings.ContainsAny(k, ".*?|#@\\ ") {
+				continue
+			}
+			vv := x[k]
+			switch leaf := vv.(type) {
+			case string:
+				f(join(k), k, leaf)
+			case float64:
+				if leaf == float64(int64(leaf)) {
+					f(join(k), k, strconv.FormatInt(int64(leaf), 10))
+				}
+			default:
+				walkJSON(vv, join(k), f)
+			}
+		}
+	case []interface{}:
+		for i, vv := range x {
+			walkJSON(vv, join(strconv.Itoa(i)), f)
+		}
+	}
+}
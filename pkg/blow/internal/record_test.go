@@ -0,0 +1,35 @@
+package internal
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExchangesToProfileEntries(t *testing.T) {
+	jsonHeader := http.Header{"Content-Type": {"application/json"}}
+	exchanges := []*Exchange{
+		{
+			Method: "POST", URL: "http://a.cn/login", Body: []byte(`{"user":"bingoo"}`),
+			Header: http.Header{"Content-Type": {"application/json"}, "Cookie": {"a=b"}},
+			Status: 200, RspHeader: jsonHeader, RspBody: []byte(`{"data":{"token":"abcdef123456","userId":"u98765432"}}`),
+		},
+		{
+			Method: "GET", URL: "http://a.cn/users/u98765432?x=1",
+			Header: http.Header{"Authorization": {"Bearer abcdef123456"}},
+			Status: 200, RspHeader: jsonHeader, RspBody: []byte(`{}`),
+		},
+	}
+
+	entries := ExchangesToProfileEntries(exchanges, true)
+	assert.Equal(t, []string{"tag=1", "result.token=data.token", "result.userId=data.userId"}, entries[0].Options)
+	assert.Equal(t, [][2]string{{"Content-Type", "application/json"}}, entries[0].Headers)
+	assert.Equal(t, []string{"tag=2", "eval"}, entries[1].Options)
+	assert.Equal(t, "http://a.cn/users/@userId?x=1", entries[1].URL)
+	assert.Equal(t, [][2]string{{"Authorization", "Bearer @token"}}, entries[1].Headers)
+
+	entries = ExchangesToProfileEntries(exchanges, false)
+	assert.Equal(t, []string{"tag=2"}, entries[1].Options)
+	assert.Equal(t, "http://a.cn/users/u98765432?x=1", entries[1].URL)
+}
@@ -0,0 +1,136 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ReplayEntry is a request recorded in the access log.
+type ReplayEntry struct {
+	Time    time.Time
+	Header  map[string]string
+	Method  string
+	URL     string
+	Body    string
+	Status  int
+	Latency time.Duration
+}
+
+// nginx/Apache combined 日志格式，可选的末尾请求耗时（秒），例如 nginx 的 $request_time
+// 127.0.0.1 - - [10/Oct/2023:13:55:36 +0800] "GET /users/1 HTTP/1.1" 200 2326 "http://a.cn/" "Mozilla/5.0" 0.012
+var combinedLogRegexp = regexp.MustCompile(
+	`^\S+ \S+ \S+ \[([^\]]+)\] "(\S+) (\S+)(?: [^"]*)?" (\d{3}) \S+(?: "([^"]*)" "([^"]*)")?(.*)$`)
+
+var trailingSecondsRegexp = regexp.MustCompile(`(?:^|\s)(\d+\.\d+)\s*$`)
+
+// ParseReplayLine parses a line of nginx/Apache combined log, or a JSON line like
+// {"time":"2023-10-10T13:55:36+08:00","method":"POST","url":"/users","headers":{"K":"V"},"body":"{}","status":200,"latency":0.012},
+// time can also be unix seconds, latency is in seconds.
+func ParseReplayLine(line string) (*ReplayEntry, error) {
+	if line = strings.TrimSpace(line); strings.HasPrefix(line, "{") {
+		return parseReplayJSON(line)
+	}
+
+	subs := combinedLogRegexp.FindStringSubmatch(line)
+	if len(subs) == 0 {
+		return nil, fmt.Errorf("unknown access log format: %s", line)
+	}
+
+	t, err := time.Parse("02/Jan/2006:15:04:05 -0700", subs[1])
+	if err != nil {
+		return nil, fmt.Errorf("parse time %s: %w", subs[1], err)
+	}
+
+	e := &ReplayEntry{Time: t, Method: subs[2], URL: subs[3], Header: map[string]string{}}
+	e.Status, _ = strconv.Atoi(subs[4])
+	if v := subs[5]; v != "" && v != "-" {
+		e.Header["Referer"] = v
+	}
+	if v := subs[6]; v != "" && v != "-" {
+		e.Header["User-Agent"] = v
+	}
+	if m := trailingSecondsRegexp.FindStringSubmatch(subs[7]); len(m) > 0 {
+		seconds, _ := strconv.ParseFloat(m[1], 64)
+		e.Latency = time.Duration(seconds * float64(time.Second))
+	}
+
+	return e, nil
+}
+
+func parseReplayJSON(line string) (*ReplayEntry, error) {
+	var j struct {
+		Time    interface{}       `json:"time"`
+		Headers map[string]string `json:"headers"`
+		Method  string            `json:"method"`
+		URL     string            `json:"url"`
+		Body    string            `json:"body"`
+		Status  int               `json:"status"`
+		Latency float64           `json:"latency"`
+	}
+	if err := json.Unmarshal([]byte(line), &j); err != nil {
+		return nil, fmt.Errorf("parse replay JSON %s: %w", line, err)
+	}
+	if j.URL == "" {
+		return nil, fmt.Errorf("no url in replay JSON %s", line)
+	}
+
+	e := &ReplayEntry{
+		Method:  strings.ToUpper(j.Method),
+		URL:     j.URL,
+		Header:  j.Headers,
+		Body:    j.Body,
+		Status:  j.Status,
+		Latency: time.Duration(j.Latency * float64(time.Second)),
+	}
+	if e.Method == "" {
+		e.Method = "GET"
+	}
+	if e.Header == nil {
+		e.Header = map[string]string{}
+	}
+
+	switch t := j.Time.(type) {
+	case float64:
+		e.Time = time.Unix(0, int64(t*float64(time.Second)))
+	case string:
+		var err error
+		if e.Time, err = time.Parse(time.RFC3339Nano, t); err != nil {
+			return nil, fmt.Errorf("parse time %s: %w", t, err)
+		}
+	}
+
+	return e, nil
+}
+
+var (
+	uuidSegment = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+	hexSegment  = regexp.MustCompile(`^[0-9a-fA-F]{16,}$`)
+	numSegment  = regexp.MustCompile(`^\d+$`)
+)
+
+// URLPattern generalizes the URL path to a pattern, like /users/123/orders?x=1 to /users/{id}/orders.
+func URLPattern(rawURL string) string {
+	path := rawURL
+	if u, err := url.Parse(rawURL); err == nil {
+		path = u.Path
+	}
+
+	segments := strings.Split(path, "/")
+	for i, s := range segments {
+		switch {
+		case numSegment.MatchString(s):
+			segments[i] = "{id}"
+		case uuidSegment.MatchString(s):
+			segments[i] = "{uuid}"
+		case hexSegment.MatchString(s):
+			segments[i] = "{hex}"
+		}
+	}
+
+	return strings.Join(segments, "/")
+}
@@ -0,0 +1,28 @@
+package internal
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseReplayLine(t *testing.T) {
+	e, err := ParseReplayLine(`127.0.0.1 - - [10/Oct/2023:13:55:36 +0800] "GET /users/1?x=1 HTTP/1.1" 404 2326 "-" "curl/8.0" 0.012`)
+	assert.Nil(t, err)
+	assert.Equal(t, "GET", e.Method)
+	assert.Equal(t, "/users/1?x=1", e.URL)
+	assert.Equal(t, 404, e.Status)
+	assert.Equal(t, 12*time.Millisecond, e.Latency)
+	assert.Equal(t, map[string]string{"User-Agent": "curl/8.0"}, e.Header)
+	assert.Equal(t, int64(1696917336), e.Time.Unix())
+
+	e, err = ParseReplayLine(`{"time":1696917336.5,"method":"post","url":"/users","body":"{}","status":200}`)
+	assert.Nil(t, err)
+	assert.Equal(t, "POST", e.Method)
+	assert.Equal(t, "{}", e.Body)
+	assert.Equal(t, int64(1696917336500), e.Time.UnixMilli())
+
+	assert.Equal(t, "/users/{id}/orders/{uuid}",
+		URLPattern("/users/123/orders/0b9a2c3e-56b8-4d1f-9a8e-3f2c4b5a6d7e?x=1"))
+}
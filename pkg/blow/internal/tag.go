@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/bingoohuang/berf/pkg/util"
@@ -23,9 +25,16 @@ type Tag struct {
 
 func (t Tag) String() string { return t.Raw }
 
-func (t *Tag) Contains(s string) bool {
+func (t *Tag) Contains(s string) bool { return t.ContainsIn("", s) }
+
+// ContainsIn tells whether the tag s of the profile in the file (base name without extension) is selected.
+func (t *Tag) ContainsIn(file, s string) bool {
 	for _, value := range t.Values {
-		if value.Contains(s) {
+		if fv, ok := value.(*FileValue); ok {
+			if strings.EqualFold(fv.File, file) && (fv.Value == nil || fv.Value.Contains(s)) {
+				return true
+			}
+		} else if value.Contains(s) {
 			return true
 		}
 	}
@@ -33,6 +42,16 @@ func (t *Tag) Contains(s string) bool {
 	return false
 }
 
+// FileValue is a tag value qualified by the profile file in a directory suite,
+// like order/1-3 for tag 1 to 3 in order.http, or order/ for all in order.http.
+type FileValue struct {
+	File string
+	// Value is nil for all the profiles in the file.
+	Value TagValue
+}
+
+func (v *FileValue) Contains(s string) bool { return v.Value == nil || v.Value.Contains(s) }
+
 type SingleValue struct {
 	Value string
 }
@@ -67,17 +86,28 @@ func ParseTag(s string) *Tag {
 	tag := &Tag{Raw: s}
 	parts := ss.Split(s, ss.WithSeps(","), ss.WithTrimSpace(true), ss.WithIgnoreEmpty(true))
 	for _, part := range parts {
-		p := strings.Index(part, "-")
-		if p < 0 {
-			tag.Values = append(tag.Values, &SingleValue{Value: part})
+		if file, value, ok := strings.Cut(part, "/"); ok {
+			fv := &FileValue{File: file}
+			if value != "" {
+				fv.Value = parseTagValue(value)
+			}
+			tag.Values = append(tag.Values, fv)
 		} else {
-			tag.Values = append(tag.Values, NewRangeValue(part[:p], part[p+1:]))
+			tag.Values = append(tag.Values, parseTagValue(part))
 		}
 	}
 
 	return tag
 }
 
+func parseTagValue(part string) TagValue {
+	p := strings.Index(part, "-")
+	if p < 0 {
+		return &SingleValue{Value: part}
+	}
+	return NewRangeValue(part[:p], part[p+1:])
+}
+
 func NewRangeValue(a, b string) TagValue {
 	r := &RangeValue{
 		From:    strings.TrimSpace(a),
@@ -101,7 +131,7 @@ func NewRangeValue(a, b string) TagValue {
 	return r
 }
 
-func ParseProfileArg(profileArg []string, envName string) []*Profile {
+func ParseProfileArg(profileArg []string, opt *ProfileOption) []*Profile {
 	var profiles []*Profile
 	hasNew := false
 	var tag *Tag
@@ -123,12 +153,29 @@ func ParseProfileArg(profileArg []string, envName string) []*Profile {
 			osx.Exit("profile "+p+" doesn't exist", 1)
 		}
 
-		pp, err := ParseProfileFile(p, envName)
-		osx.ExitIfErr(err)
+		// 目录作为一个测试套件，按照文件名顺序运行其中所有的 .http 文件，_ 开头的文件仅用于 @include
+		files := []string{p}
+		if stat, err := os.Stat(p); err == nil && stat.IsDir() {
+			matches, err := filepath.Glob(filepath.Join(p, "*.http"))
+			osx.ExitIfErr(err)
+			files = files[:0]
+			for _, m := range matches {
+				if !strings.HasPrefix(filepath.Base(m), "_") {
+					files = append(files, m)
+				}
+			}
+			sort.Strings(files)
+		}
+
+		for _, f := range files {
+			pp, err := ParseProfileFile(f, opt)
+			osx.ExitIfErr(err)
 
-		for _, p1 := range pp {
-			if tag == nil || tag.Contains(p1.Tag) {
-				profiles = append(profiles, p1)
+			base := strings.TrimSuffix(filepath.Base(f), filepath.Ext(f))
+			for _, p1 := range pp {
+				if tag == nil || tag.ContainsIn(base, p1.Tag) {
+					profiles = append(profiles, p1)
+				}
 			}
 		}
 	}
@@ -0,0 +1,135 @@
+package internal
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+// ConnTrace is the trace of a connection, for the reuse counting and the latency phases.
+// A pooled keep-alive connection is handed over to other goroutines once its response is read,
+// so the timing of every request is kept in its own RequestTrace, instead of in the ConnTrace shared by the requests.
+type ConnTrace struct {
+	// DNS, Connect and TLS are the latencies of establishing the connection,
+	// Resolved tells the host is resolved by the dialer, so that DNS is known.
+	// They are set in the dialing, before the connection is used by any request.
+	DNS, Connect, TLS time.Duration
+	Resolved          bool
+
+	// counted is the number of the requests counted by CountRequest above the TLS layer, updated atomically.
+	counted int32
+	// timer times the requests on the connection, only for the latency phases (-phases).
+	timer *requestTimer
+}
+
+// RequestTrace is the timing of a request on the connection.
+type RequestTrace struct {
+	// Seq is the sequence of the request on the connection, 1 for the first request on a new connection.
+	Seq int
+	// WriteStart and WriteEnd are the time of writing the request,
+	// FirstByte is the time of reading the first byte of its response.
+	WriteStart, WriteEnd, FirstByte time.Time
+}
+
+type requestTimer struct {
+	mu       sync.Mutex
+	requests int
+	current  *RequestTrace
+}
+
+// begin starts the timing of a new request on the connection.
+func (t *requestTimer) begin() *RequestTrace {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.requests++
+	t.current = &RequestTrace{Seq: t.requests}
+	return t.current
+}
+
+func (t *requestTimer) write(start, end time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if r := t.current; r != nil && r.FirstByte.IsZero() {
+		if r.WriteStart.IsZero() {
+			r.WriteStart = start
+		}
+		r.WriteEnd = end
+	}
+}
+
+func (t *requestTimer) read(end time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if r := t.current; r != nil && r.FirstByte.IsZero() && !r.WriteStart.IsZero() {
+		r.FirstByte = end
+	}
+}
+
+// snapshot copies the timing of the request.
+func (t *requestTimer) snapshot(r *RequestTrace) RequestTrace {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return *r
+}
+
+// HandshakeDone records the TLS (or TLCP) handshake latency of the dialing,
+// the handshake is done before any request is begun, so its messages are not timed as a request.
+func (c *MyConn) HandshakeDone(d time.Duration) {
+	c.trace.TLS = d
+}
+
+// traceAddr is the local address of a traced connection, by which the trace is found from fasthttp.Response.LocalAddr.
+type traceAddr struct {
+	net.Addr
+	trace *ConnTrace
+	// request is the timing of the request which the address is got for, nil when the requests are not timed.
+	request *RequestTrace
+}
+
+// GetConnTrace returns the trace of the connection by its local address, nil if the connection is not traced.
+func GetConnTrace(addr net.Addr) *ConnTrace {
+	if a, ok := addr.(*traceAddr); ok {
+		return a.trace
+	}
+	return nil
+}
+
+// GetRequestTrace returns the trace of the connection and a copy of the timing of the request by the local address
+// got from fasthttp.Response.LocalAddr, ok is false when the requests of the connection are not timed.
+func GetRequestTrace(addr net.Addr) (t *ConnTrace, r RequestTrace, ok bool) {
+	a, ok := addr.(*traceAddr)
+	if !ok || a.request == nil {
+		return nil, r, false
+	}
+	return a.trace, a.trace.timer.snapshot(a.request), true
+}
+
+// DNSLookuper is the connection which knows the DNS lookup latency of its dialing.
+type DNSLookuper interface {
+	DNSLookup() time.Duration
+}
+
+// PhaseTraceDial is the ThroughputStatDial with the connections traced for the latency phases of dialing and requests.
+func PhaseTraceDial(wrap NetworkWrapper, dial fasthttp.DialFunc, r, w *int64) fasthttp.DialFunc {
+	return func(addr string) (net.Conn, error) {
+		t1 := time.Now()
+		conn, err := dial(addr)
+		if err != nil {
+			return nil, err
+		}
+
+		trace := &ConnTrace{Connect: time.Since(t1), timer: &requestTimer{}}
+		if l, ok := conn.(DNSLookuper); ok {
+			trace.DNS, trace.Resolved = l.DNSLookup(), true
+			trace.Connect -= trace.DNS
+		}
+
+		return newMyConn(wrap(conn), r, w, trace), nil
+	}
+}
@@ -0,0 +1,85 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ProfileEntry is a request to be written as a profile entry, like the ones in demo.http.
+type ProfileEntry struct {
+	// Options like tag=1, eval, think=1s, result.id=data.id
+	Options  []string
+	Comments []string
+	Method   string
+	URL      string
+	Headers  [][2]string
+	// Fields are httpie like request items, e.g. name=value, file@a.png
+	Fields []string
+	Body   []byte
+}
+
+// WriteProfileEntries writes the entries as profiles which can be parsed by ParseProfiles.
+// JSON object bodies are written inline in one line, others are written to the files named
+// like bodyFilePrefix.1.body and referenced by @file relative to profileDir, the directory of the profile written,
+// or referenced as bodyFilePrefix is when profileDir is empty.
+func WriteProfileEntries(w io.Writer, entries []*ProfileEntry, bodyFilePrefix, profileDir string) error {
+	b := &strings.Builder{}
+	for i, e := range entries {
+		for _, c := range e.Comments {
+			fmt.Fprintf(b, "# %s\n", c)
+		}
+		fmt.Fprintf(b, "### [%s]\n", strings.Join(e.Options, " "))
+		fmt.Fprintf(b, "%s %s\n", strings.ToUpper(e.Method), e.URL)
+		for _, h := range e.Headers {
+			fmt.Fprintf(b, "%s: %s\n", h[0], h[1])
+		}
+		for _, f := range e.Fields {
+			fmt.Fprintf(b, "%s\n", f)
+		}
+
+		if len(e.Body) > 0 {
+			b.WriteString("\n")
+			// 解析时请求体的换行会被去掉，因此 JSON 对象请求体压缩为一行后内联，其它的请求体写入文件，以 @file 引用
+			if compacted := (&bytes.Buffer{}); json.Compact(compacted, e.Body) == nil && bytes.HasPrefix(compacted.Bytes(), []byte("{")) {
+				b.Write(compacted.Bytes())
+				b.WriteString("\n")
+			} else {
+				bodyFile := fmt.Sprintf("%s.%d.body", bodyFilePrefix, i+1)
+				if err := os.WriteFile(bodyFile, e.Body, 0o644); err != nil {
+					return fmt.Errorf("write body file %s: %w", bodyFile, err)
+				}
+				fmt.Fprintf(b, "@%s\n", bodyFileRef(bodyFile, profileDir))
+			}
+		}
+		b.WriteString("\n")
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// bodyFileRef references the body file by the path relative to the profileDir,
+// since the @file of a profile is resolved against the directory of the profile first.
+func bodyFileRef(bodyFile, profileDir string) string {
+	if profileDir == "" {
+		return bodyFile
+	}
+
+	absFile, err := filepath.Abs(bodyFile)
+	if err != nil {
+		return bodyFile
+	}
+	absDir, err := filepath.Abs(profileDir)
+	if err != nil {
+		return absFile
+	}
+	if rel, err := filepath.Rel(absDir, absFile); err == nil {
+		return rel
+	}
+	return absFile
+}
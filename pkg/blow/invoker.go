@@ -7,6 +7,7 @@ import (
 	"crypto/tls"
 	"crypto/x509"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -49,6 +50,40 @@ type Invoker struct {
 	pieBody    *HttpieArgBody
 	opt        *Opt
 	uploadChan chan *internal.UploadChanValue
+	// sharedState is the state shared by the initial invocations outside any virtual user.
+	sharedState *vuState
+	tokenAuth   *tokenAuth
+	replay      *replayer
+	handshake   *handshakeBench
+	tlcp        *tlcpClient
+	proxies     *proxyPool
+	// dialer dials the connections, with the DNS options of -resolve and -dns.*.
+	dialer Dialer
+	// dialSubs are the sub operations in the dialers, like TLCP handshakes and proxy tunnels.
+	dialSubs subRecorder
+	// dialLimit limits the rate of dialing new connections by -conn.rate.
+	dialLimit *dialLimiter
+	// holder holds the idle connections of -hold alongside the requests.
+	holder *holder
+	// pipeline sends the requests pipelined by -pipeline instead of the HTTP client.
+	pipeline *pipeliner
+	// retryStats are the counters of the retries by -retry.
+	retryStats retryStats
+	// started is the time of the invoker created, to calculate the rate of new connections.
+	started time.Time
+
+	// signer is the default signer, namedSigners are selected by the profile option sign=name.
+	signer       Signer
+	namedSigners map[string]Signer
+	signers      map[*internal.Profile]Signer
+
+	// digest is the credential of -auth digest:user:pass, digests are the ones of the profiles.
+	digest  *digestCred
+	digests map[*internal.Profile]*digestCred
+
+	// identities are the client certs of -cert pool, assigned to the virtual users by pickIdentity.
+	identities    []*clientIdentity
+	identityIndex uint32
 
 	httpInvoke      func(*fasthttp.Request, *fasthttp.Response) error
 	uploadFileField string
@@ -61,8 +96,25 @@ type Invoker struct {
 }
 
 func NewInvoker(ctx context.Context, opt *Opt) (*Invoker, error) {
-	r := &Invoker{opt: opt}
+	r := &Invoker{opt: opt, started: time.Now()}
 	r.printLock = NewConditionalLock(r.opt.printOption > 0)
+	r.sharedState = r.newVUState(0)
+	r.sharedState.shared = true
+
+	var err error
+	if r.tokenAuth, err = parseTokenAuth(*pToken, opt); err != nil {
+		return nil, err
+	}
+	if r.signer, r.namedSigners, err = parseSigners(*pSign); err != nil {
+		return nil, err
+	}
+	if err = r.profileSigners(opt.profiles); err != nil {
+		return nil, err
+	}
+	if strings.HasPrefix(opt.auth, "digest:") {
+		r.digest = parseDigestCred(opt.auth)
+	}
+	r.profileDigests(opt.profiles)
 
 	header, err := r.buildRequestClient(ctx, opt)
 	if err != nil {
@@ -93,6 +145,17 @@ func NewInvoker(ctx context.Context, opt *Opt) (*Invoker, error) {
 		}
 	}
 
+	if opt.replay != nil {
+		if r.replay, err = newReplayer(ctx, opt.replay); err != nil {
+			return nil, err
+		}
+	}
+	if opt.tlsBench != "" {
+		if r.handshake, err = r.newHandshakeBench(opt); err != nil {
+			return nil, err
+		}
+	}
+
 	if r.upload != "" {
 		uploadReader := internal.CreateFileReader(r.uploadFileField, r.upload, r.opt.saveRandDir, r.opt.ant)
 		r.uploadChan = make(chan *internal.UploadChanValue)
@@ -132,7 +195,7 @@ func (r *Invoker) buildRequestClient(ctx context.Context, opt *Opt) (*fasthttp.R
 		return nil, err
 	}
 
-	usingTLCP := u.Scheme == "https" && env.Bool("TLCP", false)
+	usingTLCP := u.Scheme == "https" && opt.useTLCP()
 	if usingTLCP {
 		u.Scheme = "http"
 		if u.Port() == "" {
@@ -142,33 +205,147 @@ func (r *Invoker) buildRequestClient(ctx context.Context, opt *Opt) (*fasthttp.R
 
 	r.isTLS = u.Scheme == "https"
 
-	cli := &fasthttp.Client{
-		Name:         "blow",
-		ReadTimeout:  opt.readTimeout,
-		WriteTimeout: opt.writeTimeout,
-		// 在从主机连接池获取连接时，总是优先创建新的链接，直到 MaxGreedyConnsPerHost 为止
-		MaxGreedyConnsPerHost: env.Int("MAX_GREEDY_CONNS_PER_HOST", 0),
-		// 主机最大连接池大小
-		MaxConnsPerHost: env.Int("MAX_CONNS_PER_HOST", fasthttp.DefaultMaxConnsPerHost),
-		// 最大连接空闲时间（超时会被回收）
-		MaxIdleConnDuration: util.EnvDuration("MAX_IDLE_CONN_DURATION", fasthttp.DefaultMaxIdleConnDuration),
+	tlsConfig, err := opt.buildTLSConfig()
+	if err != nil {
+		return nil, err
 	}
-
-	if cli.MaxConnsPerHost < cli.MaxGreedyConnsPerHost {
-		cli.MaxConnsPerHost = cli.MaxGreedyConnsPerHost
+	if usingTLCP {
+		r.tlcp = &tlcpClient{subs: &r.dialSubs}
+		if r.tlcp.config, err = opt.buildTLCPConfig(u.Hostname()); err != nil {
+			return nil, err
+		}
+		if r.tlcp.pins, err = parseTLCPPins(opt.tlcp.pin); err != nil {
+			return nil, err
+		}
 	}
 
-	cli.Dial = ProxyHTTPDialerTimeout(opt.dialTimeout, dialer, r.isTLS)
+	if opt.proxy != "" {
+		if r.proxies, err = parseProxyPool(opt.proxy, opt.proxyPick, opt.proxyPer, &r.dialSubs); err != nil {
+			return nil, err
+		}
+		if r.proxies.perVU && isClientCertPool(opt.certPath) {
+			return nil, fmt.Errorf("-proxy.per vu can not be used with the client cert pool of -cert")
+		}
+	}
 
-	wrap := internal.NetworkWrap(opt.network)
-	cli.Dial = internal.ThroughputStatDial(wrap, cli.Dial, &r.readBytes, &r.writeBytes)
-	if usingTLCP {
-		cli.Dial = createTlcpDialer(ctx, cli.Dial, r.opt.certPath, r.opt.HasPrintOption, r.opt.tlsVerify)
+	if r.dialer, err = opt.buildDialer(&r.dialSubs); err != nil {
+		return nil, err
 	}
 
-	if cli.TLSConfig, err = opt.buildTLSConfig(); err != nil {
+	wrap, err := internal.NetworkWrap(opt.network)
+	if err != nil {
 		return nil, err
 	}
+	if opt.conn.rate > 0 {
+		r.dialLimit = newDialLimiter(opt.conn.rate)
+	}
+
+	// baseDial creates the dial of the plain connections, through the proxy px of the pool when it is not nil.
+	baseDial := func(px *poolProxy) fasthttp.DialFunc {
+		var dial fasthttp.DialFunc
+		switch {
+		case opt.unixSocket != "":
+			dial = unixDialer(opt.unixSocket, opt.dialTimeout)
+		case r.proxies != nil:
+			dial = r.proxies.dialer(px, r.dialer, opt.dialTimeout)
+		default:
+			dial = ProxyHTTPDialerTimeout(opt.dialTimeout, r.dialer, r.isTLS)
+		}
+		if r.dialLimit != nil {
+			dial = r.dialLimit.dialer(dial)
+		}
+		return dial
+	}
+
+	// newClient creates a client with its own connection pool, through the proxy px of the pool when it is not nil.
+	newClient := func(tlsConfig *tls.Config, px *poolProxy) *fasthttp.Client {
+		cli := &fasthttp.Client{
+			Name:         "blow",
+			TLSConfig:    tlsConfig,
+			ReadTimeout:  opt.readTimeout,
+			WriteTimeout: opt.writeTimeout,
+			// 在从主机连接池获取连接时，总是优先创建新的链接，直到 MaxGreedyConnsPerHost 为止
+			MaxGreedyConnsPerHost: env.Int("MAX_GREEDY_CONNS_PER_HOST", 0),
+			// 主机最大连接池大小
+			MaxConnsPerHost: env.Int("MAX_CONNS_PER_HOST", fasthttp.DefaultMaxConnsPerHost),
+			// 最大连接空闲时间（超时会被回收）
+			MaxIdleConnDuration: util.EnvDuration("MAX_IDLE_CONN_DURATION", fasthttp.DefaultMaxIdleConnDuration),
+			// 连接最大存活时间，超过后在当前请求完成时关闭
+			MaxConnDuration: opt.conn.lifetime,
+		}
+
+		if cli.MaxConnsPerHost < cli.MaxGreedyConnsPerHost {
+			cli.MaxConnsPerHost = cli.MaxGreedyConnsPerHost
+		}
+
+		cli.Dial = baseDial(px)
+		if opt.phases {
+			cli.Dial = internal.PhaseTraceDial(wrap, cli.Dial, &r.readBytes, &r.writeBytes)
+		} else {
+			cli.Dial = internal.ThroughputStatDial(wrap, cli.Dial, &r.readBytes, &r.writeBytes)
+		}
+		// 分阶段计时或按请求数关闭连接时，在拨号中完成 TLS 握手，以便计时或在明文上添加请求头
+		if r.isTLS && (opt.phases || opt.conn.requests > 0) {
+			cli.Dial = tlsDialer(cli.Dial, tlsConfig, opt.dialTimeout)
+		}
+		if usingTLCP {
+			cli.Dial = r.tlcp.dialer(ctx, cli.Dial)
+		}
+		if opt.conn.requests > 0 {
+			cli.Dial = churnDialer(cli.Dial, opt.conn.requests)
+		}
+		return cli
+	}
+
+	r.httpInvoke = r.clientInvoke(newClient(tlsConfig, nil))
+	if r.proxies != nil && r.proxies.perVU {
+		for _, px := range r.proxies.proxies {
+			px.invoke = r.clientInvoke(newClient(tlsConfig, px))
+		}
+		r.sharedState.proxy = r.pickProxy()
+	}
+
+	// connDial creates the dial of the connections established with TLS (or TLCP) if any, used out of the HTTP clients.
+	connDial := func() fasthttp.DialFunc {
+		dial := internal.ThroughputStatDial(wrap, baseDial(nil), &r.readBytes, &r.writeBytes)
+		if r.isTLS {
+			dial = tlsDialer(dial, tlsConfig, opt.dialTimeout)
+		}
+		if usingTLCP {
+			dial = r.tlcp.dialer(ctx, dial)
+		}
+		return dial
+	}
+	if opt.hold.n > 0 {
+		if r.holder, err = newHolder(opt, connDial(), &r.dialSubs); err != nil {
+			return nil, err
+		}
+	}
+	if opt.pipeline.depth > 0 {
+		if r.proxies != nil && r.proxies.perVU || opt.certPath != "" && isClientCertPool(opt.certPath) {
+			return nil, fmt.Errorf("-pipeline can not be used with -proxy.per vu or the client cert pool of -cert")
+		}
+		if r.pipeline, err = newPipeliner(opt, connDial(), r.isTLS, &r.dialSubs); err != nil {
+			return nil, err
+		}
+		r.httpInvoke = r.pipeline.Do
+	}
+
+	if opt.certPath != "" && isClientCertPool(opt.certPath) {
+		if r.identities, err = loadClientIdentities(opt.certPath, opt.keyPath); err != nil {
+			return nil, err
+		}
+		for _, id := range r.identities {
+			// 每个身份单独的 TLS 配置，避免会话缓存在不同身份间复用
+			c, err := opt.buildTLSConfig()
+			if err != nil {
+				return nil, err
+			}
+			c.Certificates = []tls.Certificate{id.cert}
+			id.invoke = r.clientInvoke(newClient(c, nil))
+		}
+		r.sharedState.identity = r.pickIdentity()
+	}
 
 	r.pieArg = parseHttpieLikeArgs(fla9.Args())
 
@@ -221,7 +398,7 @@ func (r *Invoker) buildRequestClient(ctx context.Context, opt *Opt) (*fasthttp.R
 		h.Set(ss.Split2(hdr, ss.WithSeps(":")))
 	}
 
-	if opt.auth != "" {
+	if opt.auth != "" && r.digest == nil {
 		b := opt.auth
 		if c, err := b64.DecodeString(b); err != nil { // check if it is already set by base64 encoded
 			b, _ = b64.EncodeString(b)
@@ -238,15 +415,16 @@ func (r *Invoker) buildRequestClient(ctx context.Context, opt *Opt) (*fasthttp.R
 		h.Set("Connection", "close")
 	}
 
+	return &h, nil
+}
+
+func (r *Invoker) clientInvoke(cli *fasthttp.Client) func(*fasthttp.Request, *fasthttp.Response) error {
 	if r.opt.doTimeout == 0 {
-		r.httpInvoke = cli.Do
-	} else {
-		r.httpInvoke = func(req *fasthttp.Request, rsp *fasthttp.Response) error {
-			return cli.DoTimeout(req, rsp, r.opt.doTimeout)
-		}
+		return cli.Do
+	}
+	return func(req *fasthttp.Request, rsp *fasthttp.Response) error {
+		return cli.DoTimeout(req, rsp, r.opt.doTimeout)
 	}
-
-	return &h, nil
 }
 
 var envHosts = func() []string {
@@ -274,8 +452,26 @@ func (r *Invoker) Run(ctx context.Context, bc *berf.Config, initial bool) (*berf
 		req.ConnAcquiredCallback = nil
 	}
 
+	if r.replay != nil {
+		if initial {
+			return nil, nil
+		}
+		return r.runReplay(ctx, req, resp)
+	}
+
+	if r.handshake != nil {
+		if initial {
+			return nil, nil
+		}
+		rr, err := r.handshake.run(ctx)
+		if rr != nil {
+			r.updateThroughput(rr)
+		}
+		return rr, err
+	}
+
 	if len(r.opt.profiles) > 0 {
-		return r.runProfiles(req, resp, initial)
+		return r.runProfiles(ctx, req, resp, initial)
 	}
 
 	if initial {
@@ -284,7 +480,7 @@ func (r *Invoker) Run(ctx context.Context, bc *berf.Config, initial bool) (*berf
 
 	r.setReq(req)
 
-	return r.runOne(req, resp)
+	return r.runOne(ctx, req, resp)
 }
 
 func (r *Invoker) setReq(req *fasthttp.Request) {
@@ -325,7 +521,7 @@ func (r *Invoker) setReq(req *fasthttp.Request) {
 	}
 }
 
-func (r *Invoker) runOne(req *fasthttp.Request, resp *fasthttp.Response) (*berf.Result, error) {
+func (r *Invoker) runOne(ctx context.Context, req *fasthttp.Request, resp *fasthttp.Response) (*berf.Result, error) {
 	closers, err := r.setBody(req)
 	if err != nil {
 		return nil, err
@@ -334,7 +530,7 @@ func (r *Invoker) runOne(req *fasthttp.Request, resp *fasthttp.Response) (*berf.
 	defer iox.Close(closers)
 
 	rr := &berf.Result{}
-	err = r.doRequest(req, resp, rr)
+	err = r.doRequest(ctx, req, resp, rr)
 	r.updateThroughput(rr)
 
 	return rr, err
@@ -345,15 +541,27 @@ func (r *Invoker) updateThroughput(rr *berf.Result) {
 	rr.WriteBytes = atomic.SwapInt64(&r.writeBytes, 0)
 }
 
-func (r *Invoker) doRequest(req *fasthttp.Request, rsp *fasthttp.Response, rr *berf.Result) (err error) {
-	t1 := time.Now()
-	err = r.httpInvoke(req, rsp)
-	rr.Cost = time.Since(t1)
+func (r *Invoker) doRequest(ctx context.Context, req *fasthttp.Request, rsp *fasthttp.Response, rr *berf.Result) (err error) {
+	if failed, err := r.preHooks(ctx, req, r.opt.preScript); err != nil {
+		return err
+	} else if failed != "" {
+		rr.Status = append(rr.Status, failed)
+		return nil
+	}
+
+	if err = r.invokeRetry(ctx, req, rsp, rr, r.signer, r.digest); err != nil {
+		return err
+	}
+
+	failed, err := r.postHooks(ctx, req, rsp, r.opt.postScript)
 	if err != nil {
 		return err
 	}
 
-	return r.processRsp(req, rsp, rr, nil)
+	if err = r.processRsp(req, rsp, rr, nil); err == nil && failed != "" {
+		rr.Status[len(rr.Status)-1] = failed
+	}
+	return err
 }
 
 func (r *Invoker) processRsp(req *fasthttp.Request, rsp *fasthttp.Response, rr *berf.Result,
@@ -395,6 +603,10 @@ func (r *Invoker) processRsp(req *fasthttp.Request, rsp *fasthttp.Response, rr *
 
 	samplingYes := samplingFunc()
 
+	if samplingYes && r.opt.HasPrintOption(printReqCurl) {
+		fmt.Println(curlCommand(req, !r.opt.tlsVerify))
+	}
+
 	r.printReq(b1, bx, ignoreBody, statusCode, samplingYes, rr)
 	b1.Reset()
 
@@ -584,8 +796,8 @@ func (r *Invoker) dump(b *bytes.Buffer, bx io.Writer, ignoreBody bool, rsp *fast
 
 	maxBody := 4096
 	if envValue := os.Getenv("MAX_BODY"); envValue != "" {
-		if envValue, err := man.ParseBytes(envValue); err == nil {
-			maxBody = int(envValue)
+		if v, err := man.ParseBytes(envValue); err == nil {
+			maxBody = int(v)
 		} else {
 			log.Printf("bad environment value format: %s", envValue)
 		}
@@ -610,7 +822,7 @@ func printBody(dumpBody []byte, printNum int, pretty bool) {
 	fmt.Println(body)
 }
 
-func (r *Invoker) runProfiles(req *fasthttp.Request, rsp *fasthttp.Response, initial bool) (*berf.Result, error) {
+func (r *Invoker) runProfiles(ctx context.Context, req *fasthttp.Request, rsp *fasthttp.Response, initial bool) (*berf.Result, error) {
 	rr := &berf.Result{}
 	defer r.updateThroughput(rr)
 
@@ -629,52 +841,136 @@ func (r *Invoker) runProfiles(req *fasthttp.Request, rsp *fasthttp.Response, ini
 		r.opt.profiles = nonInitial
 	}
 
-	for _, p := range profiles {
-		if err := r.runOneProfile(p, req, rsp, rr); err != nil {
-			return rr, err
+	vars := r.vuState(ctx).vars
+	groups := newStepGroups()
+	defer groups.report(rr)
+
+	var firstErr error
+	for i := 0; i < len(profiles); i++ {
+		p := profiles[i]
+		// 相邻的带权重的步骤，按照权重随机选取其中一个执行
+		if p.Weight > 0 {
+			j := i + 1
+			for j < len(profiles) && profiles[j].Weight > 0 {
+				j++
+			}
+			p, i = internal.PickWeighted(profiles[i:j]), j-1
 		}
 
-		if code := rsp.StatusCode(); code < 200 || code > 300 {
-			break
+		for n := 0; n < max(p.Repeat, 1) && p.Runnable(vars); n++ {
+			p.ThinkNow()
+			start := rr.Cost
+			err := r.runOneProfile(ctx, p, req, rsp, rr)
+			code := rsp.StatusCode()
+			groups.add(p.Group, rr.Cost-start, code, err)
+			req.Reset()
+			rsp.Reset()
+
+			// 脚本标记的失败已记录在状态中，与非 2xx 响应一样处理
+			if errors.Is(err, errScriptFailed) {
+				err = nil
+			} else if err == nil && code >= 200 && code <= 300 {
+				continue
+			}
+			if !p.ContinueOnError {
+				return rr, err
+			}
+			if firstErr == nil {
+				firstErr = err
+			}
 		}
+	}
+
+	return rr, firstErr
+}
+
+// stepGroups accumulates the costs of the profiles with the same group option in an iteration.
+type stepGroups struct {
+	costs  map[string]time.Duration
+	status map[string]string
+	names  []string
+}
+
+func newStepGroups() *stepGroups {
+	return &stepGroups{costs: map[string]time.Duration{}, status: map[string]string{}}
+}
 
-		req.Reset()
-		rsp.Reset()
+func (g *stepGroups) add(name string, cost time.Duration, code int, err error) {
+	if name == "" {
+		return
+	}
+
+	if _, ok := g.costs[name]; !ok {
+		g.names = append(g.names, name)
+		g.status[name] = "ok"
 	}
+	g.costs[name] += cost
 
-	return rr, nil
+	// 组内的第一个失败作为组的状态
+	if g.status[name] == "ok" {
+		if err != nil {
+			g.status[name] = "error"
+		} else if code < 200 || code > 300 {
+			g.status[name] = strconv.Itoa(code)
+		}
+	}
+}
+
+func (g *stepGroups) report(rr *berf.Result) {
+	for _, name := range g.names {
+		rr.AddSub(name, g.status[name], g.costs[name])
+	}
 }
 
-func (r *Invoker) runOneProfile(p *internal.Profile, req *fasthttp.Request, rsp *fasthttp.Response, rr *berf.Result) error {
-	closers, err := p.CreateReq(r.isTLS, req, r.opt.enableGzip, r.opt.uploadIndex)
+func (r *Invoker) runOneProfile(ctx context.Context, p *internal.Profile, req *fasthttp.Request, rsp *fasthttp.Response, rr *berf.Result) error {
+	s := r.vuState(ctx)
+	closers, err := p.CreateReq(r.isTLS, req, r.opt.enableGzip, r.opt.uploadIndex, s.vars)
 	defer iox.Close(closers)
 
 	if err != nil {
 		return err
 	}
 
-	t1 := time.Now()
-	err = r.httpInvoke(req, rsp)
-	rr.Cost += time.Since(t1)
+	if failed, err := r.preHooks(ctx, req, r.opt.preScript, p.PreScript); err != nil {
+		return err
+	} else if failed != "" {
+		rr.Status = append(rr.Status, failed)
+		return errScriptFailed
+	}
+
+	if err = r.invokeRetry(ctx, req, rsp, rr, r.signers[p], r.digests[p]); err != nil {
+		return err
+	}
+
+	// 非初始化调用提取的值，仅对当前虚拟用户的后续请求可见
+	if !p.Init && len(p.ResultExpr) > 0 {
+		if body, err := rsp.BodyUncompressed(); err == nil {
+			for ek, ev := range p.ResultExpr {
+				if jr := jj.GetBytes(body, ev); jr.Type != jj.Null {
+					s.vars[ek] = jr.String()
+				}
+			}
+		}
+	}
+
+	failed, err := r.postHooks(ctx, req, rsp, p.PostScript, r.opt.postScript)
 	if err != nil {
 		return err
 	}
 
 	f := createJSONValuer(p)
-	return r.processRsp(req, rsp, rr, f)
+	if err = r.processRsp(req, rsp, rr, f); err == nil && failed != "" {
+		rr.Status[len(rr.Status)-1] = failed
+		return errScriptFailed
+	}
+	return err
 }
 
 func createJSONValuer(p *internal.Profile) func(jsonBody []byte) {
 	if p.Init {
 		if expr := p.ResultExpr; len(expr) > 0 {
 			return func(jsonBody []byte) {
-				for ek, ev := range expr {
-					if jr := jj.GetBytes(jsonBody, ev); jr.Type != jj.Null {
-						internal.Valuer.Register(ek, func(string) interface{} {
-							return jr.String()
-						})
-					}
-				}
+				registerResultValues(expr, jsonBody)
 			}
 		}
 	}
@@ -682,6 +978,17 @@ func createJSONValuer(p *internal.Profile) func(jsonBody []byte) {
 	return nil
 }
 
+// registerResultValues registers the values extracted from the JSON body to the valuer, like @id.
+func registerResultValues(expr map[string]string, jsonBody []byte) {
+	for ek, ev := range expr {
+		if jr := jj.GetBytes(jsonBody, ev); jr.Type != jj.Null {
+			internal.Valuer.Register(ek, func(string) interface{} {
+				return jr.String()
+			})
+		}
+	}
+}
+
 func parseStatus(rsp *fasthttp.Response, statusName string) string {
 	if statusName != "" {
 		if d, err := rsp.BodyUncompressed(); err == nil {
@@ -785,7 +1092,7 @@ func (noSessionCache) Put(string, *tls.ClientSessionState)        { /* no-op */
 
 func (o *Opt) buildTLSConfig() (*tls.Config, error) {
 	var certs []tls.Certificate
-	if o.certPath != "" && o.keyPath != "" {
+	if o.certPath != "" && o.keyPath != "" && !isClientCertPool(o.certPath) {
 		c, err := tls.LoadX509KeyPair(o.certPath, o.keyPath)
 		if err != nil {
 			return nil, err
@@ -799,6 +1106,9 @@ func (o *Opt) buildTLSConfig() (*tls.Config, error) {
 		// 关闭 HTTP 客户端的会话缓存
 		SessionTicketsDisabled: o.noTLSessionTickets,
 	}
+	if err := o.pinTLS(t); err != nil {
+		return nil, err
+	}
 
 	if cacheSize := env.Int(`TLS_SESSION_CACHE`, 32); cacheSize > 0 {
 		t.ClientSessionCache = tls.NewLRUClientSessionCache(cacheSize)
@@ -1,89 +1,260 @@
-// Package lossy simulates bandwidth, latency and packet loss for net.PacketConn and net.Conn interfaces.
-// `Its main usage is to test robustness of applications and network protocols run over unreliable transport protocols such as UDP or IP.
-// `As a side benefit, it can also be used as outbound bandwidth limiter.
+// Package lossy simulates bandwidth, latency, jitter, packet loss, stalls and connection resets for net.Conn interfaces.
+// `Its main usage is to test robustness of clients, like the timeouts and retries, under bad networks.
 // `
-// `lossy only alters the writing side of the connection, reading side is kept as it is.
+// `Both the writing (upload) and the reading (download) sides are shaped, with separate bandwidth limits.
 // `
-// `from github.com/cevatbarisyilmaz/lossy
+// `originally from github.com/cevatbarisyilmaz/lossy
 package lossy
 
 import (
+	"io"
+	"math"
 	"math/rand"
 	"net"
+	"os"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 )
 
+// Config is the network impairment of a connection.
+type Config struct {
+	// Up and Down are the bandwidths of writing and reading in bytes/second, 0 for unlimited.
+	Up, Down uint64
+	// RTT is the round-trip latency, half of it is added to each direction when the conversation turns.
+	RTT time.Duration
+	// Jitter is the variation of the latency, distributed by Distribution.
+	Jitter time.Duration
+	// Distribution is the jitter distribution, uniform (default), normal or pareto.
+	Distribution string
+	// Loss is the packet loss rate, a lost packet is delivered after a TCP retransmission timeout.
+	Loss float64
+	// StallRate is the rate of the reads or writes stalled for StallDuration.
+	StallRate     float64
+	StallDuration time.Duration
+	// ResetRate is the rate of the reads or writes failed by an injected connection reset.
+	ResetRate float64
+	// HalfCloseRate is the rate of the reads that find the connection half-closed by the peer (io.EOF).
+	HalfCloseRate float64
+}
+
+// Enabled tells any impairment is configured.
+func (c Config) Enabled() bool {
+	return c != Config{}
+}
+
+// Stats are the counters of the injected impairments of all the connections.
+type Stats struct {
+	Losses, Stalls, Resets, HalfCloses int64
+}
+
+var stats Stats
+
+// GetStats returns the counters of the injected impairments.
+func GetStats() Stats {
+	return Stats{
+		Losses:     atomic.LoadInt64(&stats.Losses),
+		Stalls:     atomic.LoadInt64(&stats.Stalls),
+		Resets:     atomic.LoadInt64(&stats.Resets),
+		HalfCloses: atomic.LoadInt64(&stats.HalfCloses),
+	}
+}
+
+// minRTO is the minimum TCP retransmission timeout of Linux.
+const minRTO = 200 * time.Millisecond
+
+const (
+	dirNone = iota
+	dirWrite
+	dirRead
+)
+
 type conn struct {
-	writeDeadline time.Time
 	net.Conn
-	mu                *sync.Mutex
-	minLatency        time.Duration
-	maxLatency        time.Duration
-	packetLossRate    float64
-	timeToWaitPerByte float64
-	closed            bool
-}
-
-// NewConn wraps the given net.Conn with a latency connection.
-//
-// bandwidth is in bytes/second.
-// i.e. enter 1024 * 1024 for a 8 Mbit/s connection.
-// Enter 0 or a negative value for an unlimited bandwidth.
-//
-// minLatency and maxLatency is used to create a random latency for each packet.
-// maxLatency should be equal or greater than minLatency.
-// If bandwidth is not unlimited and there's no other packets waiting to be delivered,
-// time to deliver a packet is (len(packet) + headerOverhead) / bandwidth + randomDuration(minLatency, maxLatency)
-func NewConn(c net.Conn, bandwidth uint64, minLatency, maxLatency time.Duration) net.Conn {
-	return &conn{
-		Conn:              c,
-		minLatency:        minLatency,
-		maxLatency:        maxLatency,
-		writeDeadline:     time.Time{},
-		closed:            false,
-		mu:                &sync.Mutex{},
-		timeToWaitPerByte: parseTimeToWaitPerByte(bandwidth),
-	}
-}
-
-func parseTimeToWaitPerByte(bandwidth uint64) float64 {
-	if bandwidth <= 0 {
-		return 0
-	}
-	return float64(time.Second) / float64(bandwidth)
+	cfg Config
+
+	mu            sync.Mutex
+	readDeadline  time.Time
+	writeDeadline time.Time
+	// lastDir is the direction of the last reading or writing, the latency is added when the direction turns.
+	lastDir    int
+	halfClosed bool
+	reset      bool
+	closed     bool
+}
+
+// NewConn wraps the given net.Conn with the network impairment of cfg.
+func NewConn(c net.Conn, cfg Config) net.Conn {
+	return &conn{Conn: c, cfg: cfg}
 }
 
 func (c *conn) Write(b []byte) (int, error) {
 	c.mu.Lock()
-	defer c.mu.Unlock()
-	if c.closed || !c.writeDeadline.Equal(time.Time{}) && c.writeDeadline.Before(time.Now()) {
-		return c.Conn.Write(b)
+	deadline := c.writeDeadline
+	d, err := c.impair(dirWrite, len(b), c.cfg.Up)
+	c.mu.Unlock()
+	if err != nil {
+		return 0, c.opError("write", err)
+	}
+
+	if err := sleep(d, deadline); err != nil {
+		return 0, c.opError("write", err)
+	}
+	return c.Conn.Write(b)
+}
+
+func (c *conn) Read(b []byte) (int, error) {
+	c.mu.Lock()
+	reset, halfClosed := c.reset, c.halfClosed
+	c.mu.Unlock()
+	if reset {
+		return 0, c.opError("read", syscall.ECONNRESET)
+	}
+	if halfClosed {
+		return 0, io.EOF
+	}
+
+	n, err := c.Conn.Read(b)
+	if n == 0 {
+		return n, err
+	}
+
+	c.mu.Lock()
+	deadline := c.readDeadline
+	d, impairErr := c.impair(dirRead, n, c.cfg.Down)
+	c.mu.Unlock()
+	if impairErr == io.EOF {
+		return 0, io.EOF
+	}
+	if impairErr != nil {
+		return 0, c.opError("read", impairErr)
+	}
+
+	if err := sleep(d, deadline); err != nil {
+		return 0, c.opError("read", err)
+	}
+	return n, err
+}
+
+// impair injects the impairments into the reading or writing of n bytes,
+// returns the delay of the bytes, or the error of the injected reset or half-close.
+func (c *conn) impair(dir, n int, bandwidth uint64) (time.Duration, error) {
+	switch {
+	case c.closed:
+		return 0, nil
+	case c.reset:
+		return 0, syscall.ECONNRESET
+	case dir == dirRead && c.halfClosed:
+		return 0, io.EOF
+	}
+
+	if hit(c.cfg.ResetRate) {
+		atomic.AddInt64(&stats.Resets, 1)
+		c.reset = true
+		if tc, ok := c.Conn.(*net.TCPConn); ok {
+			_ = tc.SetLinger(0) // 关闭时发送 RST
+		}
+		_ = c.Conn.Close()
+		return 0, syscall.ECONNRESET
+	}
+	if dir == dirRead && hit(c.cfg.HalfCloseRate) {
+		atomic.AddInt64(&stats.HalfCloses, 1)
+		c.halfClosed = true
+		return 0, io.EOF
+	}
+
+	var d time.Duration
+	if bandwidth > 0 {
+		d += time.Duration(float64(n) * float64(time.Second) / float64(bandwidth))
 	}
+	if c.lastDir != dir {
+		c.lastDir = dir
+		d += c.latency()
+	}
+	if hit(c.cfg.Loss) {
+		atomic.AddInt64(&stats.Losses, 1)
+		rto := 2 * c.cfg.RTT
+		if rto < minRTO {
+			rto = minRTO
+		}
+		d += rto
+	}
+	if hit(c.cfg.StallRate) {
+		atomic.AddInt64(&stats.Stalls, 1)
+		d += c.cfg.StallDuration
+	}
+	return d, nil
+}
+
+// latency returns the one-way latency, half of the RTT with the jitter.
+func (c *conn) latency() time.Duration {
+	d := float64(c.cfg.RTT / 2)
+	if j := float64(c.cfg.Jitter); j > 0 {
+		switch c.cfg.Distribution {
+		case "normal":
+			d += randNorm() * j
+		case "pareto":
+			// 帕累托分布 (alpha=2)，大部分抖动很小，偶尔出现长尾
+			d += j * (1/math.Sqrt(1-randFloat64()) - 1)
+		default:
+			d += (2*randFloat64() - 1) * j
+		}
+	}
+	if d < 0 {
+		return 0
+	}
+	return time.Duration(d)
+}
 
-	d := time.Duration(c.timeToWaitPerByte*(float64(len(b)))) + c.minLatency
-	if c.minLatency < c.maxLatency {
-		d += time.Duration(float64(c.maxLatency-c.minLatency) * randFloat64())
+func (c *conn) opError(op string, err error) error {
+	if err == syscall.ECONNRESET {
+		err = os.NewSyscallError(op, err)
+	}
+	return &net.OpError{Op: op, Net: "tcp", Source: c.LocalAddr(), Addr: c.RemoteAddr(), Err: err}
+}
+
+// sleep sleeps d, or fails with os.ErrDeadlineExceeded when the deadline comes first.
+func sleep(d time.Duration, deadline time.Time) error {
+	if d <= 0 {
+		return nil
+	}
+	if !deadline.IsZero() {
+		if left := time.Until(deadline); left < d {
+			if left > 0 {
+				time.Sleep(left)
+			}
+			return os.ErrDeadlineExceeded
+		}
 	}
 	time.Sleep(d)
-	_, _ = c.Conn.Write(b)
-	return len(b), nil
+	return nil
 }
 
 func (c *conn) Close() error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	c.closed = true
+	if c.reset {
+		return nil
+	}
 	return c.Conn.Close()
 }
 
 func (c *conn) SetDeadline(t time.Time) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	c.writeDeadline = t
+	c.readDeadline, c.writeDeadline = t, t
 	return c.Conn.SetDeadline(t)
 }
 
+func (c *conn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.readDeadline = t
+	return c.Conn.SetReadDeadline(t)
+}
+
 func (c *conn) SetWriteDeadline(t time.Time) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
@@ -104,3 +275,14 @@ func randFloat64() float64 {
 
 	return rng.rand.Float64()
 }
+
+func randNorm() float64 {
+	rng.Lock()
+	defer rng.Unlock()
+
+	return rng.rand.NormFloat64()
+}
+
+func hit(rate float64) bool {
+	return rate > 0 && randFloat64() < rate
+}
@@ -0,0 +1,78 @@
+package lossy
+
+import (
+	"errors"
+	"io"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	c, err := Parse("20M:20ms")
+	assert.Nil(t, err)
+	assert.Equal(t, Config{Up: 20 * 1000 * 1000, Down: 20 * 1000 * 1000, RTT: 20 * time.Millisecond}, c)
+
+	// bad 保持以前的带宽及时延，不含抖动及丢包
+	c, err = Parse("bad")
+	assert.Nil(t, err)
+	assert.Equal(t, Config{Up: 20 * 1024 * 1024, Down: 20 * 1024 * 1024, RTT: 200 * time.Millisecond}, c)
+
+	c, err = Parse("3g,reset=1%,halfclose=0.001")
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(200*1024), c.Down)
+	assert.Equal(t, "normal", c.Distribution)
+	assert.Equal(t, 0.01, c.ResetRate)
+	assert.Equal(t, 0.001, c.HalfCloseRate)
+
+	c, err = Parse("up=1M,down=5M,rtt=100ms,jitter=30ms/pareto,loss=1%,stall=0.5%:2s")
+	assert.Nil(t, err)
+	assert.Equal(t, Config{
+		Up: 1000 * 1000, Down: 5 * 1000 * 1000, RTT: 100 * time.Millisecond,
+		Jitter: 30 * time.Millisecond, Distribution: "pareto", Loss: 0.01,
+		StallRate: 0.005, StallDuration: 2 * time.Second,
+	}, c)
+
+	c, err = Parse("")
+	assert.Nil(t, err)
+	assert.False(t, c.Enabled())
+
+	for _, bad := range []string{"fast", "rtt=1x", "loss=200%", "jitter=1ms/poisson", "wan,fast"} {
+		_, err = Parse(bad)
+		assert.NotNil(t, err, bad)
+	}
+}
+
+func TestConnImpairments(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+	go func() { _, _ = io.Copy(server, server) }()
+
+	// 读写两个方向各增加一半 RTT
+	c := NewConn(client, Config{RTT: 40 * time.Millisecond})
+	start := time.Now()
+	_, err := c.Write([]byte("ping"))
+	assert.Nil(t, err)
+	_, err = io.ReadFull(c, make([]byte, 4))
+	assert.Nil(t, err)
+	assert.True(t, time.Since(start) >= 40*time.Millisecond)
+
+	// 超过读截止时间
+	_ = c.SetReadDeadline(time.Now().Add(10 * time.Millisecond))
+	c.(*conn).lastDir = dirWrite
+	_, err = c.Write([]byte("ping"))
+	assert.Nil(t, err)
+	_, err = c.Read(make([]byte, 4))
+	assert.True(t, errors.Is(err, os.ErrDeadlineExceeded))
+
+	c = NewConn(client, Config{ResetRate: 1})
+	_, err = c.Write([]byte("ping"))
+	assert.True(t, errors.Is(err, syscall.ECONNRESET))
+	_, err = c.Read(make([]byte, 4))
+	assert.True(t, errors.Is(err, syscall.ECONNRESET))
+	assert.Equal(t, int64(1), GetStats().Resets)
+}
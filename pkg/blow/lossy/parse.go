@@ -0,0 +1,131 @@
+package lossy
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
+)
+
+// Profiles are the predefined network impairments.
+var Profiles = map[string]Config{
+	"local": {},
+	"lan":   {Up: 100 * 1024 * 1024, Down: 100 * 1024 * 1024, RTT: 2 * time.Millisecond},
+	"wan":   {Up: 20 * 1024 * 1024, Down: 20 * 1024 * 1024, RTT: 30 * time.Millisecond},
+	"bad":   {Up: 20 * 1024 * 1024, Down: 20 * 1024 * 1024, RTT: 200 * time.Millisecond},
+	"3g": {
+		Up: 96 * 1024, Down: 200 * 1024, RTT: 300 * time.Millisecond,
+		Jitter: 50 * time.Millisecond, Distribution: "normal", Loss: 0.01,
+	},
+	"satellite": {
+		Up: 256 * 1024, Down: 2 * 1024 * 1024, RTT: 600 * time.Millisecond,
+		Jitter: 20 * time.Millisecond, Loss: 0.005,
+	},
+	"flaky-wifi": {
+		Up: 5 * 1024 * 1024, Down: 5 * 1024 * 1024, RTT: 20 * time.Millisecond,
+		Jitter: 80 * time.Millisecond, Distribution: "pareto", Loss: 0.02,
+		StallRate: 0.01, StallDuration: time.Second, ResetRate: 0.001,
+	},
+}
+
+// Parse parses the network impairment like wan, 20M:20ms (bandwidth of both directions and RTT),
+// or the options separated by comma, optionally after a profile, like 3g,reset=1%, or
+// up=1M,down=5M,rtt=100ms,jitter=30ms/normal,loss=1%,stall=0.5%:2s,reset=0.1%,halfclose=0.1%.
+func Parse(spec string) (c Config, err error) {
+	for i, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		k, v, ok := strings.Cut(item, "=")
+		if !ok {
+			if i > 0 {
+				return c, fmt.Errorf("invalid network option %s, should be like key=value", item)
+			}
+			if c, ok = Profiles[strings.ToLower(item)]; ok {
+				continue
+			}
+			bw, rtt, _ := strings.Cut(item, ":")
+			if c.Up, err = humanize.ParseBytes(bw); err != nil {
+				return c, fmt.Errorf("invalid network %s, should be one of %s, or BPS:latency like 20M:20ms", item, profileNames())
+			}
+			c.Down = c.Up
+			if rtt != "" {
+				if c.RTT, err = time.ParseDuration(rtt); err != nil {
+					return c, fmt.Errorf("invalid network latency %s: %w", rtt, err)
+				}
+			}
+			continue
+		}
+
+		if err := c.set(strings.ToLower(strings.TrimSpace(k)), strings.TrimSpace(v)); err != nil {
+			return c, fmt.Errorf("invalid network option %s: %w", item, err)
+		}
+	}
+
+	return c, nil
+}
+
+func (c *Config) set(k, v string) (err error) {
+	switch k {
+	case "up":
+		c.Up, err = humanize.ParseBytes(v)
+	case "down":
+		c.Down, err = humanize.ParseBytes(v)
+	case "bw", "bandwidth":
+		c.Up, err = humanize.ParseBytes(v)
+		c.Down = c.Up
+	case "rtt", "latency":
+		c.RTT, err = time.ParseDuration(v)
+	case "jitter":
+		jitter, dist, _ := strings.Cut(v, "/")
+		switch dist = strings.ToLower(dist); dist {
+		case "", "uniform", "normal", "pareto":
+		default:
+			return fmt.Errorf("unknown jitter distribution %s, should be one of uniform, normal, pareto", dist)
+		}
+		c.Distribution = dist
+		c.Jitter, err = time.ParseDuration(jitter)
+	case "loss":
+		c.Loss, err = parseRate(v)
+	case "stall":
+		rate, d, _ := strings.Cut(v, ":")
+		if c.StallRate, err = parseRate(rate); err != nil {
+			return err
+		}
+		c.StallDuration = time.Second
+		if d != "" {
+			c.StallDuration, err = time.ParseDuration(d)
+		}
+	case "reset":
+		c.ResetRate, err = parseRate(v)
+	case "halfclose", "half-close":
+		c.HalfCloseRate, err = parseRate(v)
+	default:
+		return fmt.Errorf("unknown key %s, should be one of up, down, bw, rtt, jitter, loss, stall, reset, halfclose", k)
+	}
+	return err
+}
+
+// parseRate parses the rate like 1% or 0.01.
+func parseRate(s string) (float64, error) {
+	percent := strings.HasSuffix(s, "%")
+	f, err := strconv.ParseFloat(strings.TrimSuffix(s, "%"), 64)
+	if err != nil {
+		return 0, err
+	}
+	if percent {
+		f /= 100
+	}
+	if f < 0 || f > 1 {
+		return 0, fmt.Errorf("rate %s should be between 0 and 1 (100%%)", s)
+	}
+	return f, nil
+}
+
+func profileNames() string {
+	return "local, lan, wan, bad, 3g, satellite, flaky-wifi"
+}
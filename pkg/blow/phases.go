@@ -0,0 +1,75 @@
+package blow
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"time"
+
+	"github.com/bingoohuang/berf"
+	"github.com/bingoohuang/berf/pkg/blow/internal"
+	"github.com/valyala/fasthttp"
+)
+
+// tlsDialer does the TLS handshake in the dialing, instead of lazily by fasthttp on the first request,
+// so that the handshake latency is timed as the tls phase by -phases, the handshake is bounded by the dial timeout.
+func tlsDialer(dial fasthttp.DialFunc, config *tls.Config, timeout time.Duration) fasthttp.DialFunc {
+	return func(addr string) (net.Conn, error) {
+		rawConn, err := dial(addr)
+		if err != nil {
+			return nil, err
+		}
+
+		c := &tls.Config{}
+		if config != nil {
+			c = config.Clone()
+		}
+		if c.ServerName == "" {
+			if host, _, err := net.SplitHostPort(addr); err == nil {
+				c.ServerName = host
+			}
+		}
+
+		ctx := context.Background()
+		if timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+
+		t1 := time.Now()
+		conn := tls.Client(rawConn, c)
+		if err := conn.HandshakeContext(ctx); err != nil {
+			_ = rawConn.Close()
+			return nil, err
+		}
+		if m, ok := rawConn.(*internal.MyConn); ok {
+			m.HandshakeDone(time.Since(t1))
+		}
+		return conn, nil
+	}
+}
+
+// addPhases adds the latency phases of the request by the trace of its connection,
+// the dns, connect and tls phases are only added for the new connections, not for the reused keep-alive ones.
+func addPhases(rr *berf.Result, rsp *fasthttp.Response) {
+	t, req, ok := internal.GetRequestTrace(rsp.LocalAddr())
+	if !ok || req.FirstByte.IsZero() {
+		return
+	}
+
+	status := "reused"
+	if req.Seq == 1 {
+		status = "new"
+		if t.Resolved {
+			rr.AddPhase("dns", status, t.DNS)
+		}
+		rr.AddPhase("connect", status, t.Connect)
+		if t.TLS > 0 {
+			rr.AddPhase("tls", status, t.TLS)
+		}
+	}
+	rr.AddPhase("write", status, req.WriteEnd.Sub(req.WriteStart))
+	rr.AddPhase("ttfb", status, req.FirstByte.Sub(req.WriteEnd))
+	rr.AddPhase("transfer", status, time.Since(req.FirstByte))
+}
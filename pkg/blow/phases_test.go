@@ -0,0 +1,104 @@
+package blow
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bingoohuang/berf"
+	"github.com/bingoohuang/berf/pkg/blow/internal"
+	"github.com/stretchr/testify/assert"
+	"github.com/valyala/fasthttp"
+)
+
+func TestPhases(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(strings.Repeat("x", 1024)))
+	}))
+	defer ts.Close()
+
+	var readBytes, writeBytes int64
+	opt := &Opt{phases: true, dns: dnsOption{pick: "round", resolve: []string{"berf.test:*:127.0.0.1"}}}
+	d, err := opt.buildDialer(&subRecorder{})
+	assert.Nil(t, err)
+
+	noop := func(c net.Conn) net.Conn { return c }
+	dial := internal.PhaseTraceDial(noop, ProxyHTTPDialerTimeout(0, d, true), &readBytes, &writeBytes)
+	cli := &fasthttp.Client{Dial: tlsDialer(dial, &tls.Config{InsecureSkipVerify: true}, 0)}
+
+	u := strings.Replace(ts.URL, "127.0.0.1", "berf.test", 1)
+	for _, expected := range []string{"new", "reused"} {
+		req, rsp := fasthttp.AcquireRequest(), fasthttp.AcquireResponse()
+		req.SetRequestURI(u)
+		assert.Nil(t, cli.Do(req, rsp))
+		assert.Equal(t, 200, rsp.StatusCode())
+
+		rr := &berf.Result{}
+		addPhases(rr, rsp)
+
+		var phases []string
+		for _, sub := range rr.Subs {
+			assert.Equal(t, expected, sub.Status)
+			phases = append(phases, strings.TrimPrefix(sub.Name, berf.PhasePrefix))
+		}
+		if expected == "new" {
+			assert.Equal(t, berf.Phases, phases)
+		} else {
+			assert.Equal(t, []string{"write", "ttfb", "transfer"}, phases)
+		}
+		fasthttp.ReleaseRequest(req)
+		fasthttp.ReleaseResponse(rsp)
+	}
+}
+
+// TestPhasesConcurrent checks the phases of the concurrent requests sharing the pooled keep-alive connections,
+// a connection is handed over to another goroutine right after its response is read, run it with -race.
+func TestPhasesConcurrent(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer ts.Close()
+
+	var readBytes, writeBytes int64
+	noop := func(c net.Conn) net.Conn { return c }
+	cli := &fasthttp.Client{
+		MaxConnsPerHost:    2,
+		MaxConnWaitTimeout: 5 * time.Second,
+		Dial:               internal.PhaseTraceDial(noop, ProxyHTTPDialerTimeout(0, dialer, false), &readBytes, &writeBytes),
+	}
+
+	var wg sync.WaitGroup
+	var newCount, reusedCount int64
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				req, rsp := fasthttp.AcquireRequest(), fasthttp.AcquireResponse()
+				req.SetRequestURI(ts.URL)
+				assert.Nil(t, cli.DoTimeout(req, rsp, 5*time.Second))
+
+				rr := &berf.Result{}
+				addPhases(rr, rsp)
+				assert.NotEmpty(t, rr.Subs)
+				if len(rr.Subs) > 0 && rr.Subs[0].Status == "new" {
+					atomic.AddInt64(&newCount, 1)
+				} else {
+					atomic.AddInt64(&reusedCount, 1)
+				}
+				fasthttp.ReleaseRequest(req)
+				fasthttp.ReleaseResponse(rsp)
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.LessOrEqual(t, newCount, int64(2))
+	assert.Equal(t, int64(400), newCount+reusedCount)
+}
@@ -0,0 +1,323 @@
+package blow
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	// pipelineSeqHeader is the sequence of the pipelined request, the responses echoing it are checked for the order.
+	pipelineSeqHeader  = "X-Pipeline-Seq"
+	pipelineHOLSubName = "pipeline hol"
+	// pipelineReadTimeout is the default timeout to wait for the responses of the in-flight requests,
+	// after which they are taken as dropped.
+	pipelineReadTimeout = 10 * time.Second
+)
+
+var (
+	errPipelineDropped    = errors.New("pipelined response dropped")
+	errPipelineClosed     = errors.New("pipelined request unanswered before the connection closed by server")
+	errPipelineOrder      = errors.New("pipelined response out of order")
+	errPipelineUnexpected = errors.New("unexpected response without pipelined request")
+)
+
+// pipelineOption is the HTTP/1.1 pipelining options of the -pipeline.* flags.
+type pipelineOption struct {
+	// depth is the max number of the in-flight requests per connection, 0 to disable the pipelining.
+	depth int
+	// conns is the number of the pipelined connections per host.
+	conns int
+}
+
+// pipeliner sends the requests pipelined on a fixed number of connections per host,
+// instead of fasthttp.PipelineClient, so that the depth per connection is exact,
+// the head-of-line blocking is measured, and the responses out of order or dropped are detected.
+type pipeliner struct {
+	opt         pipelineOption
+	dial        fasthttp.DialFunc
+	isTLS       bool
+	readTimeout time.Duration
+	subs        *subRecorder
+
+	hosts map[string][]*pipeConn
+	mu    sync.Mutex
+	index uint32
+	seq   uint64
+
+	dialed, sent, received, maxInFlight, outOfOrder, dropped, unanswered, unexpected int64
+}
+
+// pipeTask is a request waiting for its response in the pipeline.
+type pipeTask struct {
+	req  *fasthttp.Request
+	rsp  *fasthttp.Response
+	seq  string
+	done chan error
+	// sent is the time the request written, ahead is the number of the requests in flight before it.
+	sent  time.Time
+	ahead int
+	// written is closed when the writing of the request returns, the request is not handed back before it.
+	written chan struct{}
+	head    bool
+}
+
+// pipeConn is a pipelined connection, re-dialed on demand after it is broken or closed.
+type pipeConn struct {
+	p     *pipeliner
+	addr  string
+	slots chan struct{}
+	queue chan *pipeTask
+}
+
+// pipeState is the state of a dialed connection of the pipeConn.
+type pipeState struct {
+	conn     net.Conn
+	inflight chan *pipeTask
+	// pending is the number of the requests written but not answered, guarded by mu with the read deadline.
+	pending int
+	mu      sync.Mutex
+	// readerDone is closed when the reading stops by err, the in-flight requests left are failed by err too.
+	readerDone chan struct{}
+	err        error
+	// writeErr is the error of writing, by which the connection is closed.
+	writeErr error
+	closing  int32
+}
+
+func newPipeliner(opt *Opt, dial fasthttp.DialFunc, isTLS bool, subs *subRecorder) (*pipeliner, error) {
+	if opt.pipeline.conns <= 0 {
+		return nil, fmt.Errorf("invalid -pipeline.conns %d", opt.pipeline.conns)
+	}
+
+	p := &pipeliner{opt: opt.pipeline, dial: dial, isTLS: isTLS, readTimeout: opt.readTimeout, subs: subs, hosts: map[string][]*pipeConn{}}
+	if p.readTimeout == 0 {
+		p.readTimeout = pipelineReadTimeout
+	}
+	return p, nil
+}
+
+// Do sends the request in the pipeline of a connection picked round-robin, and waits for its response.
+func (p *pipeliner) Do(req *fasthttp.Request, rsp *fasthttp.Response) error {
+	c := p.pick(fasthttp.AddMissingPort(string(req.Host()), p.isTLS))
+	t := &pipeTask{req: req, rsp: rsp, done: make(chan error, 1)}
+
+	c.slots <- struct{}{}
+	c.queue <- t
+	err := <-t.done
+	<-c.slots
+	return err
+}
+
+func (p *pipeliner) pick(addr string) *pipeConn {
+	p.mu.Lock()
+	conns := p.hosts[addr]
+	if conns == nil {
+		for i := 0; i < p.opt.conns; i++ {
+			c := &pipeConn{p: p, addr: addr, slots: make(chan struct{}, p.opt.depth), queue: make(chan *pipeTask, p.opt.depth)}
+			conns = append(conns, c)
+			go c.run()
+		}
+		p.hosts[addr] = conns
+	}
+	p.mu.Unlock()
+
+	return conns[int(atomic.AddUint32(&p.index, 1)-1)%len(conns)]
+}
+
+func (c *pipeConn) run() {
+	for t := range c.queue {
+		conn, err := c.p.dial(c.addr)
+		if err != nil {
+			t.done <- err
+			continue
+		}
+		atomic.AddInt64(&c.p.dialed, 1)
+		c.serve(conn, t)
+	}
+}
+
+// serve writes the requests pipelined on the connection, while their responses are read in order by read,
+// until the connection is broken or closed by the server.
+func (c *pipeConn) serve(conn net.Conn, t *pipeTask) {
+	s := &pipeState{conn: conn, inflight: make(chan *pipeTask, c.p.opt.depth), readerDone: make(chan struct{})}
+	go c.read(s)
+
+	bw := bufio.NewWriter(conn)
+	for t != nil {
+		if err := c.write(s, bw, t); err != nil {
+			s.writeErr = err
+			atomic.StoreInt32(&s.closing, 1)
+			_ = conn.Close()
+			<-s.readerDone
+			break
+		}
+
+		select {
+		case t = <-c.queue:
+		case <-s.readerDone:
+			t = nil
+		}
+	}
+
+	_ = conn.Close()
+	for {
+		select {
+		case t := <-s.inflight:
+			c.fail(t, s.err)
+		default:
+			return
+		}
+	}
+}
+
+// write writes the request into the pipeline, and flushes it when no more requests are queued.
+// The request is registered in flight before written, since a body larger than the buffer is written through
+// to the connection, and the server may answer it before the writing returns. A request failed to write stays
+// registered, and it is failed by the write error with the other in-flight ones when the connection is closed.
+func (c *pipeConn) write(s *pipeState, bw *bufio.Writer, t *pipeTask) error {
+	t.seq = strconv.FormatUint(atomic.AddUint64(&c.p.seq, 1), 10)
+	t.req.Header.Set(pipelineSeqHeader, t.seq)
+	t.written, t.head = make(chan struct{}), t.req.Header.IsHead()
+	defer close(t.written)
+
+	s.mu.Lock()
+	t.sent, t.ahead = time.Now(), s.pending
+	s.pending++
+	pending := s.pending
+	s.inflight <- t
+	if pending == 1 {
+		_ = s.conn.SetReadDeadline(t.sent.Add(c.p.readTimeout))
+	}
+	s.mu.Unlock()
+
+	if err := t.req.Write(bw); err != nil {
+		return err
+	}
+
+	atomic.AddInt64(&c.p.sent, 1)
+	atomicMax(&c.p.maxInFlight, int64(pending))
+
+	if len(c.queue) == 0 {
+		return bw.Flush()
+	}
+	return nil
+}
+
+// read reads the responses of the in-flight requests in order.
+func (c *pipeConn) read(s *pipeState) {
+	defer close(s.readerDone)
+	defer s.conn.Close()
+
+	p := c.p
+	br := bufio.NewReader(s.conn)
+	var lastDone time.Time
+	for {
+		_, err := br.Peek(1)
+		s.mu.Lock()
+		pending := s.pending
+		s.mu.Unlock()
+
+		if err != nil {
+			// 空闲时被服务端关闭的连接，下个请求重新建立即可，否则在途的请求都被丢弃
+			s.err = c.readErr(s, pending, err)
+			return
+		}
+		if pending == 0 {
+			atomic.AddInt64(&p.unexpected, 1)
+			s.err = errPipelineUnexpected
+			return
+		}
+
+		t := <-s.inflight
+		// 排在前面的响应读取完成之前的等待，即队头阻塞
+		hol := lastDone.Sub(t.sent)
+		t.rsp.SkipBody = t.head
+		err = t.rsp.Read(br)
+		// 服务端可能在请求体写完之前就已响应
+		<-t.written
+
+		lastDone = time.Now()
+		s.mu.Lock()
+		s.pending--
+		if s.pending > 0 {
+			_ = s.conn.SetReadDeadline(lastDone.Add(p.readTimeout))
+		} else {
+			_ = s.conn.SetReadDeadline(time.Time{})
+		}
+		s.mu.Unlock()
+
+		if err != nil {
+			s.err = c.readErr(s, pending, err)
+			c.fail(t, s.err)
+			return
+		}
+
+		atomic.AddInt64(&p.received, 1)
+		if t.ahead > 0 && hol > 0 {
+			p.subs.record(pipelineHOLSubName, "ahead "+strconv.Itoa(t.ahead), hol)
+		}
+
+		if seq := t.rsp.Header.Peek(pipelineSeqHeader); len(seq) > 0 && string(seq) != t.seq {
+			atomic.AddInt64(&p.outOfOrder, 1)
+			s.err = fmt.Errorf("%w: expected %s %s, got %s", errPipelineOrder, pipelineSeqHeader, t.seq, seq)
+			t.done <- s.err
+			return
+		}
+
+		if t.rsp.ConnectionClose() {
+			s.err = errPipelineClosed
+			t.done <- nil
+			return
+		}
+		t.done <- nil
+	}
+}
+
+// readErr tells the error of reading with the pending requests, which are dropped unless the connection closed by writing.
+func (c *pipeConn) readErr(s *pipeState, pending int, err error) error {
+	switch {
+	case atomic.LoadInt32(&s.closing) == 1:
+		return s.writeErr
+	case pending == 0:
+		return err
+	}
+	return fmt.Errorf("%w: %v", errPipelineDropped, err)
+}
+
+// fail fails the pipelined request by err, counted as dropped or unanswered.
+func (c *pipeConn) fail(t *pipeTask, err error) {
+	switch {
+	case errors.Is(err, errPipelineDropped):
+		atomic.AddInt64(&c.p.dropped, 1)
+	case errors.Is(err, errPipelineClosed):
+		atomic.AddInt64(&c.p.unanswered, 1)
+	}
+	t.done <- err
+}
+
+// report prints the counters of the pipelining.
+func (p *pipeliner) report(w io.Writer) {
+	_, _ = fmt.Fprintf(w, "\nPipelining: depth %d, connections %d per host, dialed %d, max in flight %d\n",
+		p.opt.depth, p.opt.conns, atomic.LoadInt64(&p.dialed), atomic.LoadInt64(&p.maxInFlight))
+	_, _ = fmt.Fprintf(w, "Pipelined requests %d, responses %d, out of order %d, dropped %d, unanswered before closed %d, unexpected %d\n",
+		atomic.LoadInt64(&p.sent), atomic.LoadInt64(&p.received), atomic.LoadInt64(&p.outOfOrder),
+		atomic.LoadInt64(&p.dropped), atomic.LoadInt64(&p.unanswered), atomic.LoadInt64(&p.unexpected))
+}
+
+// atomicMax stores v to addr if it is greater than the current value.
+func atomicMax(addr *int64, v int64) {
+	for old := atomic.LoadInt64(addr); v > old; old = atomic.LoadInt64(addr) {
+		if atomic.CompareAndSwapInt64(addr, old, v) {
+			return
+		}
+	}
+}
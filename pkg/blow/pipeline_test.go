@@ -0,0 +1,171 @@
+package blow
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bingoohuang/berf"
+	"github.com/stretchr/testify/assert"
+	"github.com/valyala/fasthttp"
+)
+
+// pipelineServer serves the connections by reading two pipelined requests, and answering them by respond.
+func pipelineServer(t *testing.T, respond func(w *bufio.Writer, seqs []string)) net.Listener {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				br, bw := bufio.NewReader(conn), bufio.NewWriter(conn)
+				var seqs []string
+				for i := 0; i < 2; i++ {
+					var req fasthttp.Request
+					if req.Read(br) != nil {
+						return
+					}
+					seqs = append(seqs, string(req.Header.Peek(pipelineSeqHeader)))
+				}
+				respond(bw, seqs)
+				_ = bw.Flush()
+				time.Sleep(time.Second)
+			}()
+		}
+	}()
+	return ln
+}
+
+func writeSeqResponse(w *bufio.Writer, seq string) {
+	var rsp fasthttp.Response
+	rsp.Header.Set(pipelineSeqHeader, seq)
+	rsp.SetBodyString("ok")
+	_ = rsp.Write(w)
+}
+
+func doPipelined(p *pipeliner, addr string) []error {
+	errs := make([]error, 2)
+	var wg sync.WaitGroup
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			req, rsp := fasthttp.AcquireRequest(), fasthttp.AcquireResponse()
+			defer fasthttp.ReleaseRequest(req)
+			defer fasthttp.ReleaseResponse(rsp)
+			req.SetRequestURI("http://" + addr + "/")
+			errs[i] = p.Do(req, rsp)
+		}(i)
+	}
+	wg.Wait()
+	return errs
+}
+
+func TestPipeliner(t *testing.T) {
+	cases := []struct {
+		name    string
+		respond func(w *bufio.Writer, seqs []string)
+		check   func(t *testing.T, p *pipeliner, errs []error)
+	}{
+		{"in order", func(w *bufio.Writer, seqs []string) {
+			// 第一个请求处理较慢，第二个请求被队头阻塞
+			time.Sleep(50 * time.Millisecond)
+			writeSeqResponse(w, seqs[0])
+			writeSeqResponse(w, seqs[1])
+		}, func(t *testing.T, p *pipeliner, errs []error) {
+			assert.Equal(t, []error{nil, nil}, errs)
+			assert.Equal(t, int64(2), p.maxInFlight)
+			assert.Equal(t, int64(2), p.received)
+
+			rr := &berf.Result{}
+			p.subs.drain(rr)
+			assert.Equal(t, 1, len(rr.Subs))
+			assert.Equal(t, pipelineHOLSubName, rr.Subs[0].Name)
+			assert.Equal(t, "ahead 1", rr.Subs[0].Status)
+			assert.GreaterOrEqual(t, rr.Subs[0].Cost, 40*time.Millisecond)
+		}},
+		{"out of order", func(w *bufio.Writer, seqs []string) {
+			writeSeqResponse(w, seqs[1])
+			writeSeqResponse(w, seqs[0])
+		}, func(t *testing.T, p *pipeliner, errs []error) {
+			for _, err := range errs {
+				assert.ErrorIs(t, err, errPipelineOrder)
+			}
+			assert.Equal(t, int64(1), p.outOfOrder)
+		}},
+		{"dropped", func(w *bufio.Writer, seqs []string) {
+			writeSeqResponse(w, seqs[0])
+		}, func(t *testing.T, p *pipeliner, errs []error) {
+			// 请求的发送顺序不确定，仅检查其中之一被丢弃
+			if errs[0] != nil {
+				errs[0], errs[1] = errs[1], errs[0]
+			}
+			assert.Nil(t, errs[0])
+			assert.ErrorIs(t, errs[1], errPipelineDropped)
+			assert.Equal(t, int64(1), p.dropped)
+		}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ln := pipelineServer(t, c.respond)
+			defer ln.Close()
+
+			opt := &Opt{pipeline: pipelineOption{depth: 4, conns: 1}, readTimeout: 200 * time.Millisecond}
+			p, err := newPipeliner(opt, ProxyHTTPDialerTimeout(0, dialer, false), false, &subRecorder{})
+			assert.Nil(t, err)
+
+			errs := doPipelined(p, ln.Addr().String())
+			assert.Equal(t, int64(1), p.dialed)
+			c.check(t, p, errs)
+		})
+	}
+}
+
+// TestPipelinerEarlyResponse answers a request with a body larger than the write and socket buffers before reading its body,
+// which is compliant, the response must not be taken as unexpected.
+func TestPipelinerEarlyResponse(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer ln.Close()
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		br, bw := bufio.NewReader(conn), bufio.NewWriter(conn)
+		var h fasthttp.RequestHeader
+		if h.Read(br) != nil {
+			return
+		}
+		writeSeqResponse(bw, string(h.Peek(pipelineSeqHeader)))
+		_ = bw.Flush()
+		_, _ = io.CopyN(io.Discard, br, int64(h.ContentLength()))
+		time.Sleep(time.Second)
+	}()
+
+	opt := &Opt{pipeline: pipelineOption{depth: 4, conns: 1}, readTimeout: time.Second}
+	p, err := newPipeliner(opt, ProxyHTTPDialerTimeout(0, dialer, false), false, &subRecorder{})
+	assert.Nil(t, err)
+
+	req, rsp := fasthttp.AcquireRequest(), fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseRequest(req)
+	defer fasthttp.ReleaseResponse(rsp)
+	req.SetRequestURI("http://" + ln.Addr().String() + "/")
+	req.Header.SetMethod("POST")
+	req.SetBody(bytes.Repeat([]byte("x"), 32<<20))
+
+	assert.Nil(t, p.Do(req, rsp))
+	assert.Equal(t, "ok", string(rsp.Body()))
+	assert.Equal(t, int64(0), p.unexpected)
+	assert.Equal(t, int64(1), p.received)
+}
@@ -2,6 +2,7 @@ package blow
 
 import (
 	"bufio"
+	"context"
 	"crypto/tls"
 	"crypto/x509"
 	"encoding/base64"
@@ -19,6 +20,7 @@ import (
 	"github.com/bingoohuang/gg/pkg/ss"
 	"github.com/valyala/fasthttp"
 	"golang.org/x/net/http/httpproxy"
+	"golang.org/x/net/proxy"
 )
 
 type Dialer interface {
@@ -119,61 +121,139 @@ func ProxyHTTPDialerTimeout(timeout time.Duration, dialer Dialer, tls bool) fast
 			return nil, err
 		}
 
-		if proxyURL == nil {
-			if timeout == 0 {
-				return dialer.Dial(addr)
-			}
-			return dialer.DialTimeout(addr, timeout)
-		}
+		return dialViaProxy(proxyURL, addr, timeout, dialer, tls)
+	}
+}
 
-		var conn net.Conn
+// dialViaProxy dials the addr through the proxy, directly when proxyURL is nil,
+// socks5:// and socks5h:// proxies tunnel all the connections, http proxies tunnel them by CONNECT when tunnel is true,
+// like the TLS ones, otherwise the plain connection to the proxy is returned for the requests sent in the absolute form.
+// Like curl, socks5:// resolves the host locally by the DNS options, while socks5h:// lets the proxy resolve it.
+func dialViaProxy(proxyURL *url.URL, addr string, timeout time.Duration, dialer Dialer, tunnel bool) (net.Conn, error) {
+	if proxyURL == nil {
 		if timeout == 0 {
-			conn, err = dialer.Dial(proxyURL.Host)
-		} else {
-			conn, err = dialer.DialTimeout(proxyURL.Host, timeout)
+			return dialer.Dial(addr)
+		}
+		return dialer.DialTimeout(addr, timeout)
+	}
+
+	if proxyURL.Scheme == "socks5" || proxyURL.Scheme == "socks5h" {
+		var auth *proxy.Auth
+		if proxyURL.User != nil {
+			password, _ := proxyURL.User.Password()
+			auth = &proxy.Auth{User: proxyURL.User.Username(), Password: password}
 		}
+		d, err := proxy.SOCKS5("tcp", proxyURL.Host, auth, &socksForward{dialer: dialer, timeout: timeout})
 		if err != nil {
 			return nil, err
 		}
-
-		if !tls {
-			return conn, nil
+		if proxyURL.Scheme == "socks5" {
+			if addr, err = resolveLocally(dialer, addr, timeout); err != nil {
+				return nil, err
+			}
 		}
+		return d.Dial("tcp", addr)
+	}
 
-		req := "CONNECT " + addr + " HTTP/1.1\r\n"
+	var conn net.Conn
+	var err error
+	if timeout == 0 {
+		conn, err = dialer.Dial(proxyURL.Host)
+	} else {
+		conn, err = dialer.DialTimeout(proxyURL.Host, timeout)
+	}
+	if err != nil {
+		return nil, err
+	}
 
-		if proxyURL.User != nil {
-			authBarrier := base64.StdEncoding.EncodeToString([]byte(proxyURL.User.String()))
-			req += "Proxy-Authorization: Basic " + authBarrier + "\r\n"
-		}
-		req += "\r\n"
+	if !tunnel {
+		return conn, nil
+	}
 
-		if _, err := conn.Write([]byte(req)); err != nil {
-			return nil, err
-		}
+	req := "CONNECT " + addr + " HTTP/1.1\r\n"
 
-		res := fasthttp.AcquireResponse()
-		defer fasthttp.ReleaseResponse(res)
+	if proxyURL.User != nil {
+		authBarrier := base64.StdEncoding.EncodeToString([]byte(proxyURL.User.String()))
+		req += "Proxy-Authorization: Basic " + authBarrier + "\r\n"
+	}
+	req += "\r\n"
 
-		res.SkipBody = true
+	if _, err := conn.Write([]byte(req)); err != nil {
+		return nil, err
+	}
 
-		if err := res.Read(bufio.NewReader(conn)); err != nil {
-			if connErr := conn.Close(); connErr != nil {
-				return nil, fmt.Errorf("conn close err %v precede by read conn err %w", connErr, err)
-			}
-			return nil, err
+	res := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseResponse(res)
+
+	res.SkipBody = true
+
+	if err := res.Read(bufio.NewReader(conn)); err != nil {
+		if connErr := conn.Close(); connErr != nil {
+			return nil, fmt.Errorf("conn close err %v precede by read conn err %w", connErr, err)
 		}
-		if res.Header.StatusCode() != 200 {
-			if connErr := conn.Close(); connErr != nil {
-				return nil, fmt.Errorf(
-					"conn close err %w precede by connect to proxy: code: %d body %q",
-					connErr, res.StatusCode(), string(res.Body()))
-			}
-			return nil, fmt.Errorf("could not connect to proxy: code: %d body %q", res.StatusCode(), string(res.Body()))
+		return nil, err
+	}
+	if res.Header.StatusCode() != 200 {
+		if connErr := conn.Close(); connErr != nil {
+			return nil, fmt.Errorf(
+				"conn close err %w precede by connect to proxy: code: %d body %q",
+				connErr, res.StatusCode(), string(res.Body()))
 		}
+		return nil, &proxyConnectError{code: res.StatusCode(), body: string(res.Body())}
+	}
 
-		return conn, nil
+	return conn, nil
+}
+
+// proxyConnectError is the non-200 response of the CONNECT request to the http proxy.
+type proxyConnectError struct {
+	code int
+	body string
+}
+
+func (e *proxyConnectError) Error() string {
+	return fmt.Sprintf("could not connect to proxy: code: %d body %q", e.code, e.body)
+}
+
+// resolveLocally resolves the host of addr to an IP for the socks5:// proxies,
+// by the -resolve and -dns.* options of the dialer if any.
+func resolveLocally(dialer Dialer, addr string, timeout time.Duration) (string, error) {
+	if d, ok := dialer.(*dnsDialer); ok {
+		return d.resolve(addr, timeout)
+	}
+
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil || net.ParseIP(host) != nil {
+		return addr, err
+	}
+
+	ctx := context.Background()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	ips, err := net.DefaultResolver.LookupHost(ctx, host)
+	if err == nil && len(ips) == 0 {
+		err = fmt.Errorf("no such host %s", host)
+	}
+	if err != nil {
+		return "", err
+	}
+	return net.JoinHostPort(ips[0], port), nil
+}
+
+// socksForward dials the SOCKS5 proxy server by the dialer of blow.
+type socksForward struct {
+	dialer  Dialer
+	timeout time.Duration
+}
+
+func (f *socksForward) Dial(_, addr string) (net.Conn, error) {
+	if f.timeout == 0 {
+		return f.dialer.Dial(addr)
 	}
+	return f.dialer.DialTimeout(addr, f.timeout)
 }
 
 type tlcpConnectionStater interface {
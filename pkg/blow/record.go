@@ -0,0 +1,290 @@
+package blow
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bingoohuang/berf/pkg/blow/internal"
+	"github.com/bingoohuang/gg/pkg/filex"
+	"github.com/bingoohuang/gg/pkg/ss"
+)
+
+// recorder is a local HTTP forward/reverse proxy which records the exchanges into a profile.
+type recorder struct {
+	client *http.Client
+	// dialTimeout is the timeout to dial the upstream of the CONNECT tunnels.
+	dialTimeout time.Duration
+	// target is the reverse proxy target, nil for forward proxy.
+	target  *url.URL
+	out     string
+	hosts   []string
+	paths   []string
+	extract bool
+
+	exchanges []*internal.Exchange
+	mu        sync.Mutex
+}
+
+// defaultRecordTimeout is the timeout of each proxied exchange of -record without -timeout.
+const defaultRecordTimeout = 30 * time.Second
+
+func (b *Bench) record(ctx context.Context) error {
+	timeout, err := parseDurations(*pTimeout)
+	if err != nil {
+		return err
+	}
+
+	rc := newRecorder(ss.Or(*pRecordOut, "record.http"), timeout)
+	rc.hosts = ss.Split(*pRecordHosts, ss.WithSeps(","), ss.WithTrimSpace(true), ss.WithIgnoreEmpty(true))
+	rc.paths = ss.Split(*pRecordPaths, ss.WithSeps(","), ss.WithTrimSpace(true), ss.WithIgnoreEmpty(true))
+	rc.extract = *pRecordExtract
+
+	if filex.Exists(rc.out) {
+		return fmt.Errorf("%s file already exists, please remove or rename it first", rc.out)
+	}
+
+	if *pRecordTarget != "" {
+		if rc.target, err = url.Parse(*pRecordTarget); err != nil {
+			return fmt.Errorf("parse -record.target %s: %w", *pRecordTarget, err)
+		}
+	}
+
+	server := &http.Server{Addr: *pRecord, Handler: rc}
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
+	defer stop()
+	shutdown := make(chan struct{})
+	go func() {
+		defer close(shutdown)
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		defer cancel()
+		_ = server.Shutdown(shutdownCtx)
+	}()
+
+	if rc.target != nil {
+		log.Printf("recording reverse proxy on %s to %s, writing to %s when stopped, Ctrl+C to stop", *pRecord, rc.target, rc.out)
+	} else {
+		log.Printf("recording forward proxy on %s, writing to %s when stopped, Ctrl+C to stop", *pRecord, rc.out)
+	}
+
+	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		return err
+	}
+	// 等待进行中的交换完成后，一次写入
+	<-shutdown
+
+	if err := rc.flush(); err != nil {
+		return err
+	}
+	return io.EOF
+}
+
+// newRecorder creates the recorder writing to out, with the timeouts of -timeout for the proxied exchanges.
+func newRecorder(out string, timeout *Durations) *recorder {
+	doTimeout, dialTimeout := timeout.Get("do"), timeout.Get("dial", "d")
+	if doTimeout == 0 {
+		doTimeout = defaultRecordTimeout
+	}
+	if dialTimeout == 0 {
+		dialTimeout = 10 * time.Second
+	}
+
+	return &recorder{
+		out:         out,
+		dialTimeout: dialTimeout,
+		client: &http.Client{
+			Transport: &http.Transport{
+				Proxy:                 http.ProxyFromEnvironment,
+				DialContext:           (&net.Dialer{Timeout: dialTimeout}).DialContext,
+				TLSClientConfig:       &tls.Config{InsecureSkipVerify: true},
+				ResponseHeaderTimeout: timeout.Get("read", "r"),
+			},
+			// 每次交换的超时，避免上游挂起时一直阻塞
+			Timeout: doTimeout,
+			// 重定向由客户端自行处理，录制每一次交换
+			CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		},
+	}
+}
+
+func (rc *recorder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodConnect {
+		// HTTPS 的 CONNECT 隧道无法解密，仅转发不录制，需要录制时使用 -record.target 反向代理
+		rc.tunnel(w, r)
+		return
+	}
+
+	target := r.URL
+	if rc.target != nil {
+		target = rc.target.ResolveReference(&url.URL{Path: singleJoiningSlash(rc.target.Path, r.URL.Path), RawQuery: r.URL.RawQuery})
+	} else if !r.URL.IsAbs() {
+		http.Error(w, "not a proxy request, use -record.target for reverse proxy", http.StatusBadRequest)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	outReq, err := http.NewRequestWithContext(r.Context(), r.Method, target.String(), bytes.NewReader(body))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	outReq.Header = r.Header.Clone()
+	// 由 Transport 处理压缩，以便录制解压后的响应体
+	outReq.Header.Del("Accept-Encoding")
+	for _, h := range []string{"Proxy-Connection", "Proxy-Authorization", "Connection", "Keep-Alive", "Te", "Upgrade"} {
+		outReq.Header.Del(h)
+	}
+
+	rsp, err := rc.client.Do(outReq)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer rsp.Body.Close()
+
+	rspBody, err := io.ReadAll(rsp.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	for k, vv := range rsp.Header {
+		if strings.EqualFold(k, "Content-Length") {
+			continue
+		}
+		for _, v := range vv {
+			w.Header().Add(k, v)
+		}
+	}
+	w.WriteHeader(rsp.StatusCode)
+	_, _ = w.Write(rspBody)
+
+	if rc.matches(target) {
+		rc.save(&internal.Exchange{
+			Method: r.Method, URL: target.String(), Header: outReq.Header, Body: body,
+			Status: rsp.StatusCode, RspHeader: rsp.Header, RspBody: rspBody,
+		})
+	}
+}
+
+func (rc *recorder) matches(u *url.URL) bool {
+	if len(rc.hosts) > 0 {
+		host, matched := u.Hostname(), false
+		for _, h := range rc.hosts {
+			if host == h || strings.HasSuffix(host, "."+h) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+
+	if len(rc.paths) > 0 {
+		for _, p := range rc.paths {
+			if matched, _ := filepath.Match(p, u.Path); matched || strings.HasPrefix(u.Path, p) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return true
+}
+
+// save appends the exchange, which is written by flush when the recorder stopped.
+func (rc *recorder) save(x *internal.Exchange) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	rc.exchanges = append(rc.exchanges, x)
+	log.Printf("recorded %s %s %d", x.Method, x.URL, x.Status)
+}
+
+// flush writes all the recorded exchanges to the profile at once,
+// because the extraction of dynamic values may change the earlier entries.
+func (rc *recorder) flush() error {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	if len(rc.exchanges) == 0 {
+		log.Printf("no requests recorded")
+		return nil
+	}
+
+	entries := internal.ExchangesToProfileEntries(rc.exchanges, rc.extract)
+	var buf bytes.Buffer
+	prefix := strings.TrimSuffix(rc.out, filepath.Ext(rc.out))
+	if err := internal.WriteProfileEntries(&buf, entries, prefix, filepath.Dir(rc.out)); err != nil {
+		return fmt.Errorf("write profile failed: %w", err)
+	}
+	if err := os.WriteFile(rc.out, buf.Bytes(), 0o644); err != nil {
+		return fmt.Errorf("write profile %s failed: %w", rc.out, err)
+	}
+
+	log.Printf("%d requests recorded to %s", len(rc.exchanges), rc.out)
+	return nil
+}
+
+func (rc *recorder) tunnel(w http.ResponseWriter, r *http.Request) {
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "hijacking not supported", http.StatusInternalServerError)
+		return
+	}
+
+	upstream, err := net.DialTimeout("tcp", r.Host, rc.dialTimeout)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	conn, _, err := hijacker.Hijack()
+	if err != nil {
+		upstream.Close()
+		return
+	}
+
+	log.Printf("W! CONNECT %s is tunneled without recording", r.Host)
+	_, _ = conn.Write([]byte("HTTP/1.1 200 Connection Established\r\n\r\n"))
+	go func() {
+		defer upstream.Close()
+		defer conn.Close()
+		_, _ = io.Copy(upstream, conn)
+	}()
+	go func() {
+		defer upstream.Close()
+		defer conn.Close()
+		_, _ = io.Copy(conn, upstream)
+	}()
+}
+
+func singleJoiningSlash(a, b string) string {
+	aslash, bslash := strings.HasSuffix(a, "/"), strings.HasPrefix(b, "/")
+	switch {
+	case aslash && bslash:
+		return a + b[1:]
+	case !aslash && !bslash:
+		return a + "/" + b
+	}
+	return a + b
+}
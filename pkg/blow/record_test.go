@@ -0,0 +1,58 @@
+package blow
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bingoohuang/berf/pkg/blow/internal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecorder(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/hang" {
+			time.Sleep(500 * time.Millisecond)
+		}
+		_, _ = w.Write([]byte(`{"id":1}`))
+	}))
+	defer upstream.Close()
+
+	timeout, err := parseDurations("do:100ms")
+	assert.Nil(t, err)
+	out := filepath.Join(t.TempDir(), "record.http")
+	rc := newRecorder(out, timeout)
+	rc.target, _ = url.Parse(upstream.URL)
+	proxy := httptest.NewServer(rc)
+	defer proxy.Close()
+
+	for _, path := range []string{"/users/1", "/users/2"} {
+		rsp, err := http.Get(proxy.URL + path)
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusOK, rsp.StatusCode)
+		_ = rsp.Body.Close()
+	}
+
+	// 上游挂起时，交换在超时后失败，不会一直阻塞
+	t1 := time.Now()
+	rsp, err := http.Get(proxy.URL + "/hang")
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusBadGateway, rsp.StatusCode)
+	_ = rsp.Body.Close()
+	assert.Less(t, time.Since(t1), 400*time.Millisecond)
+
+	// 录制过程中不写入，停止时一次写入
+	assert.NoFileExists(t, out)
+	assert.Nil(t, rc.flush())
+
+	profiles, err := internal.ParseProfileFile(out, &internal.ProfileOption{})
+	assert.Nil(t, err)
+	assert.Len(t, profiles, 2)
+	data, _ := os.ReadFile(out)
+	assert.True(t, strings.Contains(string(data), "/users/2"), string(data))
+}
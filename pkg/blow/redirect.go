@@ -0,0 +1,166 @@
+package blow
+
+import (
+	"errors"
+	"fmt"
+	"net/http/cookiejar"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bingoohuang/berf"
+	"github.com/valyala/fasthttp"
+)
+
+// redirectOption is the redirect policy of -redirect.
+type redirectOption struct {
+	// max is the max number of the redirects to follow, 0 for not following.
+	max int
+	// sameHost tells to follow the redirects to the same host only.
+	sameHost bool
+}
+
+const defaultMaxRedirects = 10
+
+var errTooManyRedirects = errors.New("too many redirects")
+
+// parseRedirectOption parses the redirect policy like off, 5, same-host or same-host:5.
+func parseRedirectOption(s string) (o redirectOption, err error) {
+	policy, n, hasN := strings.Cut(strings.ToLower(strings.TrimSpace(s)), ":")
+	switch policy {
+	case "", "off", "0":
+		return o, nil
+	case "same-host":
+		o.sameHost, o.max = true, defaultMaxRedirects
+		if !hasN {
+			return o, nil
+		}
+	default:
+		if hasN {
+			return o, fmt.Errorf("unknown -redirect %s, should be like off, 5, same-host or same-host:5", s)
+		}
+		n = policy
+	}
+
+	if o.max, err = strconv.Atoi(n); err != nil || o.max <= 0 {
+		return o, fmt.Errorf("invalid max redirects in -redirect %s", s)
+	}
+	return o, nil
+}
+
+// redirectLocation returns the URL to redirect to by the response of the request to u, nil if not redirected.
+func redirectLocation(u *url.URL, rsp *fasthttp.Response) (*url.URL, error) {
+	switch rsp.StatusCode() {
+	case fasthttp.StatusMovedPermanently, fasthttp.StatusFound, fasthttp.StatusSeeOther,
+		fasthttp.StatusTemporaryRedirect, fasthttp.StatusPermanentRedirect:
+	default:
+		return nil, nil
+	}
+
+	location := rsp.Header.Peek(fasthttp.HeaderLocation)
+	if len(location) == 0 {
+		return nil, nil
+	}
+	next, err := u.Parse(string(location))
+	if err != nil {
+		return nil, fmt.Errorf("invalid redirect location %s: %w", location, err)
+	}
+	return next, nil
+}
+
+func redirectHopName(n int, u *url.URL) string {
+	return fmt.Sprintf("redirect hop %d %s", n, u.Host)
+}
+
+// followRedirects follows the redirects of the response by -redirect, the final response of the chain is left in rsp.
+// Every hop of the chain is recorded as a sub operation with its status and latency, cost is the one of the first hop.
+func (r *Invoker) followRedirects(s *vuState, req *fasthttp.Request, rsp *fasthttp.Response, rr *berf.Result,
+	signer Signer, cost time.Duration,
+) error {
+	o := r.opt.redirect
+	if o.max == 0 {
+		return nil
+	}
+	cur := requestURL(req)
+	if cur == nil {
+		return nil
+	}
+
+	hop := fasthttp.AcquireRequest()
+	defer fasthttp.ReleaseRequest(hop)
+
+	for n := 1; ; n++ {
+		next, err := redirectLocation(cur, rsp)
+		if err != nil {
+			return err
+		}
+
+		status := rsp.StatusCode()
+		keepMethod := status == fasthttp.StatusTemporaryRedirect || status == fasthttp.StatusPermanentRedirect
+		if next == nil || o.sameHost && !strings.EqualFold(next.Host, cur.Host) || keepMethod && req.IsBodyStream() {
+			if n > 1 {
+				rr.AddSub(redirectHopName(n, cur), strconv.Itoa(status), cost)
+			}
+			return nil
+		}
+
+		rr.AddSub(redirectHopName(n, cur), strconv.Itoa(status), cost)
+		if n > o.max {
+			return fmt.Errorf("%w, stopped after %d redirects", errTooManyRedirects, o.max)
+		}
+
+		if n == 1 {
+			req.CopyTo(hop)
+		}
+		redirectRequest(hop, cur, next, keepMethod, s.jar)
+		if signer != nil {
+			if err := signer.Sign(hop); err != nil {
+				return err
+			}
+		}
+
+		rsp.Reset()
+		t1 := time.Now()
+		err = r.do(s, hop, rsp, rr)
+		cost = time.Since(t1)
+		rr.Cost += cost
+		if err != nil {
+			rr.AddSub(redirectHopName(n+1, next), "error", cost)
+			return err
+		}
+		r.saveCookies(s, hop, rsp)
+		cur = next
+	}
+}
+
+// redirectRequest changes the request to follow the redirect from the URL to the next,
+// 307 and 308 keep the method and body, while 301, 302 and 303 change to GET without the body like browsers.
+func redirectRequest(req *fasthttp.Request, from, next *url.URL, keepMethod bool, jar *cookiejar.Jar) {
+	if !keepMethod {
+		if !req.Header.IsHead() {
+			req.Header.SetMethod(fasthttp.MethodGet)
+		}
+		req.ResetBody()
+		req.Header.SetContentLength(0)
+		req.Header.Del(fasthttp.HeaderContentType)
+	}
+
+	req.SetRequestURI(next.String())
+	req.UseHostHeader = false
+	req.Header.SetHost(next.Host)
+	proxyURL, _ := proxyFunc(next.Host, next.Scheme == "https")
+	req.UsingProxy = proxyURL != nil
+
+	sameHost := strings.EqualFold(from.Hostname(), next.Hostname())
+	if !sameHost {
+		// 跨主机时不携带认证信息
+		req.Header.Del(fasthttp.HeaderAuthorization)
+	}
+	if jar != nil {
+		req.Header.DelAllCookies()
+		applyCookies(jar, req)
+	} else if !sameHost {
+		req.Header.DelAllCookies()
+	}
+}
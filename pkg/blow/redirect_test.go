@@ -0,0 +1,93 @@
+package blow
+
+import (
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bingoohuang/berf"
+	"github.com/stretchr/testify/assert"
+	"github.com/valyala/fasthttp"
+)
+
+func TestParseRedirectOption(t *testing.T) {
+	for s, expected := range map[string]redirectOption{
+		"":            {},
+		"off":         {},
+		"5":           {max: 5},
+		"same-host":   {max: defaultMaxRedirects, sameHost: true},
+		"same-host:3": {max: 3, sameHost: true},
+	} {
+		o, err := parseRedirectOption(s)
+		assert.Nil(t, err, s)
+		assert.Equal(t, expected, o, s)
+	}
+
+	for _, s := range []string{"-1", "abc", "5:3", "same-host:0"} {
+		_, err := parseRedirectOption(s)
+		assert.NotNil(t, err, s)
+	}
+}
+
+func TestFollowRedirects(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/sso", http.StatusSeeOther)
+	})
+	mux.HandleFunc("/sso", func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "sid", Value: r.Method})
+		http.Redirect(w, r, "/keep", http.StatusFound)
+	})
+	mux.HandleFunc("/keep", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/echo", http.StatusTemporaryRedirect)
+	})
+	mux.HandleFunc("/echo", func(w http.ResponseWriter, r *http.Request) {
+		c, _ := r.Cookie("sid")
+		body, _ := io.ReadAll(r.Body)
+		_, _ = w.Write([]byte(r.Method + " " + c.Value + " " + string(body)))
+	})
+	mux.HandleFunc("/loop", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/loop", http.StatusFound)
+	})
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	jar, _ := cookiejar.New(nil)
+	r := &Invoker{opt: &Opt{redirect: redirectOption{max: 3}}, httpInvoke: (&fasthttp.Client{}).Do}
+	s := &vuState{jar: jar}
+
+	send := func(path string) (*fasthttp.Response, *berf.Result, error) {
+		req, rsp := fasthttp.AcquireRequest(), fasthttp.AcquireResponse()
+		defer fasthttp.ReleaseRequest(req)
+		req.Header.SetMethod(fasthttp.MethodPost)
+		req.SetRequestURI(ts.URL + path)
+		req.SetBodyString("a=1")
+
+		rr := &berf.Result{}
+		assert.Nil(t, r.do(s, req, rsp, rr))
+		return rsp, rr, r.followRedirects(s, req, rsp, rr, nil, 0)
+	}
+
+	rsp, rr, err := send("/login")
+	assert.Nil(t, err)
+	assert.Equal(t, 200, rsp.StatusCode())
+	// 303 改为不带请求体的 GET，307 保持方法和请求体（此时已为 GET）
+	assert.Equal(t, "GET GET ", string(rsp.Body()))
+
+	var statuses []string
+	for _, sub := range rr.Subs {
+		statuses = append(statuses, sub.Status)
+	}
+	assert.Equal(t, []string{"303", "302", "307", "200"}, statuses)
+	assert.Equal(t, "redirect hop 1 "+ts.Listener.Addr().String(), rr.Subs[0].Name)
+
+	rsp, _, err = send("/keep")
+	assert.Nil(t, err)
+	assert.Equal(t, "POST GET a=1", string(rsp.Body()))
+
+	_, rr, err = send("/loop")
+	assert.ErrorIs(t, err, errTooManyRedirects)
+	assert.Equal(t, 4, len(rr.Subs))
+}
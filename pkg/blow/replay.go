@@ -0,0 +1,148 @@
+package blow
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bingoohuang/berf"
+	"github.com/bingoohuang/berf/pkg/blow/internal"
+	"github.com/valyala/fasthttp"
+)
+
+// replayOption is the option to replay the access log.
+type replayOption struct {
+	file string
+	base string
+	// speed scales the recorded timing, 2 for 2x faster, 0 for as fast as possible.
+	speed float64
+}
+
+// replayer reads the access log and sends the entries at their recorded timing.
+type replayer struct {
+	ch chan *internal.ReplayEntry
+}
+
+func newReplayer(ctx context.Context, opt *replayOption) (*replayer, error) {
+	f, err := os.Open(opt.file)
+	if err != nil {
+		return nil, err
+	}
+
+	rp := &replayer{ch: make(chan *internal.ReplayEntry)}
+	go rp.schedule(ctx, f, opt.speed)
+	return rp, nil
+}
+
+func (p *replayer) schedule(ctx context.Context, f *os.File, speed float64) {
+	defer close(p.ch)
+	defer f.Close()
+
+	var t0, w0 time.Time
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		e, err := internal.ParseReplayLine(line)
+		if err != nil {
+			log.Printf("W! replay line %d ignored: %v", lineNo, err)
+			continue
+		}
+
+		if speed > 0 && !e.Time.IsZero() {
+			if t0.IsZero() {
+				t0, w0 = e.Time, time.Now()
+			}
+			delay := time.Duration(float64(e.Time.Sub(t0)) / speed)
+			if wait := time.Until(w0.Add(delay)); wait > 0 {
+				select {
+				case <-time.After(wait):
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+
+		select {
+		case p.ch <- e:
+		case <-ctx.Done():
+			return
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		log.Printf("W! read replay file failed: %v", err)
+	}
+}
+
+func (r *Invoker) runReplay(ctx context.Context, req *fasthttp.Request, rsp *fasthttp.Response) (*berf.Result, error) {
+	var e *internal.ReplayEntry
+	select {
+	case v, ok := <-r.replay.ch:
+		if !ok { // all the entries are replayed
+			return nil, io.EOF
+		}
+		e = v
+	case <-ctx.Done():
+		return nil, io.EOF
+	}
+
+	r.setReq(req)
+	if err := setReplayReq(req, e); err != nil {
+		return nil, err
+	}
+
+	rr := &berf.Result{}
+	err := r.doRequest(ctx, req, rsp, rr)
+	r.updateThroughput(rr)
+
+	// 按照 URL 模式对比回放与日志记录的状态码及耗时
+	pattern := e.Method + " " + internal.URLPattern(e.URL)
+	status := "error"
+	if err == nil {
+		status = strconv.Itoa(rsp.StatusCode())
+		if e.Status > 0 && e.Status != rsp.StatusCode() {
+			status += fmt.Sprintf("(logged %d)", e.Status)
+		}
+	}
+	rr.AddSub(pattern, status, rr.Cost)
+	if e.Latency > 0 {
+		rr.AddSub(pattern+" [logged]", strconv.Itoa(e.Status), e.Latency)
+	}
+
+	return rr, err
+}
+
+func setReplayReq(req *fasthttp.Request, e *internal.ReplayEntry) error {
+	u, err := url.Parse(e.URL)
+	if err != nil {
+		return fmt.Errorf("parse replay url %s: %w", e.URL, err)
+	}
+
+	// 使用 -replay.base 的主机，仅保留日志中的路径及查询参数
+	req.Header.SetMethod(e.Method)
+	req.Header.SetRequestURI(u.RequestURI())
+	for k, v := range e.Header {
+		switch strings.ToLower(k) {
+		case "host", "content-length", "connection", "transfer-encoding":
+		default:
+			req.Header.Set(k, v)
+		}
+	}
+	if e.Body != "" {
+		req.SetBodyString(e.Body)
+	}
+
+	return nil
+}
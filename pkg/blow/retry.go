@@ -0,0 +1,242 @@
+package blow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/bingoohuang/berf"
+	"github.com/valyala/fasthttp"
+)
+
+// retryOption is the retry policy of -retry.
+type retryOption struct {
+	// attempts is the max number of the attempts, including the first one.
+	attempts int
+	// statuses are the retryable statuses, like 503 or 5xx.
+	statuses []string
+	// errors are the retryable error classes, timeout, reset, refused, eof or all.
+	errors map[string]bool
+	// base and max are the exponential backoff before the first retry, and its upper limit.
+	base, max time.Duration
+	// jitter is the jitter of the backoff, full, equal or none.
+	jitter string
+}
+
+// retryStats is the counters of the requests with the retry policy,
+// failed is the number of the requests ended with a non-retryable error or non-2xx/3xx response.
+type retryStats struct {
+	requests, firstOK, eventualOK, failed, retried, retries, exhausted int64
+}
+
+// parseRetryOption parses the retry policy like 3 or attempts=3,status=429/5xx,errors=timeout/reset,backoff=100ms:5s,jitter=full,
+// nil for no retries.
+func parseRetryOption(s string) (*retryOption, error) {
+	if s = strings.TrimSpace(s); s == "" || s == "off" || s == "0" {
+		return nil, nil
+	}
+
+	o := &retryOption{
+		attempts: 3,
+		statuses: []string{"429", "502", "503", "504"},
+		errors:   map[string]bool{"timeout": true, "reset": true, "refused": true, "eof": true},
+		base:     100 * time.Millisecond,
+		max:      5 * time.Second,
+		jitter:   "full",
+	}
+	for i, item := range splitComma(s) {
+		k, v, ok := strings.Cut(item, "=")
+		if !ok && i == 0 {
+			k, v = "attempts", item
+		}
+
+		var err error
+		switch k = strings.ToLower(strings.TrimSpace(k)); k {
+		case "attempts":
+			if o.attempts, err = strconv.Atoi(v); err == nil && o.attempts < 1 {
+				err = fmt.Errorf("should be at least 1")
+			}
+		case "status":
+			o.statuses = nil
+			for _, status := range strings.Split(v, "/") {
+				if status = strings.ToLower(strings.TrimSpace(status)); len(status) != 3 {
+					return nil, fmt.Errorf("invalid status %s in -retry %s, should be like 503 or 5xx", status, s)
+				}
+				o.statuses = append(o.statuses, status)
+			}
+		case "errors":
+			o.errors = map[string]bool{}
+			for _, class := range strings.Split(v, "/") {
+				switch class = strings.ToLower(strings.TrimSpace(class)); class {
+				case "timeout", "reset", "refused", "eof", "all":
+					o.errors[class] = true
+				case "none":
+				default:
+					return nil, fmt.Errorf("unknown error class %s in -retry %s, should be timeout, reset, refused, eof, all or none", class, s)
+				}
+			}
+		case "backoff":
+			base, limit, _ := strings.Cut(v, ":")
+			if o.base, err = time.ParseDuration(base); err == nil && limit != "" {
+				o.max, err = time.ParseDuration(limit)
+			}
+		case "jitter":
+			if o.jitter = strings.ToLower(v); o.jitter != "full" && o.jitter != "equal" && o.jitter != "none" {
+				err = fmt.Errorf("should be full, equal or none")
+			}
+		default:
+			return nil, fmt.Errorf("unknown option %s in -retry %s", k, s)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s in -retry %s: %w", k, s, err)
+		}
+	}
+	return o, nil
+}
+
+// retryableStatus tells the status is retryable.
+func (o *retryOption) retryableStatus(status int) bool {
+	code := strconv.Itoa(status)
+	for _, s := range o.statuses {
+		if s == code || strings.HasSuffix(s, "xx") && s[0] == code[0] {
+			return true
+		}
+	}
+	return false
+}
+
+// errorClass classifies the error as timeout, reset, refused, eof or error.
+func errorClass(err error) string {
+	switch {
+	case isTimeout(err) || errors.Is(err, fasthttp.ErrDialTimeout):
+		return "timeout"
+	case errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE):
+		return "reset"
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return "refused"
+	case errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, fasthttp.ErrConnectionClosed):
+		return "eof"
+	default:
+		return "error"
+	}
+}
+
+// retryable tells the attempt is failed by the retryable statuses or errors, and its status for the sub operation.
+func (o *retryOption) retryable(rsp *fasthttp.Response, err error) (bool, string) {
+	if err != nil {
+		class := errorClass(err)
+		return o.errors["all"] || o.errors[class], class
+	}
+	status := rsp.StatusCode()
+	return o.retryableStatus(status), strconv.Itoa(status)
+}
+
+// backoff returns the delay before the retry after the attempt, by the Retry-After of the response if any,
+// or the exponential backoff with jitter, both are capped by the max backoff, so that a Retry-After
+// like 3600 does not park the virtual user for an hour.
+func (o *retryOption) backoff(attempt int, retryAfter []byte) time.Duration {
+	if d, ok := parseRetryAfter(retryAfter); ok {
+		return min(d, o.max)
+	}
+
+	d := o.base << (attempt - 1)
+	if d > o.max || d <= 0 {
+		d = o.max
+	}
+	switch o.jitter {
+	case "full":
+		return time.Duration(rand.Int63n(int64(d) + 1))
+	case "equal":
+		return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+	}
+	return d
+}
+
+// parseRetryAfter parses the Retry-After header of the seconds or the HTTP date.
+func parseRetryAfter(v []byte) (time.Duration, bool) {
+	if len(v) == 0 {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(string(v)); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if t, err := http.ParseTime(string(v)); err == nil {
+		return max(time.Until(t), 0), true
+	}
+	return 0, false
+}
+
+// invokeRetry invokes the request with the retries by -retry, rr.Cost is the user-perceived latency
+// including all the attempts and backoffs, while every attempt is recorded as a sub operation with its own latency.
+func (r *Invoker) invokeRetry(ctx context.Context, req *fasthttp.Request, rsp *fasthttp.Response, rr *berf.Result,
+	signer Signer, digest *digestCred,
+) error {
+	o := r.opt.retry
+	if o == nil {
+		return r.invoke(ctx, req, rsp, rr, signer, digest)
+	}
+
+	st := &r.retryStats
+	atomic.AddInt64(&st.requests, 1)
+	for attempt := 1; ; attempt++ {
+		before := rr.Cost
+		err := r.invoke(ctx, req, rsp, rr, signer, digest)
+		retryable, status := o.retryable(rsp, err)
+		rr.AddSub("attempt "+strconv.Itoa(attempt), status, rr.Cost-before)
+
+		if !retryable || req.IsBodyStream() {
+			if code := rsp.StatusCode(); err == nil && code >= 200 && code < 400 {
+				if attempt == 1 {
+					atomic.AddInt64(&st.firstOK, 1)
+				}
+				atomic.AddInt64(&st.eventualOK, 1)
+			} else {
+				atomic.AddInt64(&st.failed, 1)
+			}
+			return err
+		}
+		if attempt >= o.attempts {
+			atomic.AddInt64(&st.exhausted, 1)
+			return err
+		}
+
+		if attempt == 1 {
+			atomic.AddInt64(&st.retried, 1)
+		}
+		atomic.AddInt64(&st.retries, 1)
+
+		var retryAfter []byte
+		if err == nil {
+			retryAfter = rsp.Header.Peek(fasthttp.HeaderRetryAfter)
+		}
+		t1 := time.Now()
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(o.backoff(attempt, retryAfter)):
+		}
+		rr.Cost += time.Since(t1)
+		rsp.Reset()
+	}
+}
+
+// report prints the counters of the retries.
+func (st *retryStats) report(w io.Writer) {
+	requests := atomic.LoadInt64(&st.requests)
+	if requests == 0 {
+		return
+	}
+
+	_, _ = fmt.Fprintf(w, "\nRetries: requests %d, first-try success %.2f%%, eventual success %.2f%%, failed %d, retried requests %d, retries %d, exhausted %d\n",
+		requests, float64(atomic.LoadInt64(&st.firstOK))*100/float64(requests),
+		float64(atomic.LoadInt64(&st.eventualOK))*100/float64(requests), atomic.LoadInt64(&st.failed),
+		atomic.LoadInt64(&st.retried), atomic.LoadInt64(&st.retries), atomic.LoadInt64(&st.exhausted))
+}
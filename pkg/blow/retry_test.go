@@ -0,0 +1,118 @@
+package blow
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/bingoohuang/berf"
+	"github.com/stretchr/testify/assert"
+	"github.com/valyala/fasthttp"
+)
+
+func TestParseRetryOption(t *testing.T) {
+	o, err := parseRetryOption("")
+	assert.Nil(t, err)
+	assert.Nil(t, o)
+
+	o, err = parseRetryOption("5,status=5xx/429,errors=timeout,backoff=10ms:1s,jitter=none")
+	assert.Nil(t, err)
+	assert.Equal(t, &retryOption{
+		attempts: 5, statuses: []string{"5xx", "429"}, errors: map[string]bool{"timeout": true},
+		base: 10 * time.Millisecond, max: time.Second, jitter: "none",
+	}, o)
+	assert.True(t, o.retryableStatus(500))
+	assert.True(t, o.retryableStatus(429))
+	assert.False(t, o.retryableStatus(404))
+	assert.Equal(t, 40*time.Millisecond, o.backoff(3, nil))
+	assert.Equal(t, time.Second, o.backoff(20, nil))
+	assert.Equal(t, time.Duration(0), o.backoff(1, []byte("0")))
+	// Retry-After 不超过最大退避时间
+	assert.Equal(t, time.Second, o.backoff(1, []byte("2")))
+	assert.Equal(t, time.Second, o.backoff(1, []byte("3600")))
+	assert.Equal(t, time.Second, o.backoff(1, []byte(time.Now().Add(time.Hour).UTC().Format(http.TimeFormat))))
+
+	for _, s := range []string{"attempts=0", "status=50", "errors=boom", "jitter=some", "foo=1", "backoff=x"} {
+		_, err := parseRetryOption(s)
+		assert.NotNil(t, err, s)
+	}
+}
+
+func TestErrorClass(t *testing.T) {
+	assert.Equal(t, "timeout", errorClass(fasthttp.ErrTimeout))
+	assert.Equal(t, "reset", errorClass(&net.OpError{Op: "read", Err: syscall.ECONNRESET}))
+	assert.Equal(t, "refused", errorClass(&net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}))
+	assert.Equal(t, "eof", errorClass(fasthttp.ErrConnectionClosed))
+	assert.Equal(t, "error", errorClass(errors.New("boom")))
+}
+
+func TestInvokeRetry(t *testing.T) {
+	var calls int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1)%3 != 0 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer ts.Close()
+
+	o, _ := parseRetryOption("3,backoff=1ms")
+	r := &Invoker{opt: &Opt{retry: o}, httpInvoke: (&fasthttp.Client{}).Do, sharedState: &vuState{}}
+
+	send := func() (*fasthttp.Response, *berf.Result) {
+		req, rsp := fasthttp.AcquireRequest(), fasthttp.AcquireResponse()
+		defer fasthttp.ReleaseRequest(req)
+		req.SetRequestURI(ts.URL)
+
+		rr := &berf.Result{}
+		assert.Nil(t, r.invokeRetry(context.Background(), req, rsp, rr, nil, nil))
+		return rsp, rr
+	}
+
+	rsp, rr := send()
+	assert.Equal(t, 200, rsp.StatusCode())
+	var statuses []string
+	for _, sub := range rr.Subs {
+		statuses = append(statuses, sub.Name+" "+sub.Status)
+	}
+	assert.Equal(t, []string{"attempt 1 503", "attempt 2 503", "attempt 3 200"}, statuses)
+
+	// 第 4、5 次失败，第 6 次成功
+	r.opt.retry.attempts = 2
+	rsp, _ = send()
+	assert.Equal(t, 503, rsp.StatusCode())
+
+	st := &r.retryStats
+	assert.Equal(t, retryStats{requests: 2, firstOK: 0, eventualOK: 1, retried: 2, retries: 3, exhausted: 1}, *st)
+}
+
+func TestInvokeRetryFailed(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/500":
+			w.WriteHeader(http.StatusInternalServerError)
+		case "/404":
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	o, _ := parseRetryOption("3,backoff=1ms")
+	r := &Invoker{opt: &Opt{retry: o}, httpInvoke: (&fasthttp.Client{}).Do, sharedState: &vuState{}}
+	for _, path := range []string{"/500", "/404", "/"} {
+		req, rsp := fasthttp.AcquireRequest(), fasthttp.AcquireResponse()
+		req.SetRequestURI(ts.URL + path)
+		assert.Nil(t, r.invokeRetry(context.Background(), req, rsp, &berf.Result{}, nil, nil))
+		fasthttp.ReleaseRequest(req)
+		fasthttp.ReleaseResponse(rsp)
+	}
+
+	// 500 和 404 不在重试的状态码中，不重试，但也不算成功
+	assert.Equal(t, retryStats{requests: 3, firstOK: 1, eventualOK: 1, failed: 2}, r.retryStats)
+}
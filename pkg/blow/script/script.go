@@ -0,0 +1,183 @@
+// Package script runs the JavaScript hooks before the requests and after the responses.
+package script
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/dop251/goja"
+)
+
+// Script is a compiled JavaScript hook.
+type Script struct {
+	name    string
+	program *goja.Program
+}
+
+func (s *Script) String() string { return s.name }
+
+// Compile compiles the JavaScript source, name is used in the error messages.
+func Compile(name, src string) (*Script, error) {
+	p, err := goja.Compile(name, src, false)
+	if err != nil {
+		return nil, fmt.Errorf("compile script %s: %w", name, err)
+	}
+	return &Script{name: name, program: p}, nil
+}
+
+// Load compiles the JavaScript file.
+func Load(file string) (*Script, error) {
+	src, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("read script %s: %w", file, err)
+	}
+	return Compile(file, string(src))
+}
+
+// Request is the request exposed to the scripts as the global request,
+// the changes of the pre-request scripts are applied to the request to be sent.
+type Request struct {
+	Headers map[string]string
+	Method  string
+	URL     string
+	Body    string
+}
+
+// Response is the response exposed to the post-response scripts as the global response.
+type Response struct {
+	Headers map[string]string
+	Body    string
+	Status  int
+}
+
+// Runtime runs the scripts of a virtual user, it is not safe for concurrent use.
+type Runtime struct {
+	vm     *goja.Runtime
+	vars   map[string]string
+	failed string
+}
+
+// NewRuntime creates a runtime, vars are the variables of the virtual user, read and written by vars.get/vars.set.
+func NewRuntime(vars map[string]string) *Runtime {
+	rt := &Runtime{vm: goja.New(), vars: vars}
+
+	v := rt.vm.NewObject()
+	_ = v.Set("get", func(k string) string { return rt.vars[k] })
+	_ = v.Set("set", func(k string, val goja.Value) { rt.vars[k] = val.String() })
+	_ = rt.vm.Set("vars", v)
+
+	// fail 标记当前请求失败，参数作为统计中的状态，例如 fail("bad-order")
+	_ = rt.vm.Set("fail", func(status string) {
+		rt.failed = status
+		if rt.failed == "" {
+			rt.failed = "script-fail"
+		}
+	})
+
+	console := rt.vm.NewObject()
+	_ = console.Set("log", func(args ...interface{}) { log.Println(args...) })
+	_ = rt.vm.Set("console", console)
+
+	c := rt.vm.NewObject()
+	_ = c.Set("md5", func(s string) string { return hashHex(md5.New(), s) })
+	_ = c.Set("sha1", func(s string) string { return hashHex(sha1.New(), s) })
+	_ = c.Set("sha256", func(s string) string { return hashHex(sha256.New(), s) })
+	_ = c.Set("hmacSha256", func(key, s string) string { return hashHex(hmac.New(sha256.New, []byte(key)), s) })
+	_ = c.Set("base64", func(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) })
+	_ = c.Set("base64Decode", func(s string) (string, error) {
+		d, err := base64.StdEncoding.DecodeString(s)
+		return string(d), err
+	})
+	_ = rt.vm.Set("crypto", c)
+
+	return rt
+}
+
+func hashHex(h hash.Hash, s string) string {
+	h.Write([]byte(s))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Pre runs the pre-request script, the changes to the global request are written back to req,
+// failed is the status given by fail() in the script.
+func (rt *Runtime) Pre(s *Script, req *Request) (failed string, err error) {
+	r := rt.requestObject(req)
+	_ = rt.vm.Set("response", goja.Undefined())
+	if failed, err = rt.run(s); err != nil {
+		return failed, err
+	}
+
+	req.Method = r.Get("method").String()
+	req.URL = r.Get("url").String()
+	req.Body = r.Get("body").String()
+	req.Headers = map[string]string{}
+	if h := r.Get("headers"); h != nil && !goja.IsUndefined(h) && !goja.IsNull(h) {
+		ho := h.ToObject(rt.vm)
+		for _, k := range ho.Keys() {
+			req.Headers[k] = ho.Get(k).String()
+		}
+	}
+
+	return failed, nil
+}
+
+// Post runs the post-response script, response.json is the parsed body when it is a JSON.
+func (rt *Runtime) Post(s *Script, req *Request, rsp *Response) (failed string, err error) {
+	rt.requestObject(req)
+
+	o := rt.vm.NewObject()
+	_ = o.Set("status", rsp.Status)
+	_ = o.Set("headers", rt.headersObject(rsp.Headers))
+	_ = o.Set("body", rsp.Body)
+	if json.Valid([]byte(rsp.Body)) {
+		var v interface{}
+		if err := json.Unmarshal([]byte(rsp.Body), &v); err == nil {
+			_ = o.Set("json", v)
+		}
+	}
+	_ = rt.vm.Set("response", o)
+
+	return rt.run(s)
+}
+
+func (rt *Runtime) requestObject(req *Request) *goja.Object {
+	r := rt.vm.NewObject()
+	_ = r.Set("method", req.Method)
+	_ = r.Set("url", req.URL)
+	_ = r.Set("body", req.Body)
+	_ = r.Set("headers", rt.headersObject(req.Headers))
+	_ = rt.vm.Set("request", r)
+	return r
+}
+
+// headersObject creates a plain JS object of the headers, so that the scripts can change it by request.headers["X-Sign"] = sign.
+func (rt *Runtime) headersObject(headers map[string]string) *goja.Object {
+	h := rt.vm.NewObject()
+	for k, v := range headers {
+		_ = h.Set(k, v)
+	}
+	return h
+}
+
+func (rt *Runtime) run(s *Script) (string, error) {
+	rt.failed = ""
+	if _, err := rt.vm.RunProgram(s.program); err != nil {
+		var ex *goja.Exception
+		if errors.As(err, &ex) {
+			return "", fmt.Errorf("script %s: %s", s.name, strings.TrimSpace(ex.String()))
+		}
+		return "", fmt.Errorf("script %s: %w", s.name, err)
+	}
+	return rt.failed, nil
+}
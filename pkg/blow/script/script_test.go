@@ -0,0 +1,47 @@
+package script
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPre(t *testing.T) {
+	s, err := Compile("pre", `
+request.headers["X-Sign"] = crypto.hmacSha256("key", request.body)
+request.url = request.url + "?ts=" + vars.get("ts")
+delete request.headers["X-Remove"]
+`)
+	assert.Nil(t, err)
+
+	rt := NewRuntime(map[string]string{"ts": "123"})
+	req := &Request{Method: "POST", URL: "http://a.cn/orders", Body: "abc", Headers: map[string]string{"X-Remove": "1"}}
+	failed, err := rt.Pre(s, req)
+	assert.Nil(t, err)
+	assert.Equal(t, "", failed)
+	assert.Equal(t, "http://a.cn/orders?ts=123", req.URL)
+	assert.Equal(t, map[string]string{"X-Sign": "9c196e32dc0175f86f4b1cb89289d6619de6bee699e4c378e68309ed97a1a6ab"}, req.Headers)
+}
+
+func TestPost(t *testing.T) {
+	s, err := Compile("post", `
+if (response.status !== 200 || !response.json.data.items.length) fail("empty")
+for (const item of response.json.data.items) vars.set("last", item.id)
+`)
+	assert.Nil(t, err)
+
+	vars := map[string]string{}
+	rt := NewRuntime(vars)
+	req := &Request{Method: "GET", URL: "http://a.cn/orders"}
+	failed, err := rt.Post(s, req, &Response{Status: 200, Body: `{"data":{"items":[{"id":1},{"id":2}]}}`})
+	assert.Nil(t, err)
+	assert.Equal(t, "", failed)
+	assert.Equal(t, "2", vars["last"])
+
+	failed, err = rt.Post(s, req, &Response{Status: 200, Body: `{"data":{"items":[]}}`})
+	assert.Nil(t, err)
+	assert.Equal(t, "empty", failed)
+
+	_, err = rt.Post(s, req, &Response{Status: 500, Body: `oops`})
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,313 @@
+package blow
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bingoohuang/berf/pkg/blow/internal"
+	"github.com/bingoohuang/gg/pkg/ss"
+	"github.com/emmansun/gmsm/sm3"
+	"github.com/valyala/fasthttp"
+)
+
+// Signer signs the request right before it is sent, after the body is final.
+type Signer interface {
+	Sign(req *fasthttp.Request) error
+}
+
+// parseSigners parses the -sign arguments like [name=]algo:k=v;k=v,
+// the unnamed one is the default signer for all the requests,
+// the named ones are selected by the profile option [sign=name].
+func parseSigners(args []string) (def Signer, named map[string]Signer, err error) {
+	named = map[string]Signer{}
+	for _, arg := range args {
+		name := ""
+		if eq, colon := strings.Index(arg, "="), strings.Index(arg, ":"); eq > 0 && (colon < 0 || eq < colon) {
+			name, arg = arg[:eq], arg[eq+1:]
+		}
+
+		s, err := parseSigner(arg)
+		if err != nil {
+			return nil, nil, err
+		}
+		if name == "" {
+			def = s
+		} else {
+			named[name] = s
+		}
+	}
+
+	return def, named, nil
+}
+
+// parseSigner parses a signer spec like hmac:key=secret;header=X-Signature.
+func parseSigner(spec string) (Signer, error) {
+	algo, opts, _ := strings.Cut(spec, ":")
+	m := map[string]string{}
+	for _, kv := range strings.Split(opts, ";") {
+		if kv = strings.TrimSpace(kv); kv != "" {
+			k, v, _ := strings.Cut(kv, "=")
+			m[strings.ToLower(strings.TrimSpace(k))] = v
+		}
+	}
+
+	switch strings.ToLower(algo) {
+	case "hmac", "hmac-sha256":
+		return newTemplateSigner(m, sha256.New, "sha256")
+	case "sm3", "hmac-sm3":
+		return newTemplateSigner(m, sm3.New, "sm3")
+	case "sigv4", "aws", "aws4":
+		return newSigV4Signer(m)
+	}
+
+	return nil, fmt.Errorf("unknown signer %s, should be one of hmac, sm3, sigv4", algo)
+}
+
+// expandOption gets the option value, which can be from the environment like ${SECRET}.
+func expandOption(m map[string]string, key, defaultValue string) string {
+	if v, ok := m[strings.ToLower(key)]; ok && v != "" {
+		return os.ExpandEnv(v)
+	}
+	return defaultValue
+}
+
+// templateSigner signs the string from the template with HMAC, and sets the signature to the header.
+type templateSigner struct {
+	newHash     func() hash.Hash
+	algo        string
+	key         []byte
+	keyID       string
+	template    string
+	header      string
+	value       string
+	tsHeader    string
+	nonceHeader string
+	base64      bool
+}
+
+const defaultSignTemplate = `{method}\n{path}\n{timestamp}\n{bodyHash}`
+
+func newTemplateSigner(m map[string]string, newHash func() hash.Hash, algo string) (*templateSigner, error) {
+	s := &templateSigner{
+		newHash:     newHash,
+		algo:        algo,
+		key:         []byte(expandOption(m, "key", "")),
+		keyID:       expandOption(m, "keyId", ""),
+		template:    ss.Or(m["template"], defaultSignTemplate),
+		header:      ss.Or(m["header"], "X-Signature"),
+		value:       ss.Or(m["value"], "{signature}"),
+		tsHeader:    ss.Or(m["tsheader"], "X-Timestamp"),
+		nonceHeader: ss.Or(m["nonceheader"], "X-Nonce"),
+		base64:      strings.EqualFold(m["encoding"], "base64"),
+	}
+	if len(s.key) == 0 {
+		return nil, fmt.Errorf("key is required for %s signer", algo)
+	}
+
+	// 模板中的 \n 转义为换行，方便在命令行中指定
+	s.template = strings.ReplaceAll(s.template, `\n`, "\n")
+	return s, nil
+}
+
+func (s *templateSigner) Sign(req *fasthttp.Request) error {
+	now := time.Now()
+	ts := strconv.FormatInt(now.Unix(), 10)
+
+	var nonce string
+	if strings.Contains(s.template, "{nonce}") {
+		b := make([]byte, 16)
+		_, _ = rand.Read(b)
+		nonce = hex.EncodeToString(b)
+		req.Header.Set(s.nonceHeader, nonce)
+	}
+	req.Header.Set(s.tsHeader, ts)
+
+	bh := s.newHash()
+	if !req.IsBodyStream() {
+		bh.Write(req.Body())
+	}
+
+	r := strings.NewReplacer(
+		"{method}", string(req.Header.Method()),
+		"{path}", string(req.URI().PathOriginal()),
+		"{query}", string(req.URI().QueryString()),
+		"{host}", string(req.Host()),
+		"{timestamp}", ts,
+		"{timestampMs}", strconv.FormatInt(now.UnixMilli(), 10),
+		"{nonce}", nonce,
+		"{keyId}", s.keyID,
+		"{bodyHash}", hex.EncodeToString(bh.Sum(nil)),
+	)
+
+	mac := hmac.New(s.newHash, s.key)
+	mac.Write([]byte(r.Replace(s.template)))
+	signature := hex.EncodeToString(mac.Sum(nil))
+	if s.base64 {
+		signature = base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	}
+
+	value := strings.NewReplacer("{signature}", signature, "{keyId}", s.keyID, "{timestamp}", ts, "{algo}", s.algo).Replace(s.value)
+	req.Header.Set(s.header, value)
+	return nil
+}
+
+// sigV4Signer signs the request with AWS Signature Version 4.
+type sigV4Signer struct {
+	accessKey    string
+	secretKey    string
+	sessionToken string
+	region       string
+	service      string
+}
+
+func newSigV4Signer(m map[string]string) (*sigV4Signer, error) {
+	s := &sigV4Signer{
+		accessKey:    expandOption(m, "accessKey", os.Getenv("AWS_ACCESS_KEY_ID")),
+		secretKey:    expandOption(m, "secretKey", os.Getenv("AWS_SECRET_ACCESS_KEY")),
+		sessionToken: expandOption(m, "sessionToken", os.Getenv("AWS_SESSION_TOKEN")),
+		region:       expandOption(m, "region", ss.Or(os.Getenv("AWS_REGION"), "us-east-1")),
+		service:      expandOption(m, "service", "execute-api"),
+	}
+	if s.accessKey == "" || s.secretKey == "" {
+		return nil, fmt.Errorf("accessKey and secretKey (or env AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY) are required for sigv4 signer")
+	}
+	return s, nil
+}
+
+func (s *sigV4Signer) Sign(req *fasthttp.Request) error {
+	return s.sign(req, time.Now().UTC())
+}
+
+func (s *sigV4Signer) sign(req *fasthttp.Request, now time.Time) error {
+	amzDate := now.Format("20060102T150405Z")
+	date := amzDate[:8]
+
+	payloadHash := "UNSIGNED-PAYLOAD"
+	if !req.IsBodyStream() {
+		h := sha256.Sum256(req.Body())
+		payloadHash = hex.EncodeToString(h[:])
+	}
+
+	req.Header.Del("Authorization")
+	req.Header.Set("X-Amz-Date", amzDate)
+	if s.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.sessionToken)
+	}
+	if s.service == "s3" {
+		req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	}
+
+	headers := map[string]string{"host": string(req.Host())}
+	req.Header.VisitAll(func(k, v []byte) {
+		if lk := strings.ToLower(string(k)); lk == "content-type" || strings.HasPrefix(lk, "x-amz-") {
+			headers[lk] = strings.TrimSpace(string(v))
+		}
+	})
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, k := range names {
+		canonicalHeaders.WriteString(k + ":" + headers[k] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := string(req.URI().PathOriginal())
+	if path == "" {
+		path = "/"
+	}
+
+	canonicalRequest := strings.Join([]string{
+		string(req.Header.Method()),
+		path,
+		canonicalQuery(string(req.URI().QueryString())),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + s.region + "/" + s.service + "/aws4_request"
+	crh := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(crh[:])
+
+	key := hmacSHA256([]byte("AWS4"+s.secretKey), date)
+	key = hmacSHA256(key, s.region)
+	key = hmacSHA256(key, s.service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+s.accessKey+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+	return nil
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// canonicalQuery sorts the query parameters and encodes them as RFC 3986.
+func canonicalQuery(rawQuery string) string {
+	values, _ := url.ParseQuery(rawQuery)
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var parts []string
+	for _, k := range keys {
+		vs := values[k]
+		sort.Strings(vs)
+		for _, v := range vs {
+			parts = append(parts, uriEncode(k)+"="+uriEncode(v))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+func uriEncode(s string) string {
+	return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+}
+
+// profileSigners resolves the signers of the profiles by their sign option,
+// empty for the default signer, off to disable, a name of -sign, or an inline spec like hmac:key=secret.
+func (r *Invoker) profileSigners(profiles []*internal.Profile) error {
+	r.signers = map[*internal.Profile]Signer{}
+	for _, p := range profiles {
+		switch {
+		case p.Sign == "":
+			r.signers[p] = r.signer
+		case p.Sign == "off":
+			r.signers[p] = nil
+		case strings.Contains(p.Sign, ":"):
+			s, err := parseSigner(p.Sign)
+			if err != nil {
+				return fmt.Errorf("sign of profile %s %s: %w", p.Method, p.URL, err)
+			}
+			r.signers[p] = s
+		default:
+			s, ok := r.namedSigners[p.Sign]
+			if !ok {
+				return fmt.Errorf("sign %s of profile %s %s is not defined by -sign %s=...", p.Sign, p.Method, p.URL, p.Sign)
+			}
+			r.signers[p] = s
+		}
+	}
+	return nil
+}
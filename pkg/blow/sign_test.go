@@ -0,0 +1,39 @@
+package blow
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/valyala/fasthttp"
+)
+
+func TestSigV4(t *testing.T) {
+	// get-vanilla of the AWS Signature Version 4 test suite
+	s := &sigV4Signer{
+		accessKey: "AKIDEXAMPLE",
+		secretKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+		region:    "us-east-1",
+		service:   "service",
+	}
+
+	req := fasthttp.AcquireRequest()
+	defer fasthttp.ReleaseRequest(req)
+	req.SetRequestURI("http://example.amazonaws.com/")
+
+	assert.Nil(t, s.sign(req, time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)))
+	assert.Equal(t, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, "+
+		"SignedHeaders=host;x-amz-date, Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31",
+		string(req.Header.Peek("Authorization")))
+}
+
+func TestParseSigners(t *testing.T) {
+	def, named, err := parseSigners([]string{"hmac:key=secret;header=X-Sign", "gw=sm3:key=k2;encoding=base64"})
+	assert.Nil(t, err)
+	assert.Equal(t, "X-Sign", def.(*templateSigner).header)
+	assert.Equal(t, "sm3", named["gw"].(*templateSigner).algo)
+	assert.True(t, named["gw"].(*templateSigner).base64)
+
+	_, _, err = parseSigners([]string{"hmac:header=X-Sign"})
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,31 @@
+package blow
+
+import (
+	"sync"
+	"time"
+
+	"github.com/bingoohuang/berf"
+)
+
+// subRecorder records the sub operations happened out of the requests, like the TLCP handshakes
+// and proxy tunnels made in the dialers of the HTTP client, they are reported by the next finished request.
+type subRecorder struct {
+	subs []berf.SubResult
+	mu   sync.Mutex
+}
+
+func (s *subRecorder) record(name, status string, cost time.Duration) {
+	s.mu.Lock()
+	s.subs = append(s.subs, berf.SubResult{Name: name, Status: status, Cost: cost})
+	s.mu.Unlock()
+}
+
+// drain reports the sub operations recorded since the last drain to rr.
+func (s *subRecorder) drain(rr *berf.Result) {
+	s.mu.Lock()
+	subs := s.subs
+	s.subs = nil
+	s.mu.Unlock()
+
+	rr.Subs = append(rr.Subs, subs...)
+}
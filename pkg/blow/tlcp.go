@@ -2,120 +2,218 @@ package blow
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
 	"net"
 	"os"
 	"strings"
+	"time"
 	_ "unsafe"
 
 	"gitee.com/Trisia/gotlcp/tlcp"
+	"github.com/bingoohuang/berf/pkg/blow/internal"
 	"github.com/bingoohuang/gg/pkg/osx"
 	"github.com/bingoohuang/gg/pkg/osx/env"
+	"github.com/bingoohuang/gg/pkg/ss"
 	"github.com/emmansun/gmsm/smx509"
 	"github.com/valyala/fasthttp"
 )
 
-func createTlcpDialer(
-	ctx context.Context,
-	dialFunc fasthttp.DialFunc,
-	caFile string,
-	hasPrintOption func(feature uint8) bool,
-	tlsVerify bool,
-) fasthttp.DialFunc {
+const tlcpHandshakeSubName = "tlcp handshake"
+
+// tlcpClient dials the TLCP connections, checks the pinned server cert and records the handshakes to subs.
+type tlcpClient struct {
+	config *tlcp.Config
+	pins   map[string]bool
+	subs   *subRecorder
+}
+
+func (c *tlcpClient) dialer(ctx context.Context, dialFunc fasthttp.DialFunc) fasthttp.DialFunc {
+	return func(addr string) (net.Conn, error) {
+		rawConn, err := dialFunc(addr)
+		if err != nil {
+			return nil, err
+		}
+
+		t1 := time.Now()
+		conn := tlcp.Client(rawConn, c.config)
+		if err := conn.HandshakeContext(ctx); err != nil {
+			_ = rawConn.Close()
+			c.subs.record(tlcpHandshakeSubName, "error", time.Since(t1))
+			return nil, err
+		}
+		cost := time.Since(t1)
+		if m, ok := rawConn.(*internal.MyConn); ok {
+			m.HandshakeDone(cost)
+		}
+
+		state := conn.ConnectionState()
+		if err := checkTLCPPin(c.pins, state); err != nil {
+			_ = rawConn.Close()
+			c.subs.record(tlcpHandshakeSubName, "pin-mismatch", cost)
+			return nil, err
+		}
+
+		c.subs.record(tlcpHandshakeSubName, tlcpHandshakeStatus(state), cost)
+		return conn, nil
+	}
+}
+
+// tlcpHandshakeStatus tells the negotiated suite and whether the session is resumed, like ECC_SM4_GCM_SM3 resumed.
+func tlcpHandshakeStatus(state tlcp.ConnectionState) string {
+	if state.DidResume {
+		return tlcpCipherSuiteName(state.CipherSuite) + " resumed"
+	}
+	return tlcpCipherSuiteName(state.CipherSuite) + " full"
+}
+
+// checkTLCPPin checks the SHA-256 fingerprint of the server's sign cert against the pins of -tlcp.pin.
+func checkTLCPPin(pins map[string]bool, state tlcp.ConnectionState) error {
+	if len(pins) == 0 {
+		return nil
+	}
+	if len(state.PeerCertificates) == 0 {
+		return fmt.Errorf("TLCP server cert pin mismatch: no server cert")
+	}
+	sum := sha256.Sum256(state.PeerCertificates[0].Raw)
+	if fp := hex.EncodeToString(sum[:]); !pins[fp] {
+		return fmt.Errorf("TLCP server cert pin mismatch: %s", fp)
+	}
+	return nil
+}
+
+// parseTLCPPins parses the SHA-256 fingerprints of -tlcp.pin, like AB:CD:... or abcd..., separated by comma.
+func parseTLCPPins(s string) (map[string]bool, error) {
+	pins := map[string]bool{}
+	for _, p := range splitComma(s) {
+		fp := strings.ToLower(strings.ReplaceAll(p, ":", ""))
+		if b, err := hex.DecodeString(fp); err != nil || len(b) != sha256.Size {
+			return nil, fmt.Errorf("invalid -tlcp.pin %s, should be the hex SHA-256 fingerprint of the server's sign cert", p)
+		}
+		pins[fp] = true
+	}
+	return pins, nil
+}
+
+// useTLCP tells to use TLCP for the https URLs by -tlcp or env TLCP=1.
+func (o *Opt) useTLCP() bool {
+	return o.tlcp.enabled || env.Bool("TLCP", false)
+}
+
+// tlcpOption is the TLCP options of the -tlcp.* flags.
+type tlcpOption struct {
+	enabled bool
+	// suites are ecc, ecdhe or the suite names, default by the number of client certs.
+	suites string
+	// certs are the client sign cert,key[,enc cert,key], default to env TLCP_CERTS.
+	certs string
+	// ca is the root cert to verify the server's cert chain.
+	ca string
+	// pin are the SHA-256 fingerprints of the server's sign cert.
+	pin string
+	// sessions is the session cache size, 0 to disable the session resumption.
+	sessions int
+}
+
+// buildTLCPConfig creates the TLCP config by the -tlcp.* flags,
+// the cipher suites can also be pinned by -tls.ciphers.
+func (o *Opt) buildTLCPConfig(serverName string) (*tlcp.Config, error) {
 	// 使用传输层密码协议(TLCP)，TLCP协议遵循《GB/T 38636-2020 信息安全技术 传输层密码协议》。
 	c := &tlcp.Config{
-		InsecureSkipVerify: !tlsVerify,
+		ServerName:         serverName,
+		InsecureSkipVerify: !o.tlsVerify && o.tlcp.ca == "",
 	}
 
 	//  HTTP 客户端的会话缓存
-	if envTLSSessionCache > 0 {
-		c.SessionCache = tlcp.NewLRUSessionCache(envTLSSessionCache)
+	if o.tlcp.sessions > 0 {
+		c.SessionCache = tlcp.NewLRUSessionCache(o.tlcp.sessions)
 	}
 
-	c.EnableDebug = hasPrintOption(printDebug)
+	c.EnableDebug = o.HasPrintOption(printDebug)
 
+	// 兼容以前使用 -cert 指定 TLCP 根证书的用法
+	caFile := o.tlcp.ca
+	if caFile == "" && !isClientCertPool(o.certPath) {
+		caFile = o.certPath
+	}
 	if caFile != "" {
 		rootCert, err := smx509.ParseCertificatePEM(osx.ReadFile(caFile, osx.WithFatalOnError(true)).Data)
 		if err != nil {
-			panic(err)
+			return nil, fmt.Errorf("parse TLCP root cert %s: %w", caFile, err)
 		}
 		pool := smx509.NewCertPool()
 		pool.AddCert(rootCert)
 		c.RootCAs = pool
 	}
 
-	if len(envTLCPCerts) > 0 {
-		c.Certificates = envTLCPCerts
+	certs, err := loadTLCPCerts(ss.Or(o.tlcp.certs, os.Getenv(`TLCP_CERTS`)))
+	if err != nil {
+		return nil, err
+	}
+	if len(certs) > 0 {
+		c.Certificates = certs
 
-		switch len(envTLCPCerts) {
-		case 2:
+		switch len(certs) {
+		case 1:
 			// 单证书
-			c.CipherSuites = []uint16{tlcp.ECC_SM4_GCM_SM3, tlcp.ECC_SM4_CBC_SM3}
-		case 4:
+			c.CipherSuites = tlcpECCSuites
+		case 2:
 			// ECDHE系列套件 同时需要 认证密钥对 与 加密密钥对,
 			// 注意：不能出现 ECC 系列套件，否则服务端可能选择ECC系列套件。
-			c.CipherSuites = []uint16{tlcp.ECDHE_SM4_CBC_SM3, tlcp.ECDHE_SM4_GCM_SM3}
+			c.CipherSuites = tlcpECDHESuites
 		}
 	}
 
-	return func(addr string) (net.Conn, error) {
-		return dial(ctx, dialFunc, addr, c)
-	}
-}
-
-func dial(ctx context.Context, dialFunc fasthttp.DialFunc, addr string, config *tlcp.Config) (*tlcp.Conn, error) {
-	rawConn, err := dialFunc(addr)
-	if err != nil {
-		return nil, err
-	}
-
-	if config == nil {
-		config = &emptyConfig
+	suites := ss.Or(o.tlcp.suites, o.tlsCiphers)
+	switch strings.ToLower(suites) {
+	case "":
+	case "ecc":
+		c.CipherSuites = tlcpECCSuites
+	case "ecdhe":
+		c.CipherSuites = tlcpECDHESuites
+	default:
+		if c.CipherSuites, err = parseTLCPCiphers(suites); err != nil {
+			return nil, err
+		}
 	}
 
-	conn := tlcp.Client(rawConn, config)
-	if err := conn.HandshakeContext(ctx); err != nil {
-		_ = rawConn.Close()
-		return nil, err
+	for _, s := range c.CipherSuites {
+		if (s == tlcp.ECDHE_SM4_CBC_SM3 || s == tlcp.ECDHE_SM4_GCM_SM3) && len(certs) < 2 {
+			return nil, fmt.Errorf("TLCP ECDHE suites require the client sign and enc certs by -tlcp.certs sign.cert.pem,sign.key.pem,enc.cert.pem,enc.key.pem")
+		}
 	}
 
-	return conn, nil
+	return c, nil
 }
 
 var (
-	// emptyConfig 默认的空配置对象
-	emptyConfig tlcp.Config
+	tlcpECCSuites   = []uint16{tlcp.ECC_SM4_GCM_SM3, tlcp.ECC_SM4_CBC_SM3}
+	tlcpECDHESuites = []uint16{tlcp.ECDHE_SM4_GCM_SM3, tlcp.ECDHE_SM4_CBC_SM3}
 
 	envTLSSessionCache = env.Int(`TLS_SESSION_CACHE`, 32)
+)
 
-	envTLCPCerts = func() (certs []tlcp.Certificate) {
-		env := os.Getenv(`TLCP_CERTS`)
-		if env == "" {
-			return nil
-		}
-		// TLCP 1.1，套件ECDHE-SM2-SM4-CBC-SM3，设置客户端双证书
-		certsFiles := strings.Split(env, ",")
-		switch len(certsFiles) {
-		case 0, 2, 4:
-		default:
-			panic("env $TLCP_CERTS should be sign.cert.pem[,sign.key.pem,enc.cert.pem,enc.key.pem]")
-		}
-		if len(certsFiles) >= 2 {
-			signCertKeypair, err := tlcp.X509KeyPair(osx.ReadFile(certsFiles[0], osx.WithFatalOnError(true)).Data,
-				osx.ReadFile(certsFiles[1], osx.WithFatalOnError(true)).Data)
-			if err != nil {
-				panic(err)
-			}
-			certs = append(certs, signCertKeypair)
-		}
-		if len(certsFiles) >= 4 {
-			encCertKeypair, err := tlcp.X509KeyPair(osx.ReadFile(certsFiles[2], osx.WithFatalOnError(true)).Data,
-				osx.ReadFile(certsFiles[3], osx.WithFatalOnError(true)).Data)
-			if err != nil {
-				panic(err)
-			}
-			certs = append(certs, encCertKeypair)
+// loadTLCPCerts loads the TLCP certs like sign.cert.pem,sign.key.pem[,enc.cert.pem,enc.key.pem].
+func loadTLCPCerts(spec string) (certs []tlcp.Certificate, err error) {
+	if spec == "" {
+		return nil, nil
+	}
+
+	// TLCP 1.1，套件ECDHE-SM2-SM4-CBC-SM3，设置客户端双证书
+	certsFiles := strings.Split(spec, ",")
+	if len(certsFiles) != 2 && len(certsFiles) != 4 {
+		return nil, fmt.Errorf("TLCP certs should be sign.cert.pem,sign.key.pem[,enc.cert.pem,enc.key.pem], got %s", spec)
+	}
+
+	for i := 0; i < len(certsFiles); i += 2 {
+		keypair, err := tlcp.X509KeyPair(osx.ReadFile(certsFiles[i], osx.WithFatalOnError(true)).Data,
+			osx.ReadFile(certsFiles[i+1], osx.WithFatalOnError(true)).Data)
+		if err != nil {
+			return nil, fmt.Errorf("load TLCP cert %s: %w", certsFiles[i], err)
 		}
+		certs = append(certs, keypair)
+	}
 
-		return certs
-	}()
-)
+	return certs, nil
+}
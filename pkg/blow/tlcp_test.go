@@ -0,0 +1,155 @@
+package blow
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gitee.com/Trisia/gotlcp/tlcp"
+	"github.com/bingoohuang/berf"
+	"github.com/emmansun/gmsm/smx509"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTLCPPins(t *testing.T) {
+	fp := strings.Repeat("ab", 32)
+	pins, err := parseTLCPPins(strings.ToUpper(strings.Repeat("ab:", 31)+"ab") + ", " + strings.Repeat("01", 32))
+	assert.Nil(t, err)
+	assert.True(t, pins[fp])
+	assert.True(t, pins[strings.Repeat("01", 32)])
+
+	_, err = parseTLCPPins("abcd")
+	assert.NotNil(t, err)
+}
+
+func TestSubRecorder(t *testing.T) {
+	c := &subRecorder{}
+	c.record(tlcpHandshakeSubName, "ECC_SM4_GCM_SM3 full", time.Millisecond)
+	c.record(tlcpHandshakeSubName, "ECC_SM4_GCM_SM3 resumed", time.Microsecond)
+
+	rr := &berf.Result{}
+	c.drain(rr)
+	assert.Equal(t, []berf.SubResult{
+		{Name: tlcpHandshakeSubName, Status: "ECC_SM4_GCM_SM3 full", Cost: time.Millisecond},
+		{Name: tlcpHandshakeSubName, Status: "ECC_SM4_GCM_SM3 resumed", Cost: time.Microsecond},
+	}, rr.Subs)
+
+	rr = &berf.Result{}
+	c.drain(rr)
+	assert.Empty(t, rr.Subs)
+}
+
+// writeTLCPCerts writes the sign and enc certs to the PEM files, returns them like -tlcp.certs.
+func writeTLCPCerts(t *testing.T, dir, name string, certs []tlcp.Certificate) string {
+	var files []string
+	for i, c := range certs {
+		keyDer, err := smx509.MarshalPKCS8PrivateKey(c.PrivateKey)
+		assert.Nil(t, err)
+		certFile := filepath.Join(dir, fmt.Sprintf("%s%d.cert.pem", name, i))
+		keyFile := filepath.Join(dir, fmt.Sprintf("%s%d.key.pem", name, i))
+		assert.Nil(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.Certificate[0]}), 0o644))
+		assert.Nil(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDer}), 0o600))
+		files = append(files, certFile, keyFile)
+	}
+	return strings.Join(files, ",")
+}
+
+func writeTLCPCA(t *testing.T, dir, name string, caPEM []byte) string {
+	file := filepath.Join(dir, name+".pem")
+	assert.Nil(t, os.WriteFile(file, caPEM, 0o644))
+	return file
+}
+
+func TestTLCPClient(t *testing.T) {
+	_, caPEM, serverCerts, err := generateTLCPServerCerts()
+	assert.Nil(t, err)
+	// 客户端双证书由另一个 CA 签发，用于 ECDHE 套件
+	clientCA, clientCAPEM, clientCerts, err := generateTLCPServerCerts()
+	assert.Nil(t, err)
+
+	config := &tlcp.Config{
+		Certificates: serverCerts,
+		ClientAuth:   tlcp.VerifyClientCertIfGiven,
+		ClientCAs:    smx509.NewCertPool(),
+		SessionCache: tlcp.NewLRUSessionCache(8),
+	}
+	config.ClientCAs.AddCert(clientCA)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})}
+	go func() { _ = server.Serve(tlcp.NewListener(ln, config)) }()
+	defer server.Close()
+
+	dir := t.TempDir()
+	caFile := writeTLCPCA(t, dir, "ca", caPEM)
+	rawDial := func(addr string) (net.Conn, error) { return net.Dial("tcp", addr) }
+	handshake := func(o *Opt, pins map[string]bool) (string, error) {
+		c, err := o.buildTLCPConfig("localhost")
+		if err != nil {
+			return "", err
+		}
+		subs := &subRecorder{}
+		conn, err := (&tlcpClient{config: c, pins: pins, subs: subs}).dialer(context.Background(), rawDial)(ln.Addr().String())
+		if conn != nil {
+			_ = conn.Close()
+		}
+		rr := &berf.Result{}
+		subs.drain(rr)
+		if assert.Len(t, rr.Subs, 1) {
+			assert.Equal(t, tlcpHandshakeSubName, rr.Subs[0].Name)
+			return rr.Subs[0].Status, err
+		}
+		return "", err
+	}
+
+	// ECC 套件，使用生成的 CA 验证服务端证书
+	status, err := handshake(&Opt{tlcp: tlcpOption{ca: caFile, suites: "ecc"}}, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, tlcpCipherSuiteName(tlcp.ECC_SM4_GCM_SM3)+" full", status)
+
+	// ECDHE 套件需要客户端双证书
+	_, err = (&Opt{tlcp: tlcpOption{ca: caFile, suites: "ecdhe"}}).buildTLCPConfig("localhost")
+	assert.NotNil(t, err)
+	status, err = handshake(&Opt{tlcp: tlcpOption{ca: caFile, certs: writeTLCPCerts(t, dir, "client", clientCerts)}}, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, tlcpCipherSuiteName(tlcp.ECDHE_SM4_GCM_SM3)+" full", status)
+
+	// 其它 CA 签发的服务端证书验证失败
+	status, err = handshake(&Opt{tlcp: tlcpOption{ca: writeTLCPCA(t, dir, "other", clientCAPEM)}}, nil)
+	assert.NotNil(t, err)
+	assert.Equal(t, "error", status)
+
+	// 证书指纹
+	sum := sha256.Sum256(serverCerts[0].Certificate[0])
+	status, err = handshake(&Opt{tlcp: tlcpOption{ca: caFile}}, map[string]bool{hex.EncodeToString(sum[:]): true})
+	assert.Nil(t, err)
+	assert.True(t, strings.HasSuffix(status, " full"), status)
+	status, err = handshake(&Opt{tlcp: tlcpOption{ca: caFile}}, map[string]bool{strings.Repeat("00", 32): true})
+	assert.NotNil(t, err)
+	assert.Equal(t, "pin-mismatch", status)
+
+	// -tlcp.sessions 复用会话，同一个配置的第二次握手恢复会话
+	o := &Opt{tlcp: tlcpOption{ca: caFile, suites: "ecc", sessions: 8}}
+	c, err := o.buildTLCPConfig("localhost")
+	assert.Nil(t, err)
+	client := &tlcpClient{config: c, subs: &subRecorder{}}
+	for i := 0; i < 2; i++ {
+		conn, err := client.dialer(context.Background(), rawDial)(ln.Addr().String())
+		assert.Nil(t, err)
+		_ = conn.Close()
+	}
+	rr := &berf.Result{}
+	client.subs.drain(rr)
+	assert.Equal(t, []string{tlcpCipherSuiteName(tlcp.ECC_SM4_GCM_SM3) + " full", tlcpCipherSuiteName(tlcp.ECC_SM4_GCM_SM3) + " resumed"},
+		[]string{rr.Subs[0].Status, rr.Subs[1].Status})
+}
@@ -0,0 +1,172 @@
+package blow
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"gitee.com/Trisia/gotlcp/tlcp"
+	"github.com/bingoohuang/gg/pkg/osx"
+	"github.com/emmansun/gmsm/sm2"
+	"github.com/emmansun/gmsm/smx509"
+)
+
+var tlcpClientAuthTypes = map[string]tlcp.ClientAuthType{
+	"none":            tlcp.NoClientCert,
+	"request":         tlcp.RequestClientCert,
+	"require-any":     tlcp.RequireAnyClientCert,
+	"verify-if-given": tlcp.VerifyClientCertIfGiven,
+	"require":         tlcp.RequireAndVerifyClientCert,
+}
+
+// tlcpServer starts a local TLCP test HTTP server by -tlcp.server, to verify the TLCP options offline.
+func (b *Bench) tlcpServer(ctx context.Context) error {
+	auth, ok := tlcpClientAuthTypes[strings.ToLower(*pTLCPServerAuth)]
+	if !ok {
+		return fmt.Errorf("unknown -tlcp.server.auth %s, should be one of none, request, require-any, verify-if-given, require", *pTLCPServerAuth)
+	}
+
+	config := &tlcp.Config{ClientAuth: auth, SessionCache: tlcp.NewLRUSessionCache(envTLSSessionCache)}
+	if *pTLCPServerCerts != "" {
+		certs, err := loadTLCPCerts(*pTLCPServerCerts)
+		if err != nil {
+			return err
+		}
+		if len(certs) != 2 {
+			return fmt.Errorf("-tlcp.server.certs should be sign.cert.pem,sign.key.pem,enc.cert.pem,enc.key.pem")
+		}
+		config.Certificates = certs
+	} else {
+		ca, caPEM, certs, err := generateTLCPServerCerts()
+		if err != nil {
+			return fmt.Errorf("generate TLCP server certs: %w", err)
+		}
+		config.Certificates = certs
+		config.ClientCAs = smx509.NewCertPool()
+		config.ClientCAs.AddCert(ca)
+
+		caFile, err := os.CreateTemp("", "berf-tlcp-ca-*.pem")
+		if err != nil {
+			return err
+		}
+		defer os.Remove(caFile.Name())
+		_, err = caFile.Write(caPEM)
+		if closeErr := caFile.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return fmt.Errorf("write TLCP test CA: %w", err)
+		}
+		log.Printf("TLCP test CA written to %s (removed when the server stops), verify the server by -tlcp.ca %s",
+			caFile.Name(), caFile.Name())
+	}
+
+	if *pTLCPCA != "" {
+		ca, err := smx509.ParseCertificatePEM(osx.ReadFile(*pTLCPCA, osx.WithFatalOnError(true)).Data)
+		if err != nil {
+			return fmt.Errorf("parse -tlcp.ca %s: %w", *pTLCPCA, err)
+		}
+		config.ClientCAs = smx509.NewCertPool()
+		config.ClientCAs.AddCert(ca)
+	}
+
+	ln, err := net.Listen("tcp", *pTLCPServer)
+	if err != nil {
+		return err
+	}
+
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		_, _ = fmt.Fprintf(w, `{"tlcp":true,"method":%q,"uri":%q,"remote":%q}`, r.Method, r.RequestURI, r.RemoteAddr)
+	})}
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		defer cancel()
+		_ = server.Shutdown(shutdownCtx)
+	}()
+
+	sum := sha256.Sum256(config.Certificates[0].Certificate[0])
+	log.Printf("TLCP test server on %s, client auth %s, sign cert pin %s, Ctrl+C to stop",
+		ln.Addr(), *pTLCPServerAuth, hex.EncodeToString(sum[:]))
+
+	if err := server.Serve(tlcp.NewListener(ln, config)); err != nil && err != http.ErrServerClosed {
+		return err
+	}
+	return io.EOF
+}
+
+// generateTLCPServerCerts generates a temporary SM2 CA, and the sign and enc certs of the server signed by it,
+// the CA cert is also returned in PEM to verify the server by -tlcp.ca, it verifies the client certs when no -tlcp.ca.
+func generateTLCPServerCerts() (ca *smx509.Certificate, caPEM []byte, certs []tlcp.Certificate, err error) {
+	caKey, err := sm2.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	caTpl := &x509.Certificate{
+		SerialNumber:          newSerial(),
+		Subject:               pkix.Name{CommonName: "berf TLCP test CA", Organization: []string{"berf"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().AddDate(1, 0, 0),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	caDer, err := smx509.CreateCertificate(rand.Reader, caTpl, caTpl, caKey.Public(), caKey)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if ca, err = smx509.ParseCertificate(caDer); err != nil {
+		return nil, nil, nil, err
+	}
+
+	for _, usage := range []x509.KeyUsage{
+		x509.KeyUsageDigitalSignature,
+		x509.KeyUsageKeyEncipherment | x509.KeyUsageDataEncipherment | x509.KeyUsageKeyAgreement,
+	} {
+		key, err := sm2.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		tpl := &x509.Certificate{
+			SerialNumber: newSerial(),
+			Subject:      pkix.Name{CommonName: "localhost", Organization: []string{"berf"}},
+			DNSNames:     []string{"localhost"},
+			IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().AddDate(1, 0, 0),
+			KeyUsage:     usage,
+		}
+		der, err := smx509.CreateCertificate(rand.Reader, tpl, ca.ToX509(), key.Public(), caKey)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		keyDer, err := smx509.MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		c, err := tlcp.X509KeyPair(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+			pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDer}))
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		certs = append(certs, c)
+	}
+
+	return ca, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDer}), certs, nil
+}
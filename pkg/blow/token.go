@@ -0,0 +1,297 @@
+package blow
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bingoohuang/berf"
+	"github.com/bingoohuang/berf/pkg/blow/internal"
+	"github.com/bingoohuang/jj"
+	"github.com/valyala/fasthttp"
+)
+
+const tokenRefreshSubName = "token refresh"
+
+// token is a bearer token with its expiry time, zero expiry means never expires.
+type token struct {
+	expiry  time.Time
+	fetched time.Time
+	value   string
+}
+
+// tokenSource fetches new tokens.
+type tokenSource interface {
+	fetch(r *Invoker) (*token, string, error)
+}
+
+// tokenAuth caches the token fetched from the source and refreshes it before expiry or on 401 responses.
+type tokenAuth struct {
+	source  tokenSource
+	current *token
+	mu      sync.Mutex
+}
+
+// parseTokenAuth parses the -token argument, profiles marked with [auth] are removed from opt.profiles.
+func parseTokenAuth(s string, opt *Opt) (*tokenAuth, error) {
+	var authProfiles []*internal.Profile
+	profiles := opt.profiles[:0]
+	for _, p := range opt.profiles {
+		if p.Auth {
+			authProfiles = append(authProfiles, p)
+		} else {
+			profiles = append(profiles, p)
+		}
+	}
+	opt.profiles = profiles
+
+	switch {
+	case s == "":
+		if len(authProfiles) > 0 {
+			return &tokenAuth{source: &profileTokenSource{profiles: authProfiles}}, nil
+		}
+		return nil, nil
+	case s == "profile":
+		if len(authProfiles) == 0 {
+			return nil, fmt.Errorf("no profile marked with [auth] found for -token profile")
+		}
+		return &tokenAuth{source: &profileTokenSource{profiles: authProfiles}}, nil
+	case strings.HasPrefix(s, "@"):
+		return &tokenAuth{source: &fileTokenSource{file: s[1:]}}, nil
+	case strings.HasPrefix(s, "oauth2:"):
+		src, err := newOAuth2TokenSource(strings.TrimPrefix(s, "oauth2:"), opt)
+		if err != nil {
+			return nil, err
+		}
+		return &tokenAuth{source: src}, nil
+	default:
+		return nil, fmt.Errorf("unknown token source %s", s)
+	}
+}
+
+// expiring tells the token should be refreshed at now, a token is refreshed
+// ahead of its expiry by 1/10 of its lifetime since fetched, but at most 30s.
+func (t *token) expiring(now time.Time) bool {
+	if t.expiry.IsZero() {
+		return false
+	}
+
+	ahead := t.expiry.Sub(t.fetched) / 10
+	if ahead > 30*time.Second {
+		ahead = 30 * time.Second
+	}
+	return now.Add(ahead).After(t.expiry)
+}
+
+// authorize sets the bearer token to the request, the token is refreshed when it is expiring,
+// or it is still the same one as the rejected one.
+func (a *tokenAuth) authorize(r *Invoker, req *fasthttp.Request, rr *berf.Result, rejected string) (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.current == nil || a.current.value == rejected || a.current.expiring(time.Now()) {
+		t1 := time.Now()
+		t, status, err := a.source.fetch(r)
+		cost := time.Since(t1)
+		if err != nil {
+			rr.AddSub(tokenRefreshSubName, "error", cost)
+			return "", fmt.Errorf("refresh token: %w", err)
+		}
+		rr.AddSub(tokenRefreshSubName, status, cost)
+		t.fetched = t1
+		a.current = t
+	}
+
+	req.Header.Set("Authorization", "Bearer "+a.current.value)
+	return a.current.value, nil
+}
+
+// fileTokenSource reads the token from a file, like a static JWT, the file is reread on every refresh.
+type fileTokenSource struct {
+	file string
+}
+
+func (s *fileTokenSource) fetch(*Invoker) (*token, string, error) {
+	data, err := os.ReadFile(s.file)
+	if err != nil {
+		return nil, "", err
+	}
+
+	value := strings.TrimSpace(string(data))
+	if value == "" {
+		return nil, "", fmt.Errorf("empty token file %s", s.file)
+	}
+
+	return &token{value: value, expiry: jwtExpiry(value)}, "file", nil
+}
+
+// jwtExpiry parses the exp claim of the JWT, zero time for non-JWT or no exp claim.
+func jwtExpiry(value string) time.Time {
+	parts := strings.Split(value, ".")
+	if len(parts) != 3 {
+		return time.Time{}
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return time.Time{}
+	}
+
+	var claims struct {
+		Exp int64 `json:"exp"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.Exp == 0 {
+		return time.Time{}
+	}
+
+	return time.Unix(claims.Exp, 0)
+}
+
+// oauth2TokenSource fetches tokens by OAuth2 client credentials or password grant.
+type oauth2TokenSource struct {
+	client   *fasthttp.Client
+	tokenURL string
+	form     url.Values
+}
+
+// newOAuth2TokenSource creates an OAuth2 token source by the expression like
+// https://idp/token?grant_type=client_credentials&client_id=a&client_secret=b&scope=s,
+// the query parameters are posted as the form to the token URL.
+func newOAuth2TokenSource(s string, opt *Opt) (*oauth2TokenSource, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, fmt.Errorf("parse oauth2 token URL %s: %w", s, err)
+	}
+
+	form := u.Query()
+	switch grantType := form.Get("grant_type"); grantType {
+	case "":
+		form.Set("grant_type", "client_credentials")
+	case "client_credentials", "password":
+	default:
+		return nil, fmt.Errorf("unsupported oauth2 grant_type %s", grantType)
+	}
+	u.RawQuery = ""
+
+	tlsConfig, err := opt.buildTLSConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	client := &fasthttp.Client{
+		Name:         "blow",
+		TLSConfig:    tlsConfig,
+		ReadTimeout:  opt.readTimeout,
+		WriteTimeout: opt.writeTimeout,
+		Dial:         ProxyHTTPDialerTimeout(opt.dialTimeout, dialer, u.Scheme == httpsScheme),
+	}
+
+	return &oauth2TokenSource{client: client, tokenURL: u.String(), form: form}, nil
+}
+
+func (s *oauth2TokenSource) fetch(*Invoker) (*token, string, error) {
+	req := fasthttp.AcquireRequest()
+	rsp := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseRequest(req)
+	defer fasthttp.ReleaseResponse(rsp)
+
+	req.SetRequestURI(s.tokenURL)
+	req.Header.SetMethod("POST")
+	req.Header.SetContentType("application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBodyString(s.form.Encode())
+
+	if err := s.client.Do(req, rsp); err != nil {
+		return nil, "", err
+	}
+
+	status := "HTTP " + strconv.Itoa(rsp.StatusCode())
+	body, err := rsp.BodyUncompressed()
+	if err != nil {
+		return nil, status, err
+	}
+	if code := rsp.StatusCode(); code < 200 || code >= 300 {
+		return nil, status, fmt.Errorf("token endpoint status %d, body: %s", code, bytes.TrimSpace(body))
+	}
+
+	return parseTokenResponse(body, "access_token", "expires_in", status)
+}
+
+// parseTokenResponse parses the token and its lifetime in seconds from the JSON response.
+func parseTokenResponse(body []byte, tokenPath, expiresInPath, status string) (*token, string, error) {
+	value := jj.GetBytes(body, tokenPath).String()
+	if value == "" {
+		return nil, status, fmt.Errorf("no token found by %s in response: %s", tokenPath, bytes.TrimSpace(body))
+	}
+
+	t := &token{value: value}
+	if expiresInPath != "" {
+		if expiresIn := jj.GetBytes(body, expiresInPath).Int(); expiresIn > 0 {
+			t.expiry = time.Now().Add(time.Duration(expiresIn) * time.Second)
+		}
+	}
+	if t.expiry.IsZero() {
+		t.expiry = jwtExpiry(value)
+	}
+
+	return t, status, nil
+}
+
+// profileTokenSource fetches tokens by the profiles marked with [auth], like a custom login,
+// the last profile should extract the token with result.token=path and optional result.expires_in=path.
+type profileTokenSource struct {
+	profiles []*internal.Profile
+}
+
+func (s *profileTokenSource) fetch(r *Invoker) (*token, string, error) {
+	req := fasthttp.AcquireRequest()
+	rsp := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseRequest(req)
+	defer fasthttp.ReleaseResponse(rsp)
+
+	var t *token
+	var status string
+	for _, p := range s.profiles {
+		req.Reset()
+		rsp.Reset()
+
+		closers, err := p.CreateReq(r.isTLS, req, r.opt.enableGzip, r.opt.uploadIndex, nil)
+		if err == nil {
+			err = r.httpInvoke(req, rsp)
+		}
+		_ = closers.Close()
+		if err != nil {
+			return nil, status, err
+		}
+
+		status = "HTTP " + strconv.Itoa(rsp.StatusCode())
+		if code := rsp.StatusCode(); code < 200 || code >= 300 {
+			return nil, status, fmt.Errorf("auth profile %s %s status %d", p.Method, p.URL, code)
+		}
+
+		body, err := rsp.BodyUncompressed()
+		if err != nil {
+			return nil, status, err
+		}
+
+		registerResultValues(p.ResultExpr, body)
+		if tokenPath := p.ResultExpr["token"]; tokenPath != "" {
+			if t, _, err = parseTokenResponse(body, tokenPath, p.ResultExpr["expires_in"], status); err != nil {
+				return nil, status, err
+			}
+		}
+	}
+
+	if t == nil {
+		return nil, status, fmt.Errorf("no token extracted by result.token from [auth] profiles")
+	}
+
+	return t, status, nil
+}
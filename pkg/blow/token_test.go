@@ -0,0 +1,156 @@
+package blow
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bingoohuang/berf"
+	"github.com/bingoohuang/berf/pkg/blow/internal"
+	"github.com/stretchr/testify/assert"
+	"github.com/valyala/fasthttp"
+)
+
+type countTokenSource struct {
+	lifetime time.Duration
+	fetches  int
+}
+
+func (s *countTokenSource) fetch(*Invoker) (*token, string, error) {
+	s.fetches++
+	return &token{value: "t" + strconv.Itoa(s.fetches), expiry: time.Now().Add(s.lifetime)}, "ok", nil
+}
+
+func TestTokenExpiring(t *testing.T) {
+	now := time.Now()
+	tk := &token{fetched: now, expiry: now.Add(100 * time.Second)}
+	assert.False(t, tk.expiring(now.Add(89*time.Second)))
+	assert.True(t, tk.expiring(now.Add(91*time.Second)))
+
+	// 提前量最多 30s
+	tk = &token{fetched: now, expiry: now.Add(time.Hour)}
+	assert.False(t, tk.expiring(now.Add(time.Hour-31*time.Second)))
+	assert.True(t, tk.expiring(now.Add(time.Hour-29*time.Second)))
+
+	assert.False(t, (&token{}).expiring(now.Add(time.Hour)))
+}
+
+func TestTokenRefreshAhead(t *testing.T) {
+	src := &countTokenSource{lifetime: time.Hour}
+	a := &tokenAuth{source: src}
+	req := fasthttp.AcquireRequest()
+	defer fasthttp.ReleaseRequest(req)
+
+	rr := &berf.Result{}
+	v, err := a.authorize(nil, req, rr, "")
+	assert.Nil(t, err)
+	assert.Equal(t, "t1", v)
+	assert.Equal(t, "Bearer t1", string(req.Header.Peek("Authorization")))
+
+	v, _ = a.authorize(nil, req, rr, "")
+	assert.Equal(t, "t1", v)
+	assert.Equal(t, 1, src.fetches)
+
+	// 剩余 500ms，已在 10s 有效期的最后 1/10 内，但尚未过期
+	a.current.fetched = time.Now().Add(-9500 * time.Millisecond)
+	a.current.expiry = time.Now().Add(500 * time.Millisecond)
+	v, _ = a.authorize(nil, req, rr, "")
+	assert.Equal(t, "t2", v)
+	assert.Equal(t, 2, src.fetches)
+	assert.Len(t, rr.Subs, 2)
+}
+
+func TestTokenRefreshOn401(t *testing.T) {
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	assert.Nil(t, os.WriteFile(tokenFile, []byte("t1\n"), 0o600))
+
+	var calls int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		if r.Header.Get("Authorization") != "Bearer t2" {
+			// 令牌在服务端被吊销，轮换为 t2
+			_ = os.WriteFile(tokenFile, []byte("t2\n"), 0o600)
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer ts.Close()
+
+	opt := &Opt{}
+	a, err := parseTokenAuth("@"+tokenFile, opt)
+	assert.Nil(t, err)
+	r := &Invoker{opt: opt, tokenAuth: a, httpInvoke: (&fasthttp.Client{}).Do, sharedState: &vuState{}}
+
+	send := func() (int, *berf.Result) {
+		req, rsp := fasthttp.AcquireRequest(), fasthttp.AcquireResponse()
+		defer fasthttp.ReleaseRequest(req)
+		defer fasthttp.ReleaseResponse(rsp)
+		req.SetRequestURI(ts.URL)
+
+		rr := &berf.Result{}
+		assert.Nil(t, r.invoke(context.Background(), req, rsp, rr, nil, nil))
+		return rsp.StatusCode(), rr
+	}
+
+	code, rr := send()
+	assert.Equal(t, 200, code)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+	assert.Len(t, rr.Subs, 2)
+	assert.Equal(t, "t2", a.current.value)
+
+	// 新令牌被缓存，不再获取
+	code, rr = send()
+	assert.Equal(t, 200, code)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+	assert.Len(t, rr.Subs, 0)
+}
+
+func TestTokenProfileSource(t *testing.T) {
+	var logins int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/login":
+			atomic.AddInt32(&logins, 1)
+			_, _ = w.Write([]byte(`{"data":{"token":"abc","expiresIn":3600}}`))
+		case r.Header.Get("Authorization") != "Bearer abc":
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer ts.Close()
+
+	profiles, err := internal.ParseProfiles(strings.NewReader(`
+### [auth result.token=data.token result.expires_in=data.expiresIn]
+POST `+ts.URL+`/login
+
+###
+GET `+ts.URL+`/orders
+`), "")
+	assert.Nil(t, err)
+	assert.Len(t, profiles, 2)
+
+	opt := &Opt{profiles: profiles}
+	a, err := parseTokenAuth("", opt)
+	assert.Nil(t, err)
+	assert.IsType(t, &profileTokenSource{}, a.source)
+	assert.Len(t, opt.profiles, 1)
+
+	r := &Invoker{opt: opt, tokenAuth: a, httpInvoke: (&fasthttp.Client{}).Do, sharedState: &vuState{}}
+	for i := 0; i < 3; i++ {
+		req, rsp := fasthttp.AcquireRequest(), fasthttp.AcquireResponse()
+		req.SetRequestURI(ts.URL + "/orders")
+		assert.Nil(t, r.invoke(context.Background(), req, rsp, &berf.Result{}, nil, nil))
+		assert.Equal(t, 200, rsp.StatusCode())
+		fasthttp.ReleaseRequest(req)
+		fasthttp.ReleaseResponse(rsp)
+	}
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&logins))
+	assert.Equal(t, "abc", a.current.value)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), a.current.expiry, time.Minute)
+}
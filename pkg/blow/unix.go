@@ -0,0 +1,66 @@
+package blow
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+const unixScheme = "unix://"
+
+// parseUnixURL parses the URL like unix:///run/app.sock:/path?q=1 (or unix://@abstract:/path for the Linux abstract socket)
+// to the socket /run/app.sock and the HTTP URL http://localhost/path?q=1.
+func parseUnixURL(s string) (socket, httpURL string, ok bool) {
+	if !strings.HasPrefix(s, unixScheme) {
+		return "", "", false
+	}
+
+	socket, path, _ := strings.Cut(strings.TrimPrefix(s, unixScheme), ":")
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	return socket, "http://localhost" + path, true
+}
+
+// applyUnixSockets rewrites the unix:// URLs of the command line and the profiles to the HTTP ones,
+// and sends all the requests to the socket of them or -unix-socket.
+func (o *Opt) applyUnixSockets() error {
+	use := func(socket string) error {
+		if o.unixSocket != "" && o.unixSocket != socket {
+			return fmt.Errorf("only one unix socket is supported, got %s and %s", o.unixSocket, socket)
+		}
+		o.unixSocket = socket
+		return nil
+	}
+
+	for i, u := range o.urls {
+		if socket, httpURL, ok := parseUnixURL(u); ok {
+			if err := use(socket); err != nil {
+				return err
+			}
+			o.urls[i] = httpURL
+		}
+	}
+	for _, p := range o.profiles {
+		if socket, httpURL, ok := parseUnixURL(p.URL); ok {
+			if err := use(socket); err != nil {
+				return err
+			}
+			p.URL = httpURL
+		}
+	}
+	return nil
+}
+
+// unixDialer dials the unix socket for any address, the socket starting with @ is a Linux abstract socket.
+func unixDialer(socket string, timeout time.Duration) fasthttp.DialFunc {
+	return func(string) (net.Conn, error) {
+		if timeout == 0 {
+			return net.Dial("unix", socket)
+		}
+		return net.DialTimeout("unix", socket, timeout)
+	}
+}
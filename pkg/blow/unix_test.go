@@ -0,0 +1,60 @@
+package blow
+
+import (
+	"net"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"github.com/bingoohuang/berf/pkg/blow/internal"
+	"github.com/stretchr/testify/assert"
+	"github.com/valyala/fasthttp"
+)
+
+func TestParseUnixURL(t *testing.T) {
+	socket, httpURL, ok := parseUnixURL("unix:///run/app.sock:/info?all=1")
+	assert.True(t, ok)
+	assert.Equal(t, "/run/app.sock", socket)
+	assert.Equal(t, "http://localhost/info?all=1", httpURL)
+
+	socket, httpURL, ok = parseUnixURL("unix://@envoy")
+	assert.True(t, ok)
+	assert.Equal(t, "@envoy", socket)
+	assert.Equal(t, "http://localhost/", httpURL)
+
+	_, _, ok = parseUnixURL("http://localhost/info")
+	assert.False(t, ok)
+
+	opt := &Opt{
+		urls:     []string{"unix:///run/app.sock:/a"},
+		profiles: []*internal.Profile{{URL: "unix:///run/app.sock:/b"}},
+	}
+	assert.Nil(t, opt.applyUnixSockets())
+	assert.Equal(t, "/run/app.sock", opt.unixSocket)
+	assert.Equal(t, "http://localhost/a", opt.urls[0])
+	assert.Equal(t, "http://localhost/b", opt.profiles[0].URL)
+
+	opt = &Opt{unixSocket: "/run/other.sock", urls: []string{"unix:///run/app.sock:/a"}}
+	assert.NotNil(t, opt.applyUnixSockets())
+}
+
+func TestUnixDialer(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "app.sock")
+	ln, err := net.Listen("unix", socket)
+	assert.Nil(t, err)
+	defer ln.Close()
+	go func() {
+		_ = http.Serve(ln, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(r.URL.Path))
+		}))
+	}()
+
+	var readBytes, writeBytes int64
+	noop := func(conn net.Conn) net.Conn { return conn }
+	cli := &fasthttp.Client{Dial: internal.ThroughputStatDial(noop, unixDialer(socket, 0), &readBytes, &writeBytes)}
+	code, body, err := cli.Get(nil, "http://localhost/info")
+	assert.Nil(t, err)
+	assert.Equal(t, 200, code)
+	assert.Equal(t, "/info", string(body))
+	assert.True(t, readBytes > 0 && writeBytes > 0)
+}
@@ -0,0 +1,168 @@
+package blow
+
+import (
+	"context"
+	"net/http/cookiejar"
+	"strconv"
+	"time"
+
+	"github.com/bingoohuang/berf"
+	"github.com/bingoohuang/berf/pkg/blow/internal"
+	"github.com/bingoohuang/berf/pkg/blow/script"
+	"github.com/valyala/fasthttp"
+)
+
+// vuState holds the blow's state of a virtual user (a benchmarking goroutine).
+type vuState struct {
+	jar    *cookiejar.Jar
+	vars   internal.Vars
+	script *script.Runtime
+	digest digestCache
+	// identity is the client cert of -cert pool assigned to the virtual user.
+	identity *clientIdentity
+	// proxy is the proxy of -proxy pool assigned to the virtual user by -proxy.per vu.
+	proxy     *poolProxy
+	iteration int
+	// shared tells the state is shared by the initial invocations, like [init] profiles.
+	shared bool
+}
+
+const vuStateKey = "blow"
+
+func (r *Invoker) newVUState(iteration int) *vuState {
+	s := &vuState{iteration: iteration, vars: internal.Vars{}, identity: r.pickIdentity(), proxy: r.pickProxy()}
+	if r.opt.cookie.enabled {
+		s.jar = r.opt.cookie.newJar()
+	}
+	return s
+}
+
+// vuState gets the state of the virtual user carried by ctx.
+// The initial invocations which run outside any virtual user share one state.
+func (r *Invoker) vuState(ctx context.Context) *vuState {
+	vu := berf.GetVirtualUser(ctx)
+	if vu == nil {
+		return r.sharedState
+	}
+
+	s := vu.Value(vuStateKey, func() interface{} { return r.newVUState(vu.Iteration) }).(*vuState)
+	if s.iteration != vu.Iteration {
+		s.iteration = vu.Iteration
+		if r.opt.cookie.perIteration && s.jar != nil {
+			s.jar = r.opt.cookie.newJar()
+		}
+	}
+
+	return s
+}
+
+// invoke sends the request on behalf of the virtual user carried by ctx,
+// the cost of the request is accumulated to rr.Cost, signer signs the request right before sent if not nil,
+// digest authorizes the request by HTTP Digest authentication if not nil, the redirects are followed by -redirect.
+func (r *Invoker) invoke(ctx context.Context, req *fasthttp.Request, rsp *fasthttp.Response, rr *berf.Result,
+	signer Signer, digest *digestCred,
+) error {
+	costBefore := rr.Cost
+	s := r.vuState(ctx)
+	if s.jar != nil {
+		applyCookies(s.jar, req)
+	}
+	defer r.dialSubs.drain(rr)
+
+	var usedToken string
+	if r.tokenAuth != nil {
+		var err error
+		if usedToken, err = r.tokenAuth.authorize(r, req, rr, ""); err != nil {
+			return err
+		}
+	}
+
+	var session *digestSession
+	if digest != nil {
+		// 使用缓存的 nonce 预先认证，省去 401 质询往返
+		if session = s.digest.get(string(req.Host())); session != nil {
+			s.digest.authorize(session, digest, req)
+		}
+	}
+
+	if signer != nil {
+		if err := signer.Sign(req); err != nil {
+			return err
+		}
+	}
+
+	t1 := time.Now()
+	err := r.do(s, req, rsp, rr)
+	cost := time.Since(t1)
+	if err != nil {
+		rr.Cost += cost
+		return err
+	}
+
+	if digest != nil && rsp.StatusCode() == fasthttp.StatusUnauthorized && !req.IsBodyStream() {
+		if c := parseDigestChallenge(rsp); c != nil {
+			// the challenge round trip is counted separately from the authenticated request.
+			rr.AddSub(digestChallengeSubName, strconv.Itoa(rsp.StatusCode()), cost)
+			session = &digestSession{digestChallenge: *c}
+			s.digest.set(string(req.Host()), session)
+			s.digest.authorize(session, digest, req)
+
+			rsp.Reset()
+			if signer != nil {
+				if err := signer.Sign(req); err != nil {
+					return err
+				}
+			}
+			t1 = time.Now()
+			err = r.do(s, req, rsp, rr)
+			cost = time.Since(t1)
+			if err != nil {
+				rr.Cost += cost
+				return err
+			}
+		}
+	}
+	rr.Cost += cost
+	if session != nil {
+		s.digest.nextNonce(session, rsp)
+	}
+
+	if r.tokenAuth != nil && rsp.StatusCode() == fasthttp.StatusUnauthorized && !req.IsBodyStream() {
+		// the token may be revoked or expired before its declared expiry, refresh it and retry once.
+		if _, err := r.tokenAuth.authorize(r, req, rr, usedToken); err != nil {
+			return err
+		}
+
+		rsp.Reset()
+		if signer != nil {
+			if err := signer.Sign(req); err != nil {
+				return err
+			}
+		}
+		t1 = time.Now()
+		err = r.do(s, req, rsp, rr)
+		rr.Cost += time.Since(t1)
+		if err != nil {
+			return err
+		}
+	}
+
+	r.saveCookies(s, req, rsp)
+	return r.followRedirects(s, req, rsp, rr, signer, rr.Cost-costBefore)
+}
+
+// saveCookies saves the cookies of the response to the cookie jar of the virtual user if enabled.
+func (r *Invoker) saveCookies(s *vuState, req *fasthttp.Request, rsp *fasthttp.Response) {
+	if s.jar == nil {
+		return
+	}
+
+	cookies := saveCookies(s.jar, req, rsp)
+	if s.shared && len(cookies) > 0 {
+		// cookies got by the initial invocations, e.g. login in [init] profiles, are seeded to all virtual users.
+		u := requestURL(req)
+		for _, c := range cookies {
+			r.opt.cookie.seeds = append(r.opt.cookie.seeds, seedCookie{u: u, cookie: c})
+		}
+	}
+}
@@ -247,6 +247,11 @@ func (p *Printer) formatTableReports(w *bytes.Buffer, r *SnapshotReport, isFinal
 	report.PercentileReport = make(map[string]string)
 	writeBulk(w, p.buildPercentile(r, report.PercentileReport))
 
+	if len(r.Subs) > 0 {
+		w.WriteString("\n子操作:\n")
+		writeBulk(w, p.buildSubs(r))
+	}
+
 	if p.verbose >= 1 {
 		w.WriteString("\n直方图延迟:\n")
 		writeBulk(w, p.buildHistogram(r))
@@ -291,6 +296,39 @@ func (p *Printer) buildHistogram(r *SnapshotReport) [][]string {
 	return hisBulk
 }
 
+func (p *Printer) buildSubs(r *SnapshotReport) [][]string {
+	dts := durationToString
+	header := []string{"名称", "次数", "Mean"}
+	for _, percentile := range r.Subs[0].Percentiles {
+		header = append(header, "P"+formatFloat64(percentile.Percentile*100))
+	}
+	header = append(header, "Max", "状态")
+
+	subsBulk := [][]string{header}
+	for _, sub := range r.Subs {
+		row := []string{sub.Name, strconv.FormatInt(sub.Count, 10), dts(sub.Stats.Mean)}
+		for _, percentile := range sub.Percentiles {
+			row = append(row, dts(percentile.Latency))
+		}
+
+		codes := make([]string, 0, len(sub.Codes))
+		for k, v := range sub.Codes {
+			codes = append(codes, fmt.Sprintf("%s:%d", k, v))
+		}
+		sort.Strings(codes)
+		row = append(row, dts(sub.Stats.Max), strings.Join(codes, " "))
+		subsBulk = append(subsBulk, row)
+	}
+
+	aligns := make([]int, len(header))
+	for i := range aligns {
+		aligns[i] = AlignRight
+	}
+	aligns[0], aligns[len(aligns)-1] = AlignLeft, AlignLeft
+	alignBulk(subsBulk, aligns...)
+	return subsBulk
+}
+
 type PercentileReport map[string]string
 
 func (p *Printer) buildPercentile(r *SnapshotReport, report PercentileReport) [][]string {
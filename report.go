@@ -2,7 +2,10 @@ package berf
 
 import (
 	"encoding/json"
+	"fmt"
 	"math"
+	"sort"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -17,6 +20,7 @@ type ReportRecord struct {
 	error      string
 	code       []string
 	counting   []string
+	subs       []SubResult
 	cost       time.Duration
 	readBytes  int64
 	writeBytes int64
@@ -26,6 +30,7 @@ func (r *ReportRecord) Reset() {
 	r.cost = 0
 	r.code = nil
 	r.counting = nil
+	r.subs = nil
 	r.error = ""
 	r.readBytes = 0
 	r.writeBytes = 0
@@ -37,6 +42,8 @@ var (
 	recordPool      = sync.Pool{New: func() interface{} { return new(ReportRecord) }}
 	quantiles       = []float64{0.50, 0.75, 0.90, 0.95, 0.99, 0.999, 0.9999}
 	quantilesTarget = map[float64]float64{0.50: 0.01, 0.75: 0.01, 0.90: 0.001, 0.95: 0.001, 0.99: 0.001, 0.999: 0.0001, 0.9999: 0.00001}
+	// subQuantiles are the percentiles shown for the sub operations.
+	subQuantiles = []float64{0.50, 0.90, 0.99}
 )
 
 type Stats struct {
@@ -92,6 +99,10 @@ type StreamReport struct {
 	latencyStats *Stats
 	counts       *hyperloglog.Sketch
 
+	subs map[string]*subStats
+	// phasesWithinSec are the latency stats of the phases within the last second.
+	phasesWithinSec map[string]*Stats
+
 	requester *Requester
 
 	doneChan chan struct{}
@@ -116,10 +127,34 @@ func NewStreamReport(requester *Requester) *StreamReport {
 		latencyStats:     &Stats{},
 		rpsStats:         &Stats{},
 		latencyWithinSec: &Stats{},
+		subs:             make(map[string]*subStats),
 		requester:        requester,
 	}
 }
 
+// subStats is the statistics of a sub operation.
+type subStats struct {
+	codes           map[string]int64
+	latencyStats    *Stats
+	latencyQuantile *quantile.Stream
+}
+
+func (s *StreamReport) insertSub(sub SubResult) {
+	st, ok := s.subs[sub.Name]
+	if !ok {
+		st = &subStats{
+			codes:           make(map[string]int64, 1),
+			latencyStats:    &Stats{},
+			latencyQuantile: quantile.NewTargeted(quantilesTarget),
+		}
+		s.subs[sub.Name] = st
+	}
+
+	st.codes[sub.Status]++
+	st.latencyStats.Update(float64(sub.Cost))
+	st.latencyQuantile.Insert(float64(sub.Cost))
+}
+
 func (s *StreamReport) insert(v float64) {
 	s.latencyQuantile.Insert(v)
 	s.latencyHistogram.Insert(v)
@@ -128,6 +163,7 @@ func (s *StreamReport) insert(v float64) {
 
 func (s *StreamReport) Collect(recordChan <-chan *ReportRecord) {
 	latencyWithinSecTemp := &Stats{}
+	phasesWithinSecTemp := map[string]*Stats{}
 	go func() {
 		ticker := time.NewTicker(time.Second)
 		lastCount := int64(0)
@@ -145,6 +181,8 @@ func (s *StreamReport) Collect(recordChan <-chan *ReportRecord) {
 					*s.latencyWithinSec = *latencyWithinSecTemp
 					s.rpsWithinSec = rps
 					latencyWithinSecTemp.Reset()
+					s.phasesWithinSec = phasesWithinSecTemp
+					phasesWithinSecTemp = map[string]*Stats{}
 					s.noDateWithinSec = false
 				} else {
 					s.noDateWithinSec = true
@@ -177,6 +215,18 @@ func (s *StreamReport) Collect(recordChan <-chan *ReportRecord) {
 			s.counts.Insert([]byte(counting))
 		}
 		r.counting = nil
+		for _, sub := range r.subs {
+			s.insertSub(sub)
+			if phase, ok := strings.CutPrefix(sub.Name, PhasePrefix); ok {
+				st := phasesWithinSecTemp[phase]
+				if st == nil {
+					st = &Stats{}
+					phasesWithinSecTemp[phase] = st
+				}
+				st.Update(float64(sub.Cost))
+			}
+		}
+		r.subs = nil
 		s.readBytes += r.readBytes
 		s.writeBytes += r.writeBytes
 		s.lock.Unlock()
@@ -202,12 +252,22 @@ type SnapshotHistogram struct {
 	Count int
 }
 
+// SnapshotSub is the snapshot of a sub operation's statistics.
+type SnapshotSub struct {
+	Codes       map[string]int64
+	Stats       *SnapshotStats
+	Percentiles []*SnapshotPercentile
+	Name        string
+	Count       int64
+}
+
 type SnapshotReport struct {
 	Stats            *SnapshotStats
 	Codes, Errors    map[string]int64
 	RpsStats         *SnapshotRpsStats
 	Histograms       []*SnapshotHistogram
 	Percentiles      []*SnapshotPercentile
+	Subs             []*SnapshotSub
 	RPS, ElapseInSec float64
 	Count, Counting  int64
 
@@ -255,6 +315,27 @@ func (s *StreamReport) Snapshot() *SnapshotReport {
 		rs.Percentiles[i] = &SnapshotPercentile{Percentile: p, Latency: time.Duration(s.latencyQuantile.Query(p))}
 	}
 
+	for name, st := range s.subs {
+		sub := &SnapshotSub{
+			Name:  name,
+			Count: st.latencyStats.count,
+			Codes: make(map[string]int64, len(st.codes)),
+			Stats: &SnapshotStats{
+				Min: time.Duration(st.latencyStats.min), Mean: time.Duration(st.latencyStats.Mean()),
+				StdDev: time.Duration(st.latencyStats.Stddev()), Max: time.Duration(st.latencyStats.max),
+			},
+		}
+		for k, v := range st.codes {
+			sub.Codes[k] = v
+		}
+		for _, p := range subQuantiles {
+			sub.Percentiles = append(sub.Percentiles,
+				&SnapshotPercentile{Percentile: p, Latency: time.Duration(st.latencyQuantile.Query(p))})
+		}
+		rs.Subs = append(rs.Subs, sub)
+	}
+	sort.Slice(rs.Subs, func(i, j int) bool { return subOrder(rs.Subs[i].Name) < subOrder(rs.Subs[j].Name) })
+
 	hisBins := s.latencyHistogram.Bins()
 	rs.Histograms = make([]*SnapshotHistogram, len(hisBins))
 	for i, b := range hisBins {
@@ -266,11 +347,26 @@ func (s *StreamReport) Snapshot() *SnapshotReport {
 
 func (s *StreamReport) Done() <-chan struct{} { return s.doneChan }
 
+// subOrder is the sorting key of the sub operations, the phases are sorted in the order of Phases after the others.
+func subOrder(name string) string {
+	if phase, ok := strings.CutPrefix(name, PhasePrefix); ok {
+		for i, p := range Phases {
+			if p == phase {
+				return fmt.Sprintf("~%02d", i)
+			}
+		}
+		return "~~" + phase
+	}
+	return name
+}
+
 type ChartsReport struct {
 	Latency            []util.Float64
 	LatencyPercentiles []util.Float64
-	RPS                util.Float64
-	Concurrent         int64
+	// Phases are the mean latencies of Phases within the last second.
+	Phases     []util.Float64
+	RPS        util.Float64
+	Concurrent int64
 }
 
 func (s *StreamReport) Charts() *ChartsReport {
@@ -286,8 +382,19 @@ func (s *StreamReport) Charts() *ChartsReport {
 		percentiles[i] = util.Float64(s.latencyQuantile.Query(p) / 1e6)
 	}
 
+	var phases []util.Float64
+	if len(s.phasesWithinSec) > 0 {
+		phases = make([]util.Float64, len(Phases))
+		for i, p := range Phases {
+			if st := s.phasesWithinSec[p]; st != nil {
+				phases[i] = util.Float64(st.Mean() / 1e6)
+			}
+		}
+	}
+
 	l := s.latencyWithinSec
 	return &ChartsReport{
+		Phases:             phases,
 		RPS:                util.Float64(s.rpsWithinSec),
 		Latency:            []util.Float64{util.Float64(l.min / 1e6), util.Float64(l.Mean() / 1e6), util.Float64(l.Stddev() / 1e6), util.Float64(l.max / 1e6)},
 		LatencyPercentiles: percentiles,
@@ -302,6 +409,9 @@ func createMetrics(rd *ChartsReport, noop bool) []byte {
 		m["latency"] = rd.Latency
 		m["concurrent"] = []interface{}{rd.Concurrent}
 		m["tps"] = []interface{}{rd.RPS, 0}
+		if len(rd.Phases) > 0 {
+			m["phases"] = rd.Phases
+		}
 	}
 
 	md := Metrics{Time: time.Now().Format("2006-01-02 15:04:05"), Values: m}
@@ -41,6 +41,8 @@ type Requester struct {
 	n          int
 
 	concurrent int64
+	// vuSeq is the sequence to assign virtual user IDs.
+	vuSeq int64
 }
 
 func (c *Config) newRequester(ctx context.Context, fn Benchable) *Requester {
@@ -86,6 +88,7 @@ func (r *Requester) doRequest(ctx context.Context, rr *ReportRecord) (err error)
 	}
 
 	rr.code = result.Status
+	rr.subs = result.Subs
 	if r.verbose >= 1 {
 		rr.counting = result.Counting
 	}
@@ -210,6 +213,9 @@ func (r *Requester) loopWork(ctx context.Context, semaphore *int64, throttle fun
 		atomic.AddInt64(&r.concurrent, -1)
 	}()
 
+	vu := &VirtualUser{ID: int(atomic.AddInt64(&r.vuSeq, 1) - 1), Values: map[string]interface{}{}}
+	ctx = WithVirtualUser(ctx, vu)
+
 	for {
 		if r.n > 0 && atomic.AddInt64(semaphore, -1) < 0 {
 			return
@@ -220,6 +226,7 @@ func (r *Requester) loopWork(ctx context.Context, semaphore *int64, throttle fun
 
 		rr := recordPool.Get().(*ReportRecord)
 		rr.Reset()
+		vu.Iteration++
 		if err := r.runOne(ctx, rr); errors.Is(err, io.EOF) {
 			return
 		}